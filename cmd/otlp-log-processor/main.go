@@ -4,79 +4,156 @@ import (
 	"context"
 	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
-	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"dash0.com/otlp-log-processor-backend/internal/admin"
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
 	cfgpkg "dash0.com/otlp-log-processor-backend/internal/config"
+	"dash0.com/otlp-log-processor-backend/internal/logging"
 	"dash0.com/otlp-log-processor-backend/internal/orchestrator"
 	otelsetup "dash0.com/otlp-log-processor-backend/internal/otel"
 	otlpsrv "dash0.com/otlp-log-processor-backend/internal/otlp"
-	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/prom"
+	"dash0.com/otlp-log-processor-backend/internal/query"
+	"dash0.com/otlp-log-processor-backend/internal/rotate"
+	"dash0.com/otlp-log-processor-backend/internal/subscribe"
 )
 
 const name = "dash0.com/otlp-log-processor-backend"
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatalln(err)
+		// The application logger may be set up by now and not write to
+		// stderr, so report the error, e.g. an invalid configuration, there
+		// directly.
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
 func run() (err error) {
-	// Instance logger bridged to OTel.
-	logger := otelslog.NewLogger(name)
-	slog.SetDefault(logger)
-	logger.Info("Starting application")
+	// Config
+	readFlags := cfgpkg.RegisterFlags()
+
+	flag.Parse()
+
+	loader := cfgpkg.NewLoader(flag.CommandLine, readFlags)
+	loader.SetValidator(orchestrator.Validate)
+
+	cfg, _, err := loader.Load()
+	if readFlags().ValidateConfig {
+		if err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+
+		fmt.Println("configuration OK")
+
+		return nil
+	}
 
-	// Set up OpenTelemetry.
-	otelShutdown, err := otelsetup.Setup(context.Background())
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	// Set up OpenTelemetry, also exposing the metrics to Prometheus if enabled.
+	var (
+		promExporter *prom.Exporter
+		otelOpts     []otelsetup.Option
+		orchOpts     []orchestrator.Option
+	)
+
+	if cfg.Prometheus {
+		if promExporter, err = prom.New(cfg.PrometheusMaxValues); err != nil {
+			return err
+		}
+
+		otelOpts = append(otelOpts, otelsetup.WithMetricReader(promExporter.Reader()))
+		orchOpts = append(orchOpts, orchestrator.WithWindowObserver(promExporter.Values().Observe))
+	}
+
+	otelShutdown, err := otelsetup.Setup(context.Background(), otelOpts...)
 	if err != nil {
 		return
 	}
 
 	defer func() { err = errors.Join(err, otelShutdown(context.Background())) }()
 
-	// Config
-	readFlags := cfgpkg.RegisterFlags()
+	// Application logs go to stderr, apart from the snapshots, and optionally
+	// to the OTel log bridge. The admin API and config reloads change the level.
+	var logLevel slog.LevelVar
 
-	flag.Parse()
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
 
-	cfg := readFlags()
+	logLevel.Set(level)
 
-	slog.Debug("Starting listener", slog.String("listenAddr", cfg.ListenAddr))
-
-	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	logger, err := logging.New(logging.Options{Level: &logLevel, Format: logging.Format(cfg.LogFormat), OTel: cfg.LogOTel, Name: name})
 	if err != nil {
 		return err
 	}
 
-	// Optional output file for JSON sink
-	var outFile *os.File
+	slog.SetDefault(logger)
+
+	logger.Info("Starting application", "version", otelsetup.Version())
+
+	// Optional output file for the snapshot sink, rotated by size and age
+	var outFile *rotate.Writer
 	if cfg.OutputFile != "" {
-		f, openErr := os.OpenFile(cfg.OutputFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		fileOpts, optsErr := orchestrator.OutputFileOptions(cfg)
+		if optsErr != nil {
+			return optsErr
+		}
+
+		f, openErr := rotate.Open(fileOpts)
 		if openErr != nil {
 			return openErr
 		}
 
 		outFile = f
+
+		defer func() { err = errors.Join(err, outFile.Close()) }()
 	}
 
-	var opts []orchestrator.Option
+	var out io.Writer = os.Stdout
 	if outFile != nil {
-		opts = append(opts, orchestrator.WithSink(sink.NewJSONSink(outFile)))
+		out = outFile
+	}
+
+	outSink, err := orchestrator.OutputSink(cfg, out)
+	if err != nil {
+		return err
+	}
+
+	orchOpts = append(orchOpts, orchestrator.WithSink(outSink))
+
+	if cfg.ReplayDeadLetter != "" {
+		return replayDeadLetter(context.Background(), cfg, logger, orchOpts...)
+	}
+
+	slog.Debug("Starting listener", slog.String("listenAddr", cfg.ListenAddr))
+
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return err
 	}
 
-	orchestratorSvc, err := orchestrator.New(cfg, logger, opts...)
+	orchestratorSvc, err := orchestrator.New(cfg, logger, orchOpts...)
 	if err != nil {
 		return err
 	}
@@ -87,26 +164,93 @@ func run() (err error) {
 	// Start internal components; they will stop when sigCtx is canceled
 	orchestratorSvc.Start(sigCtx)
 
+	// SIGUSR1 restarts the cumulative count series; SIGHUP reopens the output
+	// file after an external rotation and reloads the configuration.
+	ctlSig := make(chan os.Signal, 1)
+	signal.Notify(ctlSig, syscall.SIGUSR1, syscall.SIGHUP)
+
+	defer signal.Stop(ctlSig)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ctlSig:
+				if sig == syscall.SIGHUP {
+					reopenOutput(outFile)
+					reloadConfig(sigCtx, loader, orchestratorSvc, &logLevel)
+				} else {
+					orchestratorSvc.ResetCumulative()
+				}
+			case <-sigCtx.Done():
+				return
+			}
+		}
+	}()
+
 	grpcServer := grpc.NewServer(
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.MaxRecvMsgSize(cfg.MaxReceiveMessageSize),
 		grpc.Creds(insecure.NewCredentials()),
 	)
-	collogspb.RegisterLogsServiceServer(grpcServer, otlpsrv.NewServer(orchestratorSvc))
+	logsOpts := []otlpsrv.ServerOption{otlpsrv.WithSampleRatio(cfg.SampleRatio)}
+	if fwd := orchestratorSvc.Forwarder(); fwd != nil {
+		logsOpts = append(logsOpts, otlpsrv.WithForwarder(fwd))
+	}
+
+	collogspb.RegisterLogsServiceServer(grpcServer, otlpsrv.NewServer(orchestratorSvc, logsOpts...))
+
+	querySrv := query.NewServer(orchestratorSvc)
+	processorv1.RegisterQueryServiceServer(grpcServer, querySrv)
+	processorv1.RegisterSubscriptionServiceServer(grpcServer, subscribe.NewServer(orchestratorSvc.Subscriptions()))
+
+	adminSrv := admin.NewServer(orchestratorSvc, admin.WithLogLevel(&logLevel))
+	processorv1.RegisterAdminServiceServer(grpcServer, adminSrv)
 
 	slog.Debug("Starting gRPC server")
 
 	// Serve in a goroutine so we can handle signals
-	serveErr := make(chan error, 1)
+	serveErr := make(chan error, 2)
 
 	go func() { serveErr <- grpcServer.Serve(listener) }()
 
+	var httpServer *http.Server
+
+	if cfg.HTTPListenAddr != "" {
+		httpListener, err := net.Listen("tcp", cfg.HTTPListenAddr)
+		if err != nil {
+			grpcServer.Stop()
+			return errors.Join(err, orchestratorSvc.Close(context.Background()))
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/v1/query/", querySrv.Handler())
+		mux.Handle("/v1/admin/", adminSrv.Handler())
+
+		if promExporter != nil {
+			mux.Handle("/metrics", promExporter.Handler())
+		}
+
+		httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		slog.Debug("Starting HTTP server", slog.String("httpListenAddr", cfg.HTTPListenAddr))
+
+		go func() {
+			if err := httpServer.Serve(httpListener); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
 	select {
 	case err := <-serveErr:
 		return err
 	case <-sigCtx.Done():
 		// Begin graceful shutdown
 		slog.Info("Shutdown signal received; beginning graceful shutdown")
+		// End subscription streams so they do not hold up the graceful stop;
+		// snapshots already buffered for a subscriber are still sent.
+		orchestratorSvc.Subscriptions().Close()
+
 		// Stop accepting new connections and allow in-flight RPCs to complete
 		done := make(chan struct{})
 
@@ -127,17 +271,88 @@ func run() (err error) {
 			grpcServer.Stop()
 		}
 
-		// Cancel internal components and wait for close
-		if err := orchestratorSvc.Close(shutdownCtx); err != nil {
-			return err
+		var httpErr error
+		if httpServer != nil {
+			httpErr = httpServer.Shutdown(shutdownCtx)
 		}
-		// Close the output file if used
-		if outFile != nil {
-			if cerr := outFile.Close(); cerr != nil {
-				return cerr
-			}
+
+		// Cancel internal components and wait for close; the output file is closed on return.
+		return errors.Join(httpErr, orchestratorSvc.Close(shutdownCtx))
+	}
+}
+
+// reopenOutput reopens the output file, if any, so that writes go to a new
+// file after logrotate or a similar tool moved the old one away.
+func reopenOutput(f *rotate.Writer) {
+	if f == nil {
+		return
+	}
+
+	if err := f.Reopen(); err != nil {
+		slog.Error("Reopening output file failed", slog.String("err", err.Error()))
+	}
+}
+
+// reloader applies reloadable settings at runtime.
+type reloader interface {
+	Reload(ctx context.Context, cfg cfgpkg.Config) error
+}
+
+// reloadConfig re-reads the configuration and applies its reloadable settings.
+// The log level is only set when log.level changed, so a level set through the
+// admin API survives unrelated reloads. An invalid configuration is logged and
+// the current settings are kept.
+func reloadConfig(ctx context.Context, loader *cfgpkg.Loader, svc reloader, logLevel *slog.LevelVar) {
+	cfg, changed, err := loader.Load()
+	if err != nil {
+		slog.Error("Config reload failed; keeping current settings", slog.String("err", err.Error()))
+		return
+	}
+
+	if slices.Contains(changed, "log.level") {
+		if level, err := logging.ParseLevel(cfg.LogLevel); err == nil {
+			logLevel.Set(level)
 		}
+	}
 
-		return nil
+	var restart []string
+
+	for _, path := range changed {
+		if !cfgpkg.Reloadable(path) {
+			restart = append(restart, path)
+		}
+	}
+
+	if len(restart) > 0 {
+		slog.Warn("Config changes take effect after a restart", slog.Any("settings", restart))
 	}
+
+	if err := svc.Reload(ctx, cfg); err != nil {
+		slog.Error("Config reload failed; keeping current settings", slog.String("err", err.Error()))
+		return
+	}
+
+	slog.Info("Config reloaded", slog.Any("changed", changed))
+}
+
+// replayDeadLetter builds the configured sinks and re-publishes every snapshot
+// in the configured dead-letter file to the sink it failed on, keeping each
+// snapshot's original window bounds.
+func replayDeadLetter(ctx context.Context, cfg cfgpkg.Config, logger *slog.Logger, opts ...orchestrator.Option) (err error) {
+	// Only the sinks are needed: neither resume nor checkpoint durable state,
+	// and forward no logs.
+	cfg.StateDir, cfg.ForwardEndpoint = "", ""
+
+	svc, err := orchestrator.New(cfg, logger, opts...)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = errors.Join(err, svc.Close(ctx)) }()
+
+	n, err := svc.ReplayDeadLetter(ctx, cfg.ReplayDeadLetter)
+
+	slog.Info("Replayed dead-letter file", slog.String("path", cfg.ReplayDeadLetter), slog.Int("snapshots", n), slog.Bool("ok", err == nil))
+
+	return err
 }
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"flag"
 	"io"
 	"log"
 	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +25,7 @@ import (
 	cfgpkg "dash0.com/otlp-log-processor-backend/internal/config"
 	"dash0.com/otlp-log-processor-backend/internal/orchestrator"
 	otlpsrv "dash0.com/otlp-log-processor-backend/internal/otlp"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
 )
 
 func TestLogsServiceServer_Export_Basic(t *testing.T) {
@@ -40,6 +46,82 @@ func TestLogsServiceServer_Export_Basic(t *testing.T) {
 	require.Empty(t, out.GetPartialSuccess().GetErrorMessage())
 }
 
+func TestReplayDeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+
+	dl, err := sink.OpenDeadLetter(path)
+	require.NoError(t, err)
+	require.NoError(t, dl.Publish(context.Background(), sink.Snapshot{WindowStart: 1000, WindowEnd: 2000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}))
+	require.NoError(t, dl.Publish(context.Background(), sink.Snapshot{WindowStart: 2000, WindowEnd: 3000, AttributeKey: "foo", Counts: map[string]uint64{"b": 2}, Total: 2}))
+	require.NoError(t, dl.PublishTarget(context.Background(), "sink/extra", sink.Snapshot{WindowStart: 3000, WindowEnd: 4000, AttributeKey: "foo", Counts: map[string]uint64{"c": 3}, Total: 3}))
+	require.NoError(t, dl.Close())
+
+	var out, extra bytes.Buffer
+
+	cfg := cfgpkg.Config{AttributeKey: "foo", Window: time.Second, ReplayDeadLetter: path}
+
+	require.NoError(t, replayDeadLetter(context.Background(), cfg, slog.Default(),
+		orchestrator.WithSink(sink.NewJSONSink(&out)),
+		orchestrator.WithAdditionalSink("extra", sink.NewJSONSink(&extra)),
+	))
+
+	// Each entry goes back to the sink it failed on.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"window_start":1000`)
+	require.Contains(t, lines[1], `"window_end":3000`)
+	require.Contains(t, extra.String(), `"window_start":3000`)
+	require.Equal(t, 1, strings.Count(extra.String(), "\n"))
+}
+
+type fakeReloader struct{ got []cfgpkg.Config }
+
+func (f *fakeReloader) Reload(_ context.Context, cfg cfgpkg.Config) error {
+	f.got = append(f.got, cfg)
+	return nil
+}
+
+func TestReloadConfig(t *testing.T) {
+	orig := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+
+	t.Cleanup(func() { flag.CommandLine = orig })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("aggregation:\n  window: 30s\n"), 0o600))
+
+	read := cfgpkg.RegisterFlags()
+	require.NoError(t, flag.CommandLine.Parse([]string{"-config", path}))
+
+	loader := cfgpkg.NewLoader(flag.CommandLine, read)
+	loader.SetValidator(orchestrator.Validate)
+
+	_, _, err := loader.Load()
+	require.NoError(t, err)
+
+	r := &fakeReloader{}
+
+	var level slog.LevelVar
+
+	require.NoError(t, os.WriteFile(path, []byte("aggregation:\n  window: 1m\nlog:\n  level: warn\n"), 0o600))
+	reloadConfig(context.Background(), loader, r, &level)
+	require.Len(t, r.got, 1)
+	require.Equal(t, time.Minute, r.got[0].Window)
+	require.Equal(t, slog.LevelWarn, level.Level())
+
+	// A level set at runtime is kept while log.level does not change.
+	level.Set(slog.LevelDebug)
+	require.NoError(t, os.WriteFile(path, []byte("aggregation:\n  window: 2m\nlog:\n  level: warn\n"), 0o600))
+	reloadConfig(context.Background(), loader, r, &level)
+	require.Len(t, r.got, 2)
+	require.Equal(t, slog.LevelDebug, level.Level())
+
+	// An invalid file is not applied.
+	require.NoError(t, os.WriteFile(path, []byte("pipelines:\n  rollups: {25s: r.jsonl}\n"), 0o600))
+	reloadConfig(context.Background(), loader, r, &level)
+	require.Len(t, r.got, 2)
+}
+
 func startTestServer(t *testing.T) (collogspb.LogsServiceClient, func()) {
 	t.Helper()
 
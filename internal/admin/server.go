@@ -0,0 +1,295 @@
+// Package admin serves the runtime reconfiguration API over gRPC and JSON/HTTP.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+	"dash0.com/otlp-log-processor-backend/internal/logging"
+)
+
+// maxBody bounds the size of an HTTP update request.
+const maxBody = 1 << 20
+
+// Source provides and applies the runtime settings.
+type Source interface {
+	RuntimeConfig() aggregator.Settings
+	Reconfigure(ctx context.Context, s aggregator.Settings) (aggregator.Settings, error)
+}
+
+// Server implements the AdminService over gRPC and JSON/HTTP.
+type Server struct {
+	processorv1.UnimplementedAdminServiceServer
+
+	src   Source
+	level *slog.LevelVar
+}
+
+// ServerOption configures the Server.
+type ServerOption func(*Server)
+
+// WithLogLevel serves the log level API, reading and changing level. Without
+// it, the log level calls are unimplemented.
+func WithLogLevel(level *slog.LevelVar) ServerOption {
+	return func(s *Server) { s.level = level }
+}
+
+// NewServer returns an admin server for src.
+func NewServer(src Source, opts ...ServerOption) *Server {
+	s := &Server{src: src}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// GetConfig returns the settings in effect.
+func (s *Server) GetConfig(context.Context, *processorv1.GetConfigRequest) (*processorv1.GetConfigResponse, error) {
+	return &processorv1.GetConfigResponse{Config: toProto(s.src.RuntimeConfig())}, nil
+}
+
+// UpdateConfig applies the masked fields of the request on top of the current settings.
+func (s *Server) UpdateConfig(ctx context.Context, req *processorv1.UpdateConfigRequest) (*processorv1.UpdateConfigResponse, error) {
+	next, err := merge(s.src.RuntimeConfig(), req.GetConfig(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	applied, err := s.src.Reconfigure(ctx, next)
+	switch {
+	case errors.Is(err, aggregator.ErrInvalidSettings):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, aggregator.ErrConflict):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, aggregator.ErrStopped):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.FromContextError(err).Err()
+	}
+
+	return &processorv1.UpdateConfigResponse{Config: toProto(applied)}, nil
+}
+
+// GetLogLevel returns the minimum level of the application logs.
+func (s *Server) GetLogLevel(context.Context, *processorv1.GetLogLevelRequest) (*processorv1.GetLogLevelResponse, error) {
+	if s.level == nil {
+		return nil, status.Error(codes.Unimplemented, "log level is not adjustable")
+	}
+
+	return &processorv1.GetLogLevelResponse{Level: logging.LevelName(s.level.Level())}, nil
+}
+
+// SetLogLevel changes the minimum level of the application logs. The change
+// lasts until a restart, or a config reload that changes log.level.
+func (s *Server) SetLogLevel(_ context.Context, req *processorv1.SetLogLevelRequest) (*processorv1.SetLogLevelResponse, error) {
+	if s.level == nil {
+		return nil, status.Error(codes.Unimplemented, "log level is not adjustable")
+	}
+
+	level, err := logging.ParseLevel(req.GetLevel())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	prev := s.level.Level()
+	s.level.Set(level)
+
+	if prev != level {
+		slog.Info("Log level changed", slog.String("from", logging.LevelName(prev)), slog.String("to", logging.LevelName(level)))
+	}
+
+	return &processorv1.SetLogLevelResponse{Level: logging.LevelName(level)}, nil
+}
+
+func toProto(s aggregator.Settings) *processorv1.RuntimeConfig {
+	return &processorv1.RuntimeConfig{
+		Generation:      s.Generation,
+		AttributeKey:    s.AttributeKey,
+		Window:          durationpb.New(s.Window),
+		MaxQueue:        uint32(max(s.MaxQueue, 0)),
+		IncludePrefixes: s.Filter.Include,
+		ExcludePrefixes: s.Filter.Exclude,
+	}
+}
+
+// merge applies the fields of c named by paths to cur. Without paths, every
+// field of c set to a non-zero value is applied. The generation is always
+// taken from c, as a precondition rather than a setting.
+func merge(cur aggregator.Settings, c *processorv1.RuntimeConfig, paths []string) (aggregator.Settings, error) {
+	if len(paths) == 0 {
+		c.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			paths = append(paths, string(fd.Name()))
+			return true
+		})
+	}
+
+	next := cur
+	next.Generation = c.GetGeneration()
+
+	applied := 0
+
+	for _, p := range paths {
+		if p != "generation" {
+			applied++
+		}
+
+		switch p {
+		case "generation":
+		case "attribute_key":
+			next.AttributeKey = c.GetAttributeKey()
+		case "window":
+			if w := c.GetWindow(); w != nil {
+				if err := w.CheckValid(); err != nil {
+					return cur, err
+				}
+			}
+
+			next.Window = c.GetWindow().AsDuration()
+		case "max_queue":
+			next.MaxQueue = int(c.GetMaxQueue())
+		case "include_prefixes":
+			next.Filter.Include = c.GetIncludePrefixes()
+		case "exclude_prefixes":
+			next.Filter.Exclude = c.GetExcludePrefixes()
+		default:
+			return cur, errors.New("unknown field in update mask: " + p)
+		}
+	}
+
+	if applied == 0 {
+		return cur, errors.New("no fields to update")
+	}
+
+	return next, nil
+}
+
+var jsonOpts = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// Handler serves the same API as JSON:
+//
+//	GET   /v1/admin/config
+//	PATCH /v1/admin/config     (a RuntimeConfig; the fields present are applied)
+//	GET   /v1/admin/log_level
+//	PUT   /v1/admin/log_level  (a SetLogLevelRequest, e.g. {"level":"debug"})
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := s.GetConfig(r.Context(), &processorv1.GetConfigRequest{})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("PATCH /v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseUpdate(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.UpdateConfig(r.Context(), req)
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("GET /v1/admin/log_level", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := s.GetLogLevel(r.Context(), &processorv1.GetLogLevelRequest{})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("PUT /v1/admin/log_level", func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := &processorv1.SetLogLevelRequest{}
+		if err := protojson.Unmarshal(raw, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.SetLogLevel(r.Context(), req)
+		writeJSON(w, resp, err)
+	})
+
+	return mux
+}
+
+// parseUpdate decodes a RuntimeConfig and masks exactly the fields present in
+// the body, so that fields can also be cleared.
+func parseUpdate(body io.Reader) (*processorv1.UpdateConfigRequest, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &processorv1.RuntimeConfig{}
+	if err := protojson.Unmarshal(raw, c); err != nil {
+		return nil, err
+	}
+
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &present); err != nil {
+		return nil, err
+	}
+
+	fields := c.ProtoReflect().Descriptor().Fields()
+	mask := &fieldmaskpb.FieldMask{}
+
+	for k := range present {
+		fd := fields.ByJSONName(k)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(k))
+		}
+
+		// protojson has already rejected unknown fields.
+		if fd != nil {
+			mask.Paths = append(mask.Paths, string(fd.Name()))
+		}
+	}
+
+	return &processorv1.UpdateConfigRequest{Config: c, UpdateMask: mask}, nil
+}
+
+func writeJSON(w http.ResponseWriter, msg proto.Message, err error) {
+	if err != nil {
+		code := http.StatusInternalServerError
+
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			code = http.StatusBadRequest
+		case codes.FailedPrecondition:
+			code = http.StatusConflict
+		case codes.Unavailable:
+			code = http.StatusServiceUnavailable
+		case codes.DeadlineExceeded:
+			code = http.StatusGatewayTimeout
+		case codes.Unimplemented:
+			code = http.StatusNotImplemented
+		}
+
+		http.Error(w, status.Convert(err).Message(), code)
+
+		return
+	}
+
+	body, err := jsonOpts.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+)
+
+type fakeSource struct {
+	cur aggregator.Settings
+	err error
+}
+
+func (f *fakeSource) RuntimeConfig() aggregator.Settings { return f.cur }
+
+func (f *fakeSource) Reconfigure(_ context.Context, s aggregator.Settings) (aggregator.Settings, error) {
+	if f.err != nil {
+		return aggregator.Settings{}, f.err
+	}
+
+	s.Generation = f.cur.Generation + 1
+	f.cur = s
+
+	return s, nil
+}
+
+func newSource() *fakeSource {
+	return &fakeSource{cur: aggregator.Settings{
+		Generation:   1,
+		AttributeKey: "foo",
+		Window:       10 * time.Second,
+		MaxQueue:     100,
+		Filter:       aggregator.ValueFilter{Exclude: []string{"debug-"}},
+	}}
+}
+
+func TestServer_UpdateConfig(t *testing.T) {
+	src := newSource()
+	srv := NewServer(src)
+	ctx := context.Background()
+
+	resp, err := srv.UpdateConfig(ctx, &processorv1.UpdateConfigRequest{
+		Config:     &processorv1.RuntimeConfig{Window: durationpb.New(time.Minute), AttributeKey: "ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"window", "exclude_prefixes"}},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, resp.GetConfig().GetGeneration())
+	require.Equal(t, "foo", src.cur.AttributeKey)
+	require.Equal(t, time.Minute, src.cur.Window)
+	require.Empty(t, src.cur.Filter.Exclude)
+
+	// Without a mask, the non-zero fields are applied.
+	_, err = srv.UpdateConfig(ctx, &processorv1.UpdateConfigRequest{Config: &processorv1.RuntimeConfig{AttributeKey: "bar"}})
+	require.NoError(t, err)
+	require.Equal(t, "bar", src.cur.AttributeKey)
+	require.Equal(t, time.Minute, src.cur.Window)
+
+	for _, req := range []*processorv1.UpdateConfigRequest{
+		{Config: &processorv1.RuntimeConfig{}},
+		{Config: &processorv1.RuntimeConfig{Generation: 3}},
+		{UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"tenant"}}},
+	} {
+		_, err = srv.UpdateConfig(ctx, req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	src.err = aggregator.ErrConflict
+	_, err = srv.UpdateConfig(ctx, &processorv1.UpdateConfigRequest{Config: &processorv1.RuntimeConfig{MaxQueue: 5}})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func do(t *testing.T, h http.Handler, method, body string) (int, string) {
+	t.Helper()
+
+	return doPath(t, h, method, "/v1/admin/config", body)
+}
+
+func doPath(t *testing.T, h http.Handler, method, path, body string) (int, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	b, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+
+	return rec.Code, string(b)
+}
+
+func TestServer_HTTP(t *testing.T) {
+	src := newSource()
+	h := NewServer(src).Handler()
+
+	code, body := do(t, h, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"config":{"generation":"1","attribute_key":"foo","window":"10s","max_queue":100,"include_prefixes":[],"exclude_prefixes":["debug-"]}}`, body)
+
+	// Present fields are applied, including empty ones.
+	code, body = do(t, h, http.MethodPatch, `{"generation":"1","attributeKey":"bar","exclude_prefixes":[]}`)
+	require.Equal(t, http.StatusOK, code, body)
+	require.Equal(t, "bar", src.cur.AttributeKey)
+	require.Empty(t, src.cur.Filter.Exclude)
+	require.Equal(t, 10*time.Second, src.cur.Window)
+
+	code, _ = do(t, h, http.MethodPatch, `{"window":"soon"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(t, h, http.MethodPatch, `{"generation":"2"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	src.err = aggregator.ErrConflict
+	code, _ = do(t, h, http.MethodPatch, `{"generation":"1","window":"60s"}`)
+	require.Equal(t, http.StatusConflict, code)
+
+	src.err = aggregator.ErrStopped
+	code, _ = do(t, h, http.MethodPatch, `{"window":"60s"}`)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	var level slog.LevelVar
+
+	srv := NewServer(newSource(), WithLogLevel(&level))
+	ctx := context.Background()
+
+	resp, err := srv.SetLogLevel(ctx, &processorv1.SetLogLevelRequest{Level: "DEBUG"})
+	require.NoError(t, err)
+	require.Equal(t, "debug", resp.GetLevel())
+	require.Equal(t, slog.LevelDebug, level.Level())
+
+	_, err = srv.SetLogLevel(ctx, &processorv1.SetLogLevelRequest{Level: "verbose"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, slog.LevelDebug, level.Level())
+
+	h := srv.Handler()
+
+	code, body := doPath(t, h, http.MethodPut, "/v1/admin/log_level", `{"level":"warn"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	require.Equal(t, slog.LevelWarn, level.Level())
+
+	code, body = doPath(t, h, http.MethodGet, "/v1/admin/log_level", "")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"level":"warn"}`, body)
+
+	code, _ = doPath(t, h, http.MethodPut, "/v1/admin/log_level", `{"level":""}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// Without a level to adjust.
+	code, _ = doPath(t, NewServer(newSource()).Handler(), http.MethodGet, "/v1/admin/log_level", "")
+	require.Equal(t, http.StatusNotImplemented, code)
+}
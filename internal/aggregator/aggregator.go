@@ -2,40 +2,129 @@ package aggregator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
 )
 
 // Event is a lightweight ingestion item carrying the attribute value.
 type Event struct{ Value string }
 
+// Batch carries the values resolved from one export request together with the
+// number of records that fell into each reserved bucket. Generation is the
+// settings generation the values were resolved under; EnqueueBatch refuses
+// batches resolved under an attribute key that has since been replaced. Zero
+// skips the check.
+type Batch struct {
+	Generation  uint64
+	Values      []string
+	Missing     uint64
+	Null        uint64
+	Unsupported uint64
+}
+
+// Len returns the number of records represented by the batch.
+func (b Batch) Len() int { return len(b.Values) + int(b.Missing+b.Null+b.Unsupported) }
+
 // Aggregator performs windowed counting by attribute value and publishes snapshots.
 type Aggregator struct {
-	in           chan Event
-	inBatch      chan []string
-	window       time.Duration
-	sink         sink.Sink
-	logger       *slog.Logger
-	attributeKey string
+	sink   sink.Sink
+	logger *slog.Logger
+	tenant string
+	labels sink.BucketLabels
+
+	// Runtime settings and the queues they size; see reconfigure.go. Written
+	// only by the aggregation goroutine once started.
+	settings  atomic.Pointer[Settings]
+	queues    atomic.Pointer[ingestQueues]
+	reconfigs chan reconfigRequest
+
+	// keyGeneration is the generation that introduced the current attribute
+	// key. EnqueueBatch checks it and sends under keyMu, so that a key change
+	// lets every batch accepted before it into the closing window and none
+	// after it.
+	keyMu         sync.RWMutex
+	keyGeneration atomic.Uint64
 
 	nowFn func() time.Time
 
-	// Single-goroutine owned fields
-	counts map[string]uint64
-	total  uint64
+	// Single-goroutine owned fields.
+	counts      map[string]uint64
+	missing     uint64
+	null        uint64
+	unsupported uint64
+	total       uint64
 
 	// Drops recorded from producers when channel is full
 	externalDropped atomic.Uint64
 
+	// Views emitted per window and the running totals behind the cumulative one.
+	temporalities []sink.Temporality
+	cum           cumulative
+	resetCum      atomic.Bool
+
+	// Publish retries and the sink receiving snapshots that exhausted them.
+	retry      sink.RetryPolicy
+	deadLetter DeadLetterSink
+
+	// Asynchronous delivery; see publisher.go. pubCtx bounds every delivery
+	// and dead-letter write; Stop cancels it once its deadline passes.
+	pubCtx     context.Context
+	pubCancel  context.CancelFunc
+	pubQueue   chan pendingSnapshot
+	pubWorkers int
+	pubWG      sync.WaitGroup
+	// Snapshots the loop could not queue, written by one goroutine so that
+	// dead-letter I/O never runs on the loop.
+	dlQueue    chan pendingSnapshot
+	dlDone     chan struct{}
+	pendingMu  sync.Mutex
+	pending    map[uint64]wal.Pending
+	pendingSeq uint64
+	recovered  []wal.Pending
+
+	// Sinks receiving a copy of every primary snapshot through their own
+	// lanes, so retries on one never delay or duplicate another.
+	extra []*lane
+
+	// Delivery health by sink name; see SinkStatuses.
+	healthMu   sync.Mutex
+	health     map[string]*SinkStatus
+	onDelivery func(sink string, err error)
+
+	// Requests for a copy of the open window, answered by the loop.
+	queries chan chan sink.Snapshot
+
+	// Called with every closed delta window, empty ones included.
+	observers []func(sink.Snapshot)
+
+	// Rollup tiers, finest first; see rollup.go.
+	tiers            []*tier
+	recoveredRollups map[string]sink.Snapshot
+
+	// Optional durable state; resumeStart is the recovered window start (0 if
+	// none), counted under resumeKey and resumeGeneration. unsaved is what was
+	// applied since the last append.
+	state            *wal.Log
+	resumeStart      int64
+	resumeKey        string
+	resumeGeneration uint64
+	stateFailing     bool
+	unsaved          wal.Record
+
 	done chan struct{}
 
 	// Optional metric callbacks provided by the owner (e.g., orchestrator).
 	incrFlushes       func(int64)
 	incrPublishFailed func(int64)
+	recordPublish     func(sink string, d time.Duration)
+	recordFlush       func(time.Duration)
 }
 
 func New(window time.Duration, attributeKey string, s sink.Sink, logger *slog.Logger, maxQueue int) *Aggregator {
@@ -44,16 +133,27 @@ func New(window time.Duration, attributeKey string, s sink.Sink, logger *slog.Lo
 	}
 
 	a := &Aggregator{
-		in:           make(chan Event, maxQueue),
-		inBatch:      make(chan []string, maxQueue),
-		window:       window,
-		sink:         s,
-		logger:       logger,
-		attributeKey: attributeKey,
-		counts:       make(map[string]uint64, 32),
-		done:         make(chan struct{}),
+		sink:          s,
+		logger:        logger,
+		labels:        sink.DefaultBucketLabels(),
+		retry:         sink.DefaultRetryPolicy(),
+		temporalities: []sink.Temporality{sink.TemporalityDelta},
+		pubQueue:      make(chan pendingSnapshot, DefaultPublishQueue),
+		pubWorkers:    1,
+		dlQueue:       make(chan pendingSnapshot, DefaultPublishQueue),
+		dlDone:        make(chan struct{}),
+		pending:       make(map[uint64]wal.Pending),
+		health:        make(map[string]*SinkStatus),
+		counts:        make(map[string]uint64, 32),
+		queries:       make(chan chan sink.Snapshot),
+		reconfigs:     make(chan reconfigRequest),
+		done:          make(chan struct{}),
 	}
 	a.nowFn = time.Now
+	a.pubCtx, a.pubCancel = context.WithCancel(context.Background())
+	a.settings.Store(&Settings{Generation: 1, AttributeKey: attributeKey, Window: window, MaxQueue: maxQueue})
+	a.queues.Store(newIngestQueues(maxQueue))
+	a.keyGeneration.Store(1)
 
 	return a
 }
@@ -65,24 +165,101 @@ func (a *Aggregator) SetMetricsCallbacks(incrFlushes, incrPublishFailed func(int
 	a.incrPublishFailed = incrPublishFailed
 }
 
+// SetPublishMetrics installs an optional callback observing the duration of
+// each snapshot delivery to the named sink, including retries.
+func (a *Aggregator) SetPublishMetrics(recordPublish func(sink string, d time.Duration)) {
+	a.recordPublish = recordPublish
+}
+
+// SetFlushMetrics installs an optional callback observing how long closing a
+// window holds up the aggregation loop: building the snapshot, queueing it for
+// delivery, rollups and window observers.
+func (a *Aggregator) SetFlushMetrics(recordFlush func(time.Duration)) {
+	a.recordFlush = recordFlush
+}
+
+// SetRetryPolicy overrides the retry policy for failed publishes.
+func (a *Aggregator) SetRetryPolicy(p sink.RetryPolicy) { a.retry = p }
+
+// DeadLetterSink receives snapshots whose delivery failed for good, together
+// with the target they failed on, so that Redeliver can send them there later.
+type DeadLetterSink interface {
+	PublishTarget(ctx context.Context, target string, snap sink.Snapshot) error
+}
+
+// SetDeadLetter installs the sink that receives snapshots whose publish
+// attempts are exhausted. Without one, such snapshots are logged and discarded.
+func (a *Aggregator) SetDeadLetter(s DeadLetterSink) { a.deadLetter = s }
+
+// SetStateLog enables durable window state. Applied batches are appended to l,
+// those queued together as one record, and the window is checkpointed on each
+// flush. recovered is restored as the open window, which Start resumes instead
+// of opening a new one; a clean stop leaves none open. A window counted under
+// another attribute key is closed and published as is instead. Must be called
+// before Start.
+func (a *Aggregator) SetStateLog(l *wal.Log, recovered wal.State) {
+	a.state = l
+	a.recovered = recovered.Pending
+	a.recoveredRollups = recovered.Rollups
+
+	if recovered.WindowStart == 0 && recovered.Total == 0 {
+		return
+	}
+
+	a.resumeStart = recovered.WindowStart
+	a.resumeKey = recovered.AttributeKey
+	a.resumeGeneration = recovered.Generation
+
+	for k, v := range recovered.Counts {
+		a.counts[k] = v
+	}
+
+	a.missing = recovered.Missing
+	a.null = recovered.Null
+	a.unsupported = recovered.Unsupported
+	a.total = recovered.Total
+}
+
+// AddWindowObserver registers fn to be called on the aggregation goroutine with
+// every closed delta window, including empty ones. fn must not block and must
+// not modify the snapshot. Must be called before Start.
+func (a *Aggregator) AddWindowObserver(fn func(sink.Snapshot)) {
+	a.observers = append(a.observers, fn)
+}
+
+// SetBucketLabels overrides the labels stamped on snapshots for the reserved buckets.
+func (a *Aggregator) SetBucketLabels(labels sink.BucketLabels) { a.labels = labels }
+
+// SetTenant stamps every snapshot with tenant. Must be called before Start.
+func (a *Aggregator) SetTenant(tenant string) { a.tenant = tenant }
+
 // Enqueue attempts to add an event without blocking. Returns false if queue is full.
 func (a *Aggregator) Enqueue(v string) bool {
 	select {
-	case a.in <- Event{Value: v}:
+	case a.queues.Load().in <- Event{Value: v}:
 		return true
 	default:
 		return false
 	}
 }
 
-// EnqueueBatch attempts to add a batch of events without blocking. Returns false if queue is full.
-func (a *Aggregator) EnqueueBatch(values []string) bool {
-	if len(values) == 0 {
+// EnqueueBatch attempts to add a batch of events without blocking. Returns
+// false if the queue is full or the batch was resolved under a replaced key.
+func (a *Aggregator) EnqueueBatch(b Batch) bool {
+	if b.Len() == 0 {
 		return true
 	}
 
+	a.keyMu.RLock()
+	defer a.keyMu.RUnlock()
+
+	// The values belong to a previous key; they are refused, not miscounted.
+	if b.Generation != 0 && b.Generation < a.keyGeneration.Load() {
+		return false
+	}
+
 	select {
-	case a.inBatch <- values:
+	case a.queues.Load().inBatch <- b:
 		return true
 	default:
 		return false
@@ -94,97 +271,432 @@ func (a *Aggregator) RecordDrop(n uint64) { a.externalDropped.Add(n) }
 
 // Start begins the aggregation loop.
 func (a *Aggregator) Start(ctx context.Context) {
+	a.restoreRollups()
+	a.startPublishers()
+
 	go func() {
 		defer close(a.done)
 
-		ticker := time.NewTicker(a.window)
-		defer ticker.Stop()
+		now := a.nowFn()
+		window := a.Settings().Window
+		windowStart := now.UnixMilli()
+		firstTick := window
 
-		windowStart := a.nowFn().UnixMilli()
+		// Rollup buckets are epoch multiples, so windows are too: a window
+		// must never straddle a bucket boundary.
+		aligned := len(a.tiers) > 0
+
+		// Resume a recovered window and close it when it was originally due.
+		if a.resumeStart > 0 {
+			windowStart = a.resumeStart
+			firstTick = max(time.UnixMilli(windowStart).Add(window).Sub(now), time.Millisecond)
+		}
+
+		// A window counted under another key cannot be continued: close it
+		// with the key it was counted under and open a new one.
+		if a.resumeStart > 0 && a.resumeKey != "" && a.resumeKey != a.Settings().AttributeKey {
+			a.closeRecovered(min(windowStart+window.Milliseconds(), now.UnixMilli()))
+			windowStart = now.UnixMilli()
+			firstTick = window
+		}
+
+		if aligned {
+			firstTick = untilBoundary(now, windowStart, window)
+		}
+
+		q := a.queues.Load()
+		// Queues replaced by a reconfiguration; drained until the next window closes.
+		var old *ingestQueues
+
+		// Fold any replayed records into a checkpoint and persist the window start.
+		a.checkpoint(windowStart)
+
+		ticker := time.NewTicker(firstTick)
+		defer ticker.Stop()
 
 		for {
 			select {
-				case <-ctx.Done():
-					a.flush(windowStart, a.nowFn().UnixMilli())
-					return
-				case <-ticker.C:
-					windowEnd := a.nowFn().UnixMilli()
-					a.flush(windowStart, windowEnd)
+			case <-ctx.Done():
+				windowEnd := a.nowFn().UnixMilli()
+				a.flush(windowStart, windowEnd)
+				// Durable state keeps open rollup windows across restarts; without
+				// it they are emitted partial rather than lost.
+				if a.state == nil {
+					a.closeRollups()
+				}
+
+				// The window is closed, not open since shutdown: a restart opens
+				// a new one at its own start time.
+				a.checkpoint(0)
+				// Let queued snapshots drain, then record that they are no longer pending.
+				a.stopPublishers()
+				a.checkpoint(0)
+
+				return
+			case <-ticker.C:
+				if firstTick != window {
+					ticker.Reset(window)
+					firstTick = window
+				}
+
+				if old != nil {
+					a.drain(old)
+					old = nil
+				}
+
+				windowEnd := a.nowFn().UnixMilli()
+				if aligned {
+					windowEnd = alignedEnd(windowStart, windowEnd, window)
+				}
+
+				a.flush(windowStart, windowEnd)
+				windowStart = windowEnd
+				a.checkpoint(windowStart)
+			case ev := <-q.in:
+				a.add(ev)
+				a.ingestReady(q)
+				a.persist()
+			case b := <-q.inBatch:
+				a.apply(b)
+				a.ingestReady(q)
+				a.persist()
+			case ev := <-old.inOrNil():
+				a.add(ev)
+				a.persist()
+			case b := <-old.inBatchOrNil():
+				a.apply(b)
+				a.persist()
+			case reply := <-a.queries:
+				reply <- a.openWindow(windowStart)
+			case req := <-a.reconfigs:
+				if old != nil {
+					a.drain(old)
+					old = nil
+				}
+
+				windowEnd := a.nowFn().UnixMilli()
+
+				prev, err := a.applyReconfig(req, windowStart, windowEnd)
+				if err == nil {
 					windowStart = windowEnd
-				default:
-					select {
-						case ev := <-a.in:
-							a.total++
-							a.counts[ev.Value]++
-						case vals := <-a.inBatch:
-							a.total += uint64(len(vals))
-							for _, v := range vals {
-								a.counts[v]++
-							}
+					a.checkpoint(windowStart)
+
+					if prev != nil {
+						old, q = prev, a.queues.Load()
+					}
+
+					window = a.Settings().Window
+					firstTick = window
+
+					if aligned {
+						firstTick = untilBoundary(a.nowFn(), windowStart, window)
 					}
+
+					ticker.Reset(firstTick)
+				}
+
+				req.reply <- reconfigResult{s: a.Settings(), err: err}
 			}
 		}
 	}()
 }
 
-// Stop requests the loop to stop and waits for completion.
-func (a *Aggregator) Stop(ctx context.Context) {
-	// Wait for the aggregator loop to finish; caller should cancel the context passed to Start.
-	select {
-	case <-a.done:
+// untilBoundary returns how long after now the window starting at windowStart
+// reaches the next epoch multiple of window.
+func untilBoundary(now time.Time, windowStart int64, window time.Duration) time.Duration {
+	w := window.Milliseconds()
+	next := windowStart - windowStart%w + w
+
+	return max(time.UnixMilli(next).Sub(now), time.Millisecond)
+}
+
+// alignedEnd rounds the end of an aligned window down to an epoch multiple
+// of window, so that ticker latency does not carry it past the boundary. It
+// keeps now if that would leave the window empty, e.g. after a clock step.
+func alignedEnd(windowStart, now int64, window time.Duration) int64 {
+	w := window.Milliseconds()
+	if end := now - now%w; end > windowStart {
+		return end
+	}
+
+	return now
+}
+
+// add counts a single value.
+func (a *Aggregator) add(ev Event) {
+	if f := a.settings.Load().Filter; !f.empty() && !f.Allows(ev.Value) {
 		return
-	case <-ctx.Done():
+	}
+
+	a.total++
+	a.counts[ev.Value]++
+
+	if a.state != nil {
+		a.unsaved.Values = append(a.unsaved.Values, ev.Value)
+	}
+}
+
+func (a *Aggregator) apply(b Batch) {
+	if f := a.settings.Load().Filter; !f.empty() {
+		kept := make([]string, 0, len(b.Values))
+		for _, v := range b.Values {
+			if f.Allows(v) {
+				kept = append(kept, v)
+			}
+		}
+
+		b.Values = kept
+	}
+
+	a.total += uint64(b.Len())
+	a.missing += b.Missing
+	a.null += b.Null
+	a.unsupported += b.Unsupported
+
+	for _, v := range b.Values {
+		a.counts[v]++
+	}
+
+	if a.state != nil {
+		a.unsaved.Values = append(a.unsaved.Values, b.Values...)
+		a.unsaved.Missing += b.Missing
+		a.unsaved.Null += b.Null
+		a.unsaved.Unsupported += b.Unsupported
+	}
+}
+
+// ingestReady applies the events and batches queued on q, at most as many as
+// were queued on entry so that ticks and queries are not held up, for them to
+// share one state log record.
+func (a *Aggregator) ingestReady(q *ingestQueues) {
+	for n := len(q.in) + len(q.inBatch); n > 0; n-- {
+		select {
+		case ev := <-q.in:
+			a.add(ev)
+		case b := <-q.inBatch:
+			a.apply(b)
+		default:
+			return
+		}
+	}
+}
+
+// persist appends what was applied since the last call to the state log as
+// one record. Failures do not stop aggregation; they are logged once per
+// failing streak.
+func (a *Aggregator) persist() {
+	r := a.unsaved
+	if a.state == nil || (len(r.Values) == 0 && r.Missing == 0 && r.Null == 0 && r.Unsupported == 0) {
 		return
 	}
+
+	a.stateResult("append", a.state.Append(r))
+	a.unsaved = wal.Record{Values: r.Values[:0]}
 }
 
-func (a *Aggregator) flush(windowStart, windowEnd int64) {
-	if len(a.counts) == 0 && a.total == 0 && a.externalDropped.Load() == 0 {
+// checkpoint records the open window as starting at windowStart, 0 if none is
+// open, together with the closed snapshots not yet delivered. The counters
+// cover what was applied but not yet appended, so that is dropped.
+func (a *Aggregator) checkpoint(windowStart int64) {
+	if a.state == nil {
 		return
 	}
-	// Snapshot counts
-	snapshotCounts := make(map[string]uint64, len(a.counts))
-	for k, v := range a.counts {
-		snapshotCounts[k] = v
+
+	a.unsaved = wal.Record{Values: a.unsaved.Values[:0]}
+
+	settings := a.settings.Load()
+
+	a.stateResult("checkpoint", a.state.Checkpoint(wal.State{
+		AttributeKey: settings.AttributeKey,
+		Generation:   settings.Generation,
+		WindowStart:  windowStart,
+		Counts:       a.counts,
+		Missing:      a.missing,
+		Null:         a.null,
+		Unsupported:  a.unsupported,
+		Total:        a.total,
+		Pending:      a.pendingSnapshots(),
+		Rollups:      a.openRollups(),
+	}))
+}
+
+// closeRecovered publishes the recovered window, counted under resumeKey, as
+// a snapshot ending at windowEnd and clears the counters. It is not fed to
+// rollups, observers or the cumulative series, which follow the current key.
+func (a *Aggregator) closeRecovered(windowEnd int64) {
+	a.logger.Warn("recovered window was counted under another attribute key; publishing it as is",
+		slog.String("recovered_key", a.resumeKey), slog.String("attribute_key", a.Settings().AttributeKey))
+
+	a.publishPrimary(sink.Snapshot{
+		WindowStart:  a.resumeStart,
+		WindowEnd:    windowEnd,
+		Temporality:  sink.TemporalityDelta,
+		Generation:   a.resumeGeneration,
+		AttributeKey: a.resumeKey,
+		Tenant:       a.tenant,
+		Counts:       a.counts,
+		Missing:      a.missing,
+		Null:         a.null,
+		Unsupported:  a.unsupported,
+		Labels:       a.labels,
+		Total:        a.total,
+	})
+
+	a.counts = make(map[string]uint64, 32)
+	a.missing, a.null, a.unsupported = 0, 0, 0
+	a.total = 0
+}
+
+func (a *Aggregator) stateResult(op string, err error) {
+	switch {
+	case err != nil && !a.stateFailing:
+		a.stateFailing = true
+		a.logger.Error("failed to persist window state", slog.String("op", op), slog.String("err", err.Error()))
+	case err == nil && a.stateFailing:
+		a.stateFailing = false
+		a.logger.Info("window state persistence recovered", slog.String("op", op))
+	}
+}
+
+// Stop waits for the loop to finish its final flush and for the publish
+// queues to drain; the caller cancels the context passed to Start first.
+//
+// Once ctx is done, deliveries still in progress or queued are cancelled:
+// with durable state they stay pending for the next start, otherwise they are
+// dead-lettered. Stop still waits for every goroutine to exit, so the state
+// log and the dead-letter sink can be closed once it returns, and reports the
+// timeout. Sinks must therefore honour the context they are given.
+func (a *Aggregator) Stop(ctx context.Context) error {
+	defer a.pubCancel()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
 	}
 
+	a.pubCancel()
+	<-a.done
+
+	return fmt.Errorf("aggregator stop: deliveries cancelled after the shutdown deadline: %w", ctx.Err())
+}
+
+func (a *Aggregator) flush(windowStart, windowEnd int64) {
+	start := time.Now()
+
 	dropped := a.externalDropped.Swap(0)
+	empty := len(a.counts) == 0 && a.total == 0 && dropped == 0
+
+	// The counts map is handed to the snapshot and replaced below.
 	snap := sink.Snapshot{
 		WindowStart:  windowStart,
 		WindowEnd:    windowEnd,
-		AttributeKey: a.attributeKey,
-		Counts:       snapshotCounts,
+		Temporality:  sink.TemporalityDelta,
+		Generation:   a.settings.Load().Generation,
+		AttributeKey: a.settings.Load().AttributeKey,
+		Tenant:       a.tenant,
+		Counts:       a.counts,
+		Missing:      a.missing,
+		Null:         a.null,
+		Unsupported:  a.unsupported,
+		Labels:       a.labels,
 		Total:        a.total,
 		Dropped:      dropped,
 	}
 
-	if err := a.sink.Publish(context.Background(), snap); err != nil {
-		a.logger.Error(
-			"failed to publish snapshot",
-			slog.String("err", err.Error()),
-			slog.String("attribute_key", a.attributeKey),
-			slog.Int64("window_start", windowStart),
-			slog.Int64("window_end", windowEnd),
-			slog.Any("total", a.total),
-			slog.Any("dropped", dropped),
-			slog.String("sink", fmt.Sprintf("%T", a.sink)),
-		)
-
-		if a.incrPublishFailed != nil {
-			a.incrPublishFailed(1)
+	// The window is closed either way: a snapshot that cannot be delivered is
+	// retried on its own and then dead-lettered, never merged into the next window.
+	a.counts = make(map[string]uint64, 32)
+	a.missing, a.null, a.unsupported = 0, 0, 0
+	a.total = 0
+
+	for _, t := range a.temporalities {
+		switch t {
+		case sink.TemporalityDelta:
+			if !empty {
+				a.publishPrimary(snap)
+			}
+		case sink.TemporalityCumulative:
+			if cum, ok := a.cumulate(snap); ok {
+				a.publishPrimary(cum)
+			}
 		}
-		// Do not reset counts on failed publish to avoid losing data.
-		// We'll attempt to publish combined data on the next flush.
-		return
 	}
 
 	if a.incrFlushes != nil {
 		a.incrFlushes(1)
 	}
-	// Reset on successful publish
-	a.counts = make(map[string]uint64, 32)
-	a.total = 0
+
+	a.rollup(snap)
+
+	for _, fn := range a.observers {
+		fn(snap)
+	}
+
+	if a.recordFlush != nil {
+		a.recordFlush(time.Since(start))
+	}
+}
+
+// ErrStopped is returned by CurrentWindow once the aggregation loop has ended.
+var ErrStopped = errors.New("aggregator stopped")
+
+// CurrentWindow returns a copy of the open window with WindowEnd set to now.
+// The aggregation goroutine only copies the counts between two batches;
+// filtering and encoding are left to the caller.
+func (a *Aggregator) CurrentWindow(ctx context.Context) (sink.Snapshot, error) {
+	reply := make(chan sink.Snapshot, 1)
+
+	select {
+	case a.queries <- reply:
+	case <-a.done:
+		return sink.Snapshot{}, ErrStopped
+	case <-ctx.Done():
+		return sink.Snapshot{}, ctx.Err()
+	}
+
+	return <-reply, nil
+}
+
+// openWindow copies the open window's counters.
+func (a *Aggregator) openWindow(windowStart int64) sink.Snapshot {
+	counts := make(map[string]uint64, len(a.counts))
+	for k, v := range a.counts {
+		counts[k] = v
+	}
+
+	return sink.Snapshot{
+		WindowStart:  windowStart,
+		WindowEnd:    a.nowFn().UnixMilli(),
+		Temporality:  sink.TemporalityDelta,
+		Generation:   a.settings.Load().Generation,
+		AttributeKey: a.settings.Load().AttributeKey,
+		Tenant:       a.tenant,
+		Counts:       counts,
+		Missing:      a.missing,
+		Null:         a.null,
+		Unsupported:  a.unsupported,
+		Labels:       a.labels,
+		Total:        a.total,
+		Dropped:      a.externalDropped.Load(),
+	}
 }
 
-// QueueLen returns the current queue length; can be observed for metrics.
-func (a *Aggregator) QueueLen() int { return len(a.in) }
+// QueueLen returns the number of events and batches waiting in the ingestion
+// queues; can be observed for metrics.
+func (a *Aggregator) QueueLen() int {
+	q := a.queues.Load()
+	return len(q.in) + len(q.inBatch)
+}
+
+// QueueUtilization returns the fraction of the fuller ingestion queue in use.
+// At 1, further events or batches of that kind are dropped. Unbuffered queues
+// (-maxQueue=0) report 0.
+func (a *Aggregator) QueueUtilization() float64 {
+	q := a.queues.Load()
+	if cap(q.in) == 0 {
+		return 0
+	}
+
+	return float64(max(len(q.in), len(q.inBatch))) / float64(cap(q.in))
+}
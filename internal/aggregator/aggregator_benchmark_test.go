@@ -90,7 +90,7 @@ func BenchmarkAggregator_EnqueueBatch_64(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for !a.EnqueueBatch(batch) {
+		for !a.EnqueueBatch(Batch{Values: batch}) {
 			// spin until accepted
 		}
 	}
@@ -115,7 +115,7 @@ func BenchmarkAggregator_EnqueueBatch_64_Parallel(b *testing.B) {
 		}
 
 		for pb.Next() {
-			for !a.EnqueueBatch(batch) {
+			for !a.EnqueueBatch(Batch{Values: batch}) {
 				runtime.Gosched()
 			}
 		}
@@ -141,7 +141,7 @@ func BenchmarkAggregator_EnqueueBatch_1024(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for !a.EnqueueBatch(batch) {
+		for !a.EnqueueBatch(Batch{Values: batch}) {
 			// spin until accepted
 		}
 	}
@@ -166,7 +166,7 @@ func BenchmarkAggregator_EnqueueBatch_1024_Parallel(b *testing.B) {
 		}
 
 		for pb.Next() {
-			for !a.EnqueueBatch(batch) {
+			for !a.EnqueueBatch(Batch{Values: batch}) {
 				runtime.Gosched()
 			}
 		}
@@ -1,8 +1,13 @@
 package aggregator
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -11,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
 )
 
 type fakeSink struct {
@@ -29,6 +35,51 @@ func (f *fakeSink) Publish(_ context.Context, s sink.Snapshot) error {
 	return nil
 }
 
+type failingSink struct {
+	mu      sync.Mutex
+	fails   int
+	calls   int
+	got     []sink.Snapshot
+	targets []string
+}
+
+func (f *failingSink) Publish(_ context.Context, s sink.Snapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls <= f.fails {
+		return errors.New("unavailable")
+	}
+
+	f.got = append(f.got, s)
+
+	return nil
+}
+
+// PublishTarget makes failingSink usable as a dead-letter sink.
+func (f *failingSink) PublishTarget(ctx context.Context, target string, s sink.Snapshot) error {
+	f.mu.Lock()
+	f.targets = append(f.targets, target)
+	f.mu.Unlock()
+
+	return f.Publish(ctx, s)
+}
+
+func (f *failingSink) deadLetterTargets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.targets...)
+}
+
+func (f *failingSink) snapshots() []sink.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]sink.Snapshot(nil), f.got...)
+}
+
 func TestAggregator_FlushesCounts(t *testing.T) {
 	fs := &fakeSink{ch: make(chan struct{}, 1)}
 	a := New(30*time.Millisecond, "foo", fs, slog.Default(), 10)
@@ -52,6 +103,36 @@ func TestAggregator_FlushesCounts(t *testing.T) {
 	assert.EqualValues(t, 1, snap.Counts["baz"])
 }
 
+func TestAggregator_QueueMetrics(t *testing.T) {
+	fs := &fakeSink{ch: make(chan struct{}, 1)}
+	a := New(time.Hour, "foo", fs, slog.Default(), 4)
+
+	// Not started, so nothing is drained.
+	require.True(t, a.Enqueue("a"))
+	require.True(t, a.EnqueueBatch(Batch{Values: []string{"b", "c"}}))
+	require.True(t, a.EnqueueBatch(Batch{Missing: 1}))
+	require.True(t, a.EnqueueBatch(Batch{Null: 1}))
+	require.Equal(t, 4, a.QueueLen())
+	require.InDelta(t, 0.75, a.QueueUtilization(), 1e-9)
+
+	var flushes []time.Duration
+
+	a.SetFlushMetrics(func(d time.Duration) { flushes = append(flushes, d) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	require.Zero(t, a.QueueUtilization())
+
+	cancel()
+	a.Stop(context.Background())
+
+	require.Len(t, flushes, 1)
+	require.EqualValues(t, 5, fs.got.Load().Total)
+
+	require.Zero(t, New(time.Hour, "foo", fs, slog.Default(), 0).QueueUtilization())
+}
+
 func TestAggregator_RecordsDrops(t *testing.T) {
 	fs := &fakeSink{ch: make(chan struct{}, 1)}
 	a := New(20*time.Millisecond, "foo", fs, slog.Default(), 0)
@@ -73,3 +154,379 @@ func TestAggregator_RecordsDrops(t *testing.T) {
 	require.NotNil(t, snap)
 	require.EqualValues(t, 1, snap.Dropped)
 }
+
+func TestAggregator_ReservedBuckets(t *testing.T) {
+	fs := &fakeSink{ch: make(chan struct{}, 1)}
+	a := New(30*time.Millisecond, "foo", fs, slog.Default(), 10)
+	a.SetBucketLabels(sink.BucketLabels{Missing: "n/a", Null: "nil", Unsupported: "?"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	// ensure cancel happens before waiting in Stop
+	defer a.Stop(context.Background())
+	defer cancel()
+
+	require.True(t, a.EnqueueBatch(Batch{Values: []string{"unknown", "bar"}, Missing: 2, Null: 1, Unsupported: 3}))
+
+	require.Eventually(t, func() bool { return fs.got.Load() != nil }, 300*time.Millisecond, 5*time.Millisecond)
+
+	snap := fs.got.Load()
+	require.EqualValues(t, 8, snap.Total)
+	require.EqualValues(t, 2, snap.Missing)
+	require.EqualValues(t, 1, snap.Null)
+	require.EqualValues(t, 3, snap.Unsupported)
+	// A genuine "unknown" value stays in Counts and never mixes with the missing bucket.
+	require.Equal(t, map[string]uint64{"unknown": 1, "bar": 1}, snap.Counts)
+	require.Equal(t, "n/a", snap.Labels.Missing)
+}
+
+func TestAggregator_ResumesWindowFromStateLog(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-5 * time.Millisecond).UnixMilli()
+
+	// A previous process persisted part of a window and crashed.
+	prev, _, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+	require.NoError(t, prev.Checkpoint(wal.State{WindowStart: start}))
+	require.NoError(t, prev.Append(wal.Record{Values: []string{"bar", "bar"}, Missing: 1}))
+
+	l, recovered, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+
+	fs := &fakeSink{ch: make(chan struct{}, 1)}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetStateLog(l, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("baz"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+
+	cancel()
+	a.Stop(context.Background())
+
+	snap := fs.got.Load()
+	require.NotNil(t, snap)
+	require.Equal(t, start, snap.WindowStart)
+	require.Equal(t, map[string]uint64{"bar": 2, "baz": 1}, snap.Counts)
+	require.EqualValues(t, 1, snap.Missing)
+	require.EqualValues(t, 4, snap.Total)
+
+	require.NoError(t, l.Close())
+
+	// The final checkpoint closed the window, so nothing is replayed twice and a
+	// restart opens a new window instead of resuming one started at shutdown.
+	l2, again, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Zero(t, again.Total)
+	require.Zero(t, again.WindowStart)
+}
+
+func TestAggregator_PersistsQueuedBatchesTogether(t *testing.T) {
+	dir := t.TempDir()
+	l, recovered, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+
+	fs := &fakeSink{ch: make(chan struct{}, 1)}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetStateLog(l, recovered)
+
+	// Queued before Start, so the loop finds them together.
+	for i := 0; i < 5; i++ {
+		require.True(t, a.EnqueueBatch(Batch{Values: []string{"bar"}, Missing: 1}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+
+	// The query is served after the batches were appended.
+	_, err = a.CurrentWindow(context.Background())
+	require.NoError(t, err)
+
+	// A copy of the state as it stands, as if the process crashed now.
+	crashed := t.TempDir()
+	for _, name := range []string{"checkpoint.json", "wal.log"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(crashed, name), data, 0o600))
+	}
+
+	cancel()
+	a.Stop(context.Background())
+	require.NoError(t, l.Close())
+
+	log, err := os.ReadFile(filepath.Join(crashed, "wal.log"))
+	require.NoError(t, err)
+	require.Less(t, bytes.Count(log, []byte(`"values"`)), 5)
+
+	l2, again, err := wal.Open(wal.Options{Dir: crashed})
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Equal(t, map[string]uint64{"bar": 5}, again.Counts)
+	require.EqualValues(t, 5, again.Missing)
+	require.EqualValues(t, 10, again.Total)
+}
+
+func TestAggregator_ClosesResumedWindowOnSchedule(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).UnixMilli()
+
+	prev, _, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, prev.Checkpoint(wal.State{WindowStart: start, Counts: map[string]uint64{"bar": 1}, Total: 1}))
+	require.NoError(t, prev.Close())
+
+	l, recovered, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, l.Close()) }()
+
+	fs := &fakeSink{ch: make(chan struct{}, 1)}
+	// The recovered window is long overdue, so it must close right away rather than after a full window.
+	a := New(time.Minute, "foo", fs, slog.Default(), 10)
+	a.SetStateLog(l, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	// ensure cancel happens before waiting in Stop
+	defer a.Stop(context.Background())
+	defer cancel()
+
+	require.Eventually(t, func() bool { return fs.got.Load() != nil }, time.Second, 5*time.Millisecond)
+	require.Equal(t, start, fs.got.Load().WindowStart)
+	require.EqualValues(t, 1, fs.got.Load().Counts["bar"])
+}
+
+func TestAggregator_ClosesRecoveredWindowOfAnotherKey(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Minute).UnixMilli()
+
+	// A previous process was reconfigured to "bar" before it crashed.
+	prev, _, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, prev.Checkpoint(wal.State{AttributeKey: "bar", Generation: 3, WindowStart: start, Counts: map[string]uint64{"x": 2}, Total: 2}))
+	require.NoError(t, prev.Close())
+
+	l, recovered, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.Equal(t, "bar", recovered.AttributeKey)
+	require.EqualValues(t, 3, recovered.Generation)
+
+	fs := &failingSink{}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetStateLog(l, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("y"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, a.Stop(context.Background()))
+	require.NoError(t, l.Close())
+
+	// The recovered window is published under its own key, not merged.
+	got := fs.snapshots()
+	require.Len(t, got, 2)
+	require.Equal(t, "bar", got[0].AttributeKey)
+	require.EqualValues(t, 3, got[0].Generation)
+	require.Equal(t, start, got[0].WindowStart)
+	require.Equal(t, map[string]uint64{"x": 2}, got[0].Counts)
+	require.Equal(t, "foo", got[1].AttributeKey)
+	require.Greater(t, got[1].WindowStart, start)
+	require.Equal(t, map[string]uint64{"y": 1}, got[1].Counts)
+
+	// Later checkpoints carry the current settings.
+	l2, again, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Equal(t, "foo", again.AttributeKey)
+	require.EqualValues(t, 1, again.Generation)
+}
+
+func TestAggregator_RetriesFailedPublish(t *testing.T) {
+	fs := &failingSink{fails: 2}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetRetryPolicy(sink.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	var flushes, failed atomic.Int64
+
+	a.SetMetricsCallbacks(func(n int64) { flushes.Add(n) }, func(n int64) { failed.Add(n) })
+	require.NoError(t, a.AddSink("extra", &failingSink{}, SinkOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("bar"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	a.Stop(context.Background())
+
+	got := fs.snapshots()
+	require.Len(t, got, 1)
+	require.EqualValues(t, 1, got[0].Counts["bar"])
+	// One closed window, however many sinks received it.
+	require.EqualValues(t, 1, flushes.Load())
+	require.Zero(t, failed.Load())
+}
+
+func TestAggregator_DeadLettersExhaustedSnapshots(t *testing.T) {
+	fs := &failingSink{fails: 1 << 30}
+	dl := &failingSink{}
+
+	times := []time.Time{time.UnixMilli(1000), time.UnixMilli(2000), time.UnixMilli(3000)}
+
+	var tick atomic.Int32
+
+	a := New(20*time.Millisecond, "foo", fs, slog.Default(), 10)
+	a.nowFn = func() time.Time { return times[min(int(tick.Add(1))-1, len(times)-1)] }
+	a.SetRetryPolicy(sink.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	a.SetDeadLetter(dl)
+
+	var failed atomic.Int64
+
+	a.SetMetricsCallbacks(nil, func(n int64) { failed.Add(n) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("first"))
+	require.Eventually(t, func() bool { return len(dl.snapshots()) == 1 }, time.Second, time.Millisecond)
+	require.True(t, a.Enqueue("second"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	a.Stop(context.Background())
+
+	// Each window is dead-lettered with its own bounds instead of being merged into the next.
+	got := dl.snapshots()
+	require.Len(t, got, 2)
+	require.Equal(t, map[string]uint64{"first": 1}, got[0].Counts)
+	require.EqualValues(t, 1000, got[0].WindowStart)
+	require.EqualValues(t, 2000, got[0].WindowEnd)
+	require.Equal(t, map[string]uint64{"second": 1}, got[1].Counts)
+	require.GreaterOrEqual(t, got[1].WindowStart, got[0].WindowEnd)
+	require.EqualValues(t, 2, failed.Load())
+}
+
+func TestAggregator_EmitsDeltaAndCumulative(t *testing.T) {
+	fs := &failingSink{}
+	a := New(20*time.Millisecond, "foo", fs, slog.Default(), 10)
+	a.SetTemporalities([]sink.Temporality{sink.TemporalityDelta, sink.TemporalityCumulative})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("a"))
+	require.Eventually(t, func() bool { return len(fs.snapshots()) >= 2 }, time.Second, time.Millisecond)
+	require.True(t, a.Enqueue("a"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	a.Stop(context.Background())
+
+	var delta, cum []sink.Snapshot
+
+	for _, s := range fs.snapshots() {
+		switch s.Temporality {
+		case sink.TemporalityDelta:
+			delta = append(delta, s)
+		case sink.TemporalityCumulative:
+			cum = append(cum, s)
+		}
+	}
+
+	require.Len(t, delta, 2)
+	require.GreaterOrEqual(t, len(cum), 2)
+	require.EqualValues(t, 1, delta[0].Total)
+	require.EqualValues(t, 1, delta[1].Total)
+
+	last := cum[len(cum)-1]
+	require.EqualValues(t, 2, last.Total)
+	require.Equal(t, map[string]uint64{"a": 2}, last.Counts)
+	require.Equal(t, delta[0].WindowStart, last.StartTime)
+}
+
+func TestAggregator_PublishesRollupsToTheirOwnSink(t *testing.T) {
+	fs := &failingSink{}
+	rs := &failingSink{}
+
+	a := New(10*time.Millisecond, "foo", fs, slog.Default(), 10)
+	require.NoError(t, a.AddRollup(time.Hour, rs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("a"))
+	require.Eventually(t, func() bool { return len(fs.snapshots()) == 1 }, time.Second, time.Millisecond)
+	require.True(t, a.Enqueue("a"))
+	require.Eventually(t, func() bool { return len(fs.snapshots()) == 2 }, time.Second, time.Millisecond)
+	require.Empty(t, rs.snapshots(), "the hourly bucket is still open")
+
+	// Without durable state the open bucket is emitted on shutdown.
+	cancel()
+	a.Stop(context.Background())
+
+	got := rs.snapshots()
+	require.Len(t, got, 1)
+	require.Equal(t, map[string]uint64{"a": 2}, got[0].Counts)
+	require.Equal(t, fs.snapshots()[0].WindowStart, got[0].WindowStart)
+}
+
+func TestAggregator_ObserversSeeEveryWindow(t *testing.T) {
+	a := New(5*time.Millisecond, "foo", &failingSink{}, slog.Default(), 10)
+
+	var (
+		mu   sync.Mutex
+		seen []sink.Snapshot
+	)
+
+	a.AddWindowObserver(func(s sink.Snapshot) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen = append(seen, s)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("a"))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(seen) >= 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	a.Stop(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.EqualValues(t, 1, seen[0].Total)
+	require.Zero(t, seen[1].Total, "empty windows are observed too")
+	require.Equal(t, seen[0].WindowEnd, seen[1].WindowStart)
+}
+
+func TestAggregator_CurrentWindow(t *testing.T) {
+	a := New(time.Hour, "foo", &failingSink{}, slog.Default(), 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.EnqueueBatch(Batch{Values: []string{"a", "a", "b"}, Missing: 1}))
+	require.Eventually(t, func() bool { return len(a.queues.Load().inBatch) == 0 }, time.Second, time.Millisecond)
+
+	snap, err := a.CurrentWindow(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{"a": 2, "b": 1}, snap.Counts)
+	require.EqualValues(t, 1, snap.Missing)
+	require.EqualValues(t, 4, snap.Total)
+	require.GreaterOrEqual(t, snap.WindowEnd, snap.WindowStart)
+
+	// The copy is detached from the live window.
+	snap.Counts["a"] = 100
+	again, err := a.CurrentWindow(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, 2, again.Counts["a"])
+
+	cancel()
+	a.Stop(context.Background())
+
+	_, err = a.CurrentWindow(context.Background())
+	require.ErrorIs(t, err, ErrStopped)
+}
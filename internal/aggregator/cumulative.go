@@ -0,0 +1,68 @@
+package aggregator
+
+import "dash0.com/otlp-log-processor-backend/internal/sink"
+
+// cumulative holds the running totals of every closed window since start.
+// It is owned by the aggregation goroutine.
+type cumulative struct {
+	start       int64
+	counts      map[string]uint64
+	missing     uint64
+	null        uint64
+	unsupported uint64
+	total       uint64
+	dropped     uint64
+}
+
+// SetTemporalities selects the views emitted for each closed window, in order.
+// Must be called before Start.
+func (a *Aggregator) SetTemporalities(ts []sink.Temporality) { a.temporalities = ts }
+
+// ResetCumulative restarts the cumulative series. It takes effect when the
+// current window closes: that window becomes the first of the new series.
+// Safe for concurrent use.
+func (a *Aggregator) ResetCumulative() { a.resetCum.Store(true) }
+
+// cumulate folds a closed delta window into the running totals and returns the
+// cumulative view, or false while the series has nothing to report.
+func (a *Aggregator) cumulate(delta sink.Snapshot) (sink.Snapshot, bool) {
+	if a.resetCum.Swap(false) || a.cum.counts == nil {
+		a.cum = cumulative{start: delta.WindowStart, counts: make(map[string]uint64, len(delta.Counts))}
+	}
+
+	for k, v := range delta.Counts {
+		a.cum.counts[k] += v
+	}
+
+	a.cum.missing += delta.Missing
+	a.cum.null += delta.Null
+	a.cum.unsupported += delta.Unsupported
+	a.cum.total += delta.Total
+	a.cum.dropped += delta.Dropped
+
+	if a.cum.total == 0 && a.cum.dropped == 0 {
+		return sink.Snapshot{}, false
+	}
+
+	counts := make(map[string]uint64, len(a.cum.counts))
+	for k, v := range a.cum.counts {
+		counts[k] = v
+	}
+
+	return sink.Snapshot{
+		WindowStart:  delta.WindowStart,
+		WindowEnd:    delta.WindowEnd,
+		Temporality:  sink.TemporalityCumulative,
+		Generation:   delta.Generation,
+		StartTime:    a.cum.start,
+		AttributeKey: delta.AttributeKey,
+		Tenant:       delta.Tenant,
+		Counts:       counts,
+		Missing:      a.cum.missing,
+		Null:         a.cum.null,
+		Unsupported:  a.cum.unsupported,
+		Labels:       delta.Labels,
+		Total:        a.cum.total,
+		Dropped:      a.cum.dropped,
+	}, true
+}
@@ -0,0 +1,53 @@
+package aggregator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestCumulate_AccumulatesAcrossWindows(t *testing.T) {
+	a := New(0, "foo", nil, nil, 0)
+
+	_, ok := a.cumulate(sink.Snapshot{WindowStart: 0, WindowEnd: 10})
+	require.False(t, ok, "nothing to report before the first record")
+
+	got, ok := a.cumulate(sink.Snapshot{WindowStart: 10, WindowEnd: 20, Counts: map[string]uint64{"a": 2}, Missing: 1, Total: 3})
+	require.True(t, ok)
+	require.EqualValues(t, 0, got.StartTime)
+
+	got, ok = a.cumulate(sink.Snapshot{WindowStart: 20, WindowEnd: 30, Counts: map[string]uint64{"a": 1, "b": 1}, Total: 2, Dropped: 4})
+	require.True(t, ok)
+	require.Equal(t, sink.TemporalityCumulative, got.Temporality)
+	require.EqualValues(t, 20, got.WindowStart)
+	require.EqualValues(t, 30, got.WindowEnd)
+	require.Equal(t, map[string]uint64{"a": 3, "b": 1}, got.Counts)
+	require.EqualValues(t, 1, got.Missing)
+	require.EqualValues(t, 5, got.Total)
+	require.EqualValues(t, 4, got.Dropped)
+
+	// An empty window still reports the running totals.
+	got, ok = a.cumulate(sink.Snapshot{WindowStart: 30, WindowEnd: 40})
+	require.True(t, ok)
+	require.EqualValues(t, 5, got.Total)
+
+	// Later windows must not alias an emitted snapshot's counts.
+	got.Counts["a"] = 100
+	got, _ = a.cumulate(sink.Snapshot{WindowStart: 40, WindowEnd: 50})
+	require.EqualValues(t, 3, got.Counts["a"])
+}
+
+func TestCumulate_Reset(t *testing.T) {
+	a := New(0, "foo", nil, nil, 0)
+	_, _ = a.cumulate(sink.Snapshot{WindowStart: 0, WindowEnd: 10, Counts: map[string]uint64{"a": 5}, Total: 5})
+
+	a.ResetCumulative()
+
+	got, ok := a.cumulate(sink.Snapshot{WindowStart: 10, WindowEnd: 20, Counts: map[string]uint64{"b": 1}, Total: 1})
+	require.True(t, ok)
+	require.EqualValues(t, 10, got.StartTime)
+	require.Equal(t, map[string]uint64{"b": 1}, got.Counts)
+	require.EqualValues(t, 1, got.Total)
+}
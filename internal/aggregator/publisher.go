@@ -0,0 +1,492 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
+)
+
+// DefaultPublishQueue is the number of closed snapshots that may await delivery.
+const DefaultPublishQueue = 64
+
+// PrimarySink names the primary sink in sink statuses and delivery callbacks.
+const PrimarySink = "primary"
+
+// errQueueFull is recorded against a sink whose queue had no room for a snapshot.
+var errQueueFull = errors.New("publish queue full")
+
+// pendingSnapshot is a closed window waiting for delivery to target; id keys
+// it in the pending set so it can be checkpointed until delivered.
+type pendingSnapshot struct {
+	id     uint64
+	target string
+	snap   sink.Snapshot
+}
+
+// SinkOptions configure delivery to an added sink.
+type SinkOptions struct {
+	// QueueSize is the number of snapshots that may await delivery; 0 means
+	// DefaultPublishQueue.
+	QueueSize int
+	// Workers deliver concurrently; 0 means 1, which keeps window order.
+	Workers int
+	// Retry replaces the aggregator's retry policy when MaxAttempts is set.
+	Retry sink.RetryPolicy
+}
+
+// lane is the delivery path of an added sink. Its own queue, workers and retry
+// policy mean a slow or failing sink backs up only its own lane.
+type lane struct {
+	name   string
+	target string
+	sink   sink.Sink
+	opts   SinkOptions
+	queue  chan pendingSnapshot
+}
+
+// SinkStatus is the delivery health of one sink. A sink turns unhealthy when a
+// snapshot could not be delivered to it and healthy again on the next success.
+type SinkStatus struct {
+	Name                string
+	Healthy             bool
+	ConsecutiveFailures int
+	Delivered           uint64
+	Failed              uint64
+	LastError           string
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	// QueueLen and QueueCap describe the sink's publish queue. Rollup tiers
+	// share the primary sink's queue and report none of their own.
+	QueueLen int
+	QueueCap int
+}
+
+// AddSink registers s to receive every snapshot the primary sink receives.
+// Each copy goes through a queue, workers and retries of its own and is
+// dead-lettered on its own, so a failing sink delays neither the primary nor
+// the others. Must be called before Start.
+func (a *Aggregator) AddSink(name string, s sink.Sink, opts SinkOptions) error {
+	target := "sink/" + name
+	if _, ok := a.targetSink(target); ok || name == PrimarySink {
+		return fmt.Errorf("duplicate sink %q", name)
+	}
+
+	size := opts.QueueSize
+	if size <= 0 {
+		size = DefaultPublishQueue
+	}
+
+	a.extra = append(a.extra, &lane{name: name, target: target, sink: s, opts: opts, queue: make(chan pendingSnapshot, size)})
+
+	return nil
+}
+
+// SetDeliveryCallback installs an optional callback observing the outcome of
+// every snapshot delivery by sink name: nil once delivered, otherwise the error
+// after which it was dead-lettered.
+func (a *Aggregator) SetDeliveryCallback(fn func(sink string, err error)) { a.onDelivery = fn }
+
+// SetPublishQueue configures asynchronous delivery: up to size closed
+// snapshots wait for one of workers goroutines. With more than one worker the
+// sink may receive snapshots out of window order. Must be called before Start.
+func (a *Aggregator) SetPublishQueue(size, workers int) {
+	a.pubQueue = make(chan pendingSnapshot, max(size, 0))
+	a.pubWorkers = max(workers, 1)
+}
+
+// PublishQueueLen returns the number of snapshots waiting for delivery to the
+// primary sink and the rollup tiers.
+func (a *Aggregator) PublishQueueLen() int { return len(a.pubQueue) }
+
+// PublishQueueCap returns the capacity of the primary publish queue.
+func (a *Aggregator) PublishQueueCap() int { return cap(a.pubQueue) }
+
+func (a *Aggregator) startPublishers() {
+	a.startWorkers(a.pubQueue, a.pubWorkers)
+
+	for _, l := range a.extra {
+		a.startWorkers(l.queue, max(l.opts.Workers, 1))
+	}
+
+	go func() {
+		defer close(a.dlDone)
+
+		for p := range a.dlQueue {
+			a.deadLetterSnapshot(p.target, p.snap)
+			a.untrack(p.id)
+		}
+	}()
+
+	// Snapshots recovered from durable state go first, in their original order.
+	// Blocking is fine here: the workers are already draining the queues.
+	for _, p := range a.recovered {
+		a.queueFor(p.Target) <- a.track(p.Target, p.Snapshot)
+	}
+
+	a.recovered = nil
+}
+
+func (a *Aggregator) startWorkers(queue chan pendingSnapshot, workers int) {
+	for range workers {
+		a.pubWG.Add(1)
+
+		go func() {
+			defer a.pubWG.Done()
+
+			for p := range queue {
+				a.deliver(p)
+			}
+		}()
+	}
+}
+
+// stopPublishers closes the queues and waits for queued snapshots to be
+// delivered or dead-lettered.
+func (a *Aggregator) stopPublishers() {
+	close(a.pubQueue)
+
+	for _, l := range a.extra {
+		close(l.queue)
+	}
+
+	a.pubWG.Wait()
+	close(a.dlQueue)
+	<-a.dlDone
+}
+
+// queueFor returns the publish queue of target.
+func (a *Aggregator) queueFor(target string) chan pendingSnapshot {
+	if l := a.lane(target); l != nil {
+		return l.queue
+	}
+
+	return a.pubQueue
+}
+
+func (a *Aggregator) lane(target string) *lane {
+	for _, l := range a.extra {
+		if l.target == target {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// enqueuePublish hands snap to the publish workers without blocking the
+// aggregation loop. If the queue is full the snapshot goes to the dead-letter
+// goroutine instead, and is discarded if that is backed up too. target names
+// the destination sink; the empty target is the primary sink.
+func (a *Aggregator) enqueuePublish(target string, snap sink.Snapshot) {
+	p := a.track(target, snap)
+	queue := a.queueFor(target)
+
+	select {
+	case queue <- p:
+		return
+	default:
+	}
+
+	a.logger.Error(
+		"publish queue full; skipping delivery",
+		slog.Int("publish_queue_cap", cap(queue)),
+		slog.String("target", target),
+		slog.Int64("window_start", snap.WindowStart),
+		slog.Int64("window_end", snap.WindowEnd),
+	)
+
+	if a.incrPublishFailed != nil {
+		a.incrPublishFailed(1)
+	}
+
+	a.recordDelivery(target, errQueueFull)
+
+	// It stays pending, and so checkpointed, until it is written.
+	select {
+	case a.dlQueue <- p:
+	default:
+		a.logger.Error(
+			"dead-letter queue full; snapshot discarded",
+			slog.String("target", target),
+			slog.Int64("window_start", snap.WindowStart),
+			slog.Int64("window_end", snap.WindowEnd),
+		)
+		a.untrack(p.id)
+	}
+}
+
+// publishPrimary queues snap for the primary sink and every added sink.
+func (a *Aggregator) publishPrimary(snap sink.Snapshot) {
+	a.enqueuePublish("", snap)
+
+	for _, e := range a.extra {
+		a.enqueuePublish(e.target, snap)
+	}
+}
+
+// deliver publishes one snapshot with the configured retry policy and hands it
+// to the dead-letter sink once attempts are exhausted. A delivery cancelled by
+// Stop stays pending when there is durable state to carry it to the next start.
+func (a *Aggregator) deliver(p pendingSnapshot) {
+	keep := false
+
+	defer func() {
+		if !keep {
+			a.untrack(p.id)
+		}
+	}()
+
+	snap := p.snap
+
+	dst, ok := a.targetSink(p.target)
+	if !ok {
+		a.logger.Error("no sink for recovered snapshot target", slog.String("target", p.target))
+		a.deadLetterSnapshot(p.target, snap)
+
+		return
+	}
+
+	policy := a.retryFor(p.target)
+
+	start := time.Now()
+
+	err := sink.PublishWithRetry(a.pubCtx, dst, snap, policy, func(retry int, err error) {
+		a.logger.Warn(
+			"retrying snapshot publish",
+			slog.String("err", err.Error()),
+			slog.String("target", p.target),
+			slog.Int("retry", retry),
+			slog.Int64("window_start", snap.WindowStart),
+			slog.Int64("window_end", snap.WindowEnd),
+		)
+	})
+
+	if a.recordPublish != nil {
+		a.recordPublish(sinkName(p.target), time.Since(start))
+	}
+
+	a.recordDelivery(p.target, err)
+
+	if err == nil {
+		return
+	}
+
+	if a.pubCtx.Err() != nil && a.state != nil {
+		keep = true
+
+		a.logger.Warn(
+			"snapshot delivery cancelled by shutdown; kept in durable state",
+			slog.String("target", p.target),
+			slog.Int64("window_start", snap.WindowStart),
+			slog.Int64("window_end", snap.WindowEnd),
+		)
+
+		return
+	}
+
+	a.logger.Error(
+		"failed to publish snapshot",
+		slog.String("err", err.Error()),
+		slog.String("attribute_key", snap.AttributeKey),
+		slog.Int64("window_start", snap.WindowStart),
+		slog.Int64("window_end", snap.WindowEnd),
+		slog.Any("total", snap.Total),
+		slog.Any("dropped", snap.Dropped),
+		slog.Int("attempts", max(policy.MaxAttempts, 1)),
+		slog.String("target", p.target),
+		slog.String("sink", fmt.Sprintf("%T", dst)),
+	)
+
+	if a.incrPublishFailed != nil {
+		a.incrPublishFailed(1)
+	}
+
+	a.deadLetterSnapshot(p.target, snap)
+}
+
+// Redeliver publishes a dead-lettered snapshot to the sink behind target, with
+// that sink's retry policy. It needs no Start, so that a dead-letter file can
+// be replayed without running the pipeline.
+func (a *Aggregator) Redeliver(ctx context.Context, target string, snap sink.Snapshot) error {
+	dst, ok := a.targetSink(target)
+	if !ok {
+		return fmt.Errorf("no sink for target %q", target)
+	}
+
+	return sink.PublishWithRetry(ctx, dst, snap, a.retryFor(target), nil)
+}
+
+// retryFor returns the retry policy of the sink behind target.
+func (a *Aggregator) retryFor(target string) sink.RetryPolicy {
+	if l := a.lane(target); l != nil && l.opts.Retry.MaxAttempts > 0 {
+		return l.opts.Retry
+	}
+
+	return a.retry
+}
+
+func (a *Aggregator) deadLetterSnapshot(target string, snap sink.Snapshot) {
+	if a.deadLetter == nil {
+		a.logger.Error("snapshot discarded; no dead-letter sink configured", slog.Int64("window_start", snap.WindowStart))
+		return
+	}
+
+	if err := a.deadLetter.PublishTarget(a.pubCtx, target, snap); err != nil {
+		a.logger.Error(
+			"failed to dead-letter snapshot; snapshot discarded",
+			slog.String("err", err.Error()),
+			slog.Int64("window_start", snap.WindowStart),
+			slog.Int64("window_end", snap.WindowEnd),
+		)
+	}
+}
+
+// targetSink returns the sink behind a delivery target.
+func (a *Aggregator) targetSink(target string) (sink.Sink, bool) {
+	if target == "" {
+		return a.sink, true
+	}
+
+	if l := a.lane(target); l != nil {
+		return l.sink, true
+	}
+
+	for _, t := range a.tiers {
+		if t.name == target {
+			return t.sink, true
+		}
+	}
+
+	return nil, false
+}
+
+// sinkName returns the name a target's sink is reported under.
+func sinkName(target string) string {
+	if target == "" {
+		return PrimarySink
+	}
+
+	return strings.TrimPrefix(target, "sink/")
+}
+
+// recordDelivery updates the health of target's sink with the outcome of one
+// delivery and logs when the sink turns unhealthy or recovers.
+func (a *Aggregator) recordDelivery(target string, err error) {
+	name := sinkName(target)
+	now := a.nowFn()
+
+	a.healthMu.Lock()
+
+	h, ok := a.health[name]
+	if !ok {
+		h = &SinkStatus{Name: name}
+		a.health[name] = h
+	}
+
+	wasHealthy := h.ConsecutiveFailures == 0
+
+	if err == nil {
+		h.Delivered++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+	} else {
+		h.Failed++
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+		h.LastFailure = now
+	}
+
+	a.healthMu.Unlock()
+
+	switch {
+	case err != nil && wasHealthy:
+		a.logger.Warn("sink unhealthy", slog.String("sink", name), slog.String("err", err.Error()))
+	case err == nil && !wasHealthy:
+		a.logger.Info("sink recovered", slog.String("sink", name))
+	}
+
+	if a.onDelivery != nil {
+		a.onDelivery(name, err)
+	}
+}
+
+// SinkStatuses returns the delivery health of the primary sink, the rollup
+// tiers and the added sinks, in that order.
+func (a *Aggregator) SinkStatuses() []SinkStatus {
+	type entry struct {
+		target string
+		queue  chan pendingSnapshot
+	}
+
+	entries := []entry{{target: "", queue: a.pubQueue}}
+	for _, t := range a.tiers {
+		entries = append(entries, entry{target: t.name})
+	}
+
+	for _, l := range a.extra {
+		entries = append(entries, entry{target: l.target, queue: l.queue})
+	}
+
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	out := make([]SinkStatus, 0, len(entries))
+
+	for _, e := range entries {
+		st := SinkStatus{Name: sinkName(e.target)}
+		if h, ok := a.health[st.Name]; ok {
+			st = *h
+		}
+
+		st.Healthy = st.ConsecutiveFailures == 0
+		st.QueueLen, st.QueueCap = len(e.queue), cap(e.queue)
+		out = append(out, st)
+	}
+
+	return out
+}
+
+func (a *Aggregator) track(target string, snap sink.Snapshot) pendingSnapshot {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	a.pendingSeq++
+	a.pending[a.pendingSeq] = wal.Pending{Target: target, Snapshot: snap}
+
+	return pendingSnapshot{id: a.pendingSeq, target: target, snap: snap}
+}
+
+func (a *Aggregator) untrack(id uint64) {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	delete(a.pending, id)
+}
+
+// pendingSnapshots returns the snapshots closed but not yet delivered or
+// dead-lettered, oldest first.
+func (a *Aggregator) pendingSnapshots() []wal.Pending {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	ids := make([]uint64, 0, len(a.pending))
+	for id := range a.pending {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	out := make([]wal.Pending, len(ids))
+	for i, id := range ids {
+		out[i] = a.pending[id]
+	}
+
+	return out
+}
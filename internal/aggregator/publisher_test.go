@@ -0,0 +1,328 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
+)
+
+// blockingSink holds every publish until release is closed.
+type blockingSink struct {
+	failingSink
+	release chan struct{}
+}
+
+func (b *blockingSink) Publish(ctx context.Context, s sink.Snapshot) error {
+	<-b.release
+	return b.failingSink.Publish(ctx, s)
+}
+
+func (b *blockingSink) PublishTarget(ctx context.Context, target string, s sink.Snapshot) error {
+	<-b.release
+	return b.failingSink.PublishTarget(ctx, target, s)
+}
+
+func TestAggregator_SlowSinkDoesNotBlockIngestion(t *testing.T) {
+	bs := &blockingSink{release: make(chan struct{})}
+	a := New(10*time.Millisecond, "foo", bs, slog.Default(), 10)
+
+	var latencies []time.Duration
+
+	a.SetPublishMetrics(func(name string, d time.Duration) {
+		require.Equal(t, PrimarySink, name)
+
+		latencies = append(latencies, d)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	// Windows keep closing and ingestion keeps draining while the sink is stuck.
+	for _, v := range []string{"a", "b", "c"} {
+		require.True(t, a.Enqueue(v))
+		require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	require.Eventually(t, func() bool { return a.PublishQueueLen() >= 1 }, time.Second, time.Millisecond)
+	require.Empty(t, bs.snapshots())
+
+	close(bs.release)
+	cancel()
+	a.Stop(context.Background())
+
+	// Every window is delivered once the sink recovers.
+	total := uint64(0)
+	for _, s := range bs.snapshots() {
+		total += s.Total
+	}
+
+	require.EqualValues(t, 3, total)
+	require.Len(t, latencies, len(bs.snapshots()))
+}
+
+func TestAggregator_FullPublishQueueDeadLetters(t *testing.T) {
+	bs := &blockingSink{release: make(chan struct{})}
+	dl := &failingSink{}
+
+	a := New(10*time.Millisecond, "foo", bs, slog.Default(), 10)
+	a.SetPublishQueue(0, 1)
+	a.SetDeadLetter(dl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	// The only worker is stuck on the first window, so the next one overflows.
+	require.True(t, a.Enqueue("first"))
+	require.Eventually(t, func() bool { return len(a.pendingSnapshots()) == 1 }, time.Second, time.Millisecond)
+	require.True(t, a.Enqueue("second"))
+	require.Eventually(t, func() bool { return len(dl.snapshots()) == 1 }, time.Second, time.Millisecond)
+
+	close(bs.release)
+	cancel()
+	a.Stop(context.Background())
+
+	require.Equal(t, map[string]uint64{"second": 1}, dl.snapshots()[0].Counts)
+	require.Equal(t, map[string]uint64{"first": 1}, bs.snapshots()[0].Counts)
+}
+
+func TestAggregator_DeadLetterKeepsTarget(t *testing.T) {
+	fs := &failingSink{}
+	extra := &failingSink{fails: 1 << 30}
+	dl := &failingSink{}
+
+	a := New(10*time.Millisecond, "foo", fs, slog.Default(), 10)
+	a.SetRetryPolicy(sink.RetryPolicy{MaxAttempts: 1})
+	a.SetDeadLetter(dl)
+	require.NoError(t, a.AddSink("extra", extra, SinkOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("x"))
+	require.Eventually(t, func() bool { return len(dl.snapshots()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, a.Stop(context.Background()))
+
+	// Only the failed sink's copy is dead-lettered, and redelivering it reaches
+	// that sink alone.
+	require.Equal(t, []string{"sink/extra"}, dl.deadLetterTargets())
+
+	extra.mu.Lock()
+	extra.fails = 0
+	extra.mu.Unlock()
+
+	require.NoError(t, a.Redeliver(context.Background(), "sink/extra", dl.snapshots()[0]))
+	require.Len(t, extra.snapshots(), 1)
+	require.Equal(t, map[string]uint64{"x": 1}, extra.snapshots()[0].Counts)
+	require.Len(t, fs.snapshots(), 1)
+
+	require.ErrorContains(t, a.Redeliver(context.Background(), "sink/gone", dl.snapshots()[0]), "no sink")
+}
+
+func TestAggregator_SlowDeadLetterDoesNotBlockLoop(t *testing.T) {
+	bs := &blockingSink{release: make(chan struct{})}
+	dl := &blockingSink{release: make(chan struct{})}
+
+	a := New(10*time.Millisecond, "foo", bs, slog.Default(), 10)
+	a.SetPublishQueue(0, 1)
+	a.SetDeadLetter(dl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	require.True(t, a.Enqueue("first"))
+	require.Eventually(t, func() bool { return len(a.pendingSnapshots()) == 1 }, time.Second, time.Millisecond)
+
+	// Overflowing windows wait for the stuck dead-letter sink off the loop,
+	// which keeps ingesting and answering queries.
+	for _, v := range []string{"second", "third"} {
+		require.True(t, a.Enqueue(v))
+		require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	_, err := a.CurrentWindow(context.Background())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(a.pendingSnapshots()), 3, "dead-letters stay pending until written")
+
+	close(dl.release)
+	close(bs.release)
+	cancel()
+	require.NoError(t, a.Stop(context.Background()))
+
+	var values []string
+	for _, s := range dl.snapshots() {
+		for v := range s.Counts {
+			values = append(values, v)
+		}
+	}
+
+	require.ElementsMatch(t, []string{"second", "third"}, values)
+	require.Empty(t, a.pendingSnapshots())
+}
+
+func TestAggregator_RepublishesPendingSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	pending := sink.Snapshot{WindowStart: 1000, WindowEnd: 2000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}
+
+	// A previous process closed a window but crashed before delivering it.
+	prev, _, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+	require.NoError(t, prev.Checkpoint(wal.State{WindowStart: 2000, Pending: []wal.Pending{{Snapshot: pending}}}))
+	require.NoError(t, prev.Close())
+
+	l, recovered, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+
+	fs := &failingSink{}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetStateLog(l, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.Eventually(t, func() bool { return len(fs.snapshots()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	a.Stop(context.Background())
+	require.NoError(t, l.Close())
+
+	require.Equal(t, pending, fs.snapshots()[0])
+
+	// Once delivered, the snapshot is no longer pending.
+	l2, again, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Empty(t, again.Pending)
+}
+
+// hangingSink holds every publish until its context is done.
+type hangingSink struct{}
+
+func (hangingSink) Publish(ctx context.Context, _ sink.Snapshot) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAggregator_StopDeadlineCancelsDelivery(t *testing.T) {
+	dir := t.TempDir()
+
+	l, recovered, err := wal.Open(wal.Options{Dir: dir, Fsync: wal.FsyncAlways})
+	require.NoError(t, err)
+
+	a := New(time.Hour, "foo", hangingSink{}, slog.Default(), 10)
+	a.SetRetryPolicy(sink.RetryPolicy{MaxAttempts: 1})
+	a.SetStateLog(l, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	require.True(t, a.Enqueue("v"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+	cancel()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stopCancel()
+
+	require.ErrorIs(t, a.Stop(stopCtx), context.DeadlineExceeded)
+	// Stop returned only after the workers exited, so closing is safe.
+	require.NoError(t, l.Close())
+
+	// The cancelled delivery stays pending for the next start.
+	l2, again, err := wal.Open(wal.Options{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Len(t, again.Pending, 1)
+	require.Equal(t, map[string]uint64{"v": 1}, again.Pending[0].Snapshot.Counts)
+}
+
+func TestAggregator_AddSinkIsolatesDelivery(t *testing.T) {
+	stuck := &blockingSink{release: make(chan struct{})}
+	extra := &failingSink{}
+
+	a := New(10*time.Millisecond, "foo", stuck, slog.Default(), 10)
+	a.SetPublishQueue(8, 2)
+	a.SetTenant("eu-1")
+	require.NoError(t, a.AddSink("extra", extra, SinkOptions{}))
+	require.Error(t, a.AddSink("extra", extra, SinkOptions{}))
+	require.Error(t, a.AddSink(PrimarySink, extra, SinkOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	// The added sink keeps receiving while the primary is stuck.
+	require.True(t, a.Enqueue("v"))
+	require.Eventually(t, func() bool { return len(extra.snapshots()) == 1 }, time.Second, time.Millisecond)
+	require.Empty(t, stuck.snapshots())
+	require.Equal(t, "eu-1", extra.snapshots()[0].Tenant)
+
+	close(stuck.release)
+	cancel()
+	a.Stop(context.Background())
+
+	require.Equal(t, extra.snapshots(), stuck.snapshots())
+}
+
+func TestAggregator_AddedSinkOwnQueueAndHealth(t *testing.T) {
+	stuck := &blockingSink{release: make(chan struct{})}
+	flaky := &failingSink{fails: 1}
+	primary := &failingSink{}
+
+	a := New(10*time.Millisecond, "foo", primary, slog.Default(), 10)
+	a.SetRetryPolicy(sink.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	require.NoError(t, a.AddSink("stuck", stuck, SinkOptions{QueueSize: 1}))
+	// A single attempt turns the first publish into a failure.
+	require.NoError(t, a.AddSink("flaky", flaky, SinkOptions{Retry: sink.RetryPolicy{MaxAttempts: 1}}))
+
+	var (
+		mu       sync.Mutex
+		outcomes = map[string][]bool{}
+	)
+
+	a.SetDeliveryCallback(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		outcomes[name] = append(outcomes[name], err == nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	// The stuck sink holds one snapshot and queues one more; the rest overflow
+	// its queue only, while the others keep receiving.
+	for _, v := range []string{"a", "b", "c", "d"} {
+		require.True(t, a.Enqueue(v))
+		n := len(primary.snapshots())
+		require.Eventually(t, func() bool { return len(primary.snapshots()) > n }, time.Second, time.Millisecond)
+	}
+
+	require.Eventually(t, func() bool { return len(flaky.snapshots()) >= 3 }, time.Second, time.Millisecond)
+
+	byName := map[string]SinkStatus{}
+	for _, st := range a.SinkStatuses() {
+		byName[st.Name] = st
+	}
+
+	require.True(t, byName[PrimarySink].Healthy)
+	require.True(t, byName["flaky"].Healthy)
+	require.EqualValues(t, 1, byName["flaky"].Failed)
+	require.Equal(t, "unavailable", byName["flaky"].LastError)
+	require.False(t, byName["stuck"].Healthy)
+	require.Equal(t, 1, byName["stuck"].QueueCap)
+	require.Equal(t, errQueueFull.Error(), byName["stuck"].LastError)
+
+	close(stuck.release)
+	cancel()
+	a.Stop(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, []bool{false, true, true, true}, outcomes["flaky"][:4])
+	require.NotContains(t, outcomes[PrimarySink], false)
+}
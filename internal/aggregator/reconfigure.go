@@ -0,0 +1,198 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Settings are the aggregation parameters that can change at runtime. Every
+// applied change starts a new generation, recorded on each snapshot.
+type Settings struct {
+	Generation   uint64
+	AttributeKey string
+	Window       time.Duration
+	MaxQueue     int
+	Filter       ValueFilter
+}
+
+// ValueFilter selects the attribute values that are counted. A value is kept
+// if it starts with one of Include (or Include is empty) and with none of
+// Exclude. Records in the reserved buckets are always counted.
+type ValueFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Allows reports whether v is counted.
+func (f ValueFilter) Allows(v string) bool {
+	for _, p := range f.Exclude {
+		if strings.HasPrefix(v, p) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, p := range f.Include {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f ValueFilter) empty() bool { return len(f.Include) == 0 && len(f.Exclude) == 0 }
+
+var (
+	// ErrInvalidSettings wraps settings Reconfigure refuses to apply.
+	ErrInvalidSettings = errors.New("invalid settings")
+	// ErrConflict is returned when the settings were based on a stale generation.
+	ErrConflict = errors.New("settings generation conflict")
+)
+
+// ingestQueues are the channels producers enqueue to. They are replaced as a
+// whole when the queue size changes.
+type ingestQueues struct {
+	in      chan Event
+	inBatch chan Batch
+}
+
+func newIngestQueues(size int) *ingestQueues {
+	size = max(size, 0)
+
+	return &ingestQueues{in: make(chan Event, size), inBatch: make(chan Batch, size)}
+}
+
+// inOrNil and inBatchOrNil return nil channels for nil queues, so the loop can
+// select on queues that may not exist.
+func (q *ingestQueues) inOrNil() chan Event {
+	if q == nil {
+		return nil
+	}
+
+	return q.in
+}
+
+func (q *ingestQueues) inBatchOrNil() chan Batch {
+	if q == nil {
+		return nil
+	}
+
+	return q.inBatch
+}
+
+type reconfigRequest struct {
+	s     Settings
+	reply chan reconfigResult
+}
+
+type reconfigResult struct {
+	s   Settings
+	err error
+}
+
+// Settings returns the settings in effect.
+func (a *Aggregator) Settings() Settings { return *a.settings.Load() }
+
+// SetValueFilter sets the initial value filter. Must be called before Start;
+// use Reconfigure afterwards.
+func (a *Aggregator) SetValueFilter(f ValueFilter) {
+	s := a.Settings()
+	s.Filter = f
+	a.settings.Store(&s)
+}
+
+// Reconfigure closes the open window with the current settings and opens the
+// next one with s, returning the settings now in effect. If s.Generation is
+// set it must match the current generation, so that concurrent updates based
+// on the same settings cannot silently overwrite each other.
+func (a *Aggregator) Reconfigure(ctx context.Context, s Settings) (Settings, error) {
+	if err := a.validate(s); err != nil {
+		return Settings{}, err
+	}
+
+	req := reconfigRequest{s: s, reply: make(chan reconfigResult, 1)}
+
+	select {
+	case a.reconfigs <- req:
+	case <-a.done:
+		return Settings{}, ErrStopped
+	case <-ctx.Done():
+		return Settings{}, ctx.Err()
+	}
+
+	res := <-req.reply
+
+	return res.s, res.err
+}
+
+func (a *Aggregator) validate(s Settings) error {
+	switch {
+	case s.AttributeKey == "":
+		return fmt.Errorf("%w: attribute key must not be empty", ErrInvalidSettings)
+	case s.Window < time.Millisecond:
+		return fmt.Errorf("%w: window must be at least 1ms, got %s", ErrInvalidSettings, s.Window)
+	case s.MaxQueue < 0:
+		return fmt.Errorf("%w: queue size must not be negative", ErrInvalidSettings)
+	case len(a.tiers) > 0 && a.tiers[0].resolution%s.Window != 0:
+		return fmt.Errorf("%w: window %s must divide the %s rollup", ErrInvalidSettings, s.Window, a.tiers[0].resolution)
+	}
+
+	return nil
+}
+
+// applyReconfig runs on the aggregation goroutine. Records already queued
+// were resolved under the old settings, so they are counted before the
+// window closes. It returns the queues that producers may still be sending
+// to, which the loop keeps draining until the next window closes.
+func (a *Aggregator) applyReconfig(req reconfigRequest, windowStart, windowEnd int64) (old *ingestQueues, err error) {
+	cur := a.settings.Load()
+	if req.s.Generation != 0 && req.s.Generation != cur.Generation {
+		return nil, fmt.Errorf("%w: based on generation %d, current is %d", ErrConflict, req.s.Generation, cur.Generation)
+	}
+
+	next := req.s
+	next.Generation = cur.Generation + 1
+
+	if next.AttributeKey != cur.AttributeKey {
+		// Batches resolved under the old key are refused from now on; the ones
+		// accepted before are all queued, and drained into the closing window.
+		a.keyMu.Lock()
+		a.keyGeneration.Store(next.Generation)
+		a.keyMu.Unlock()
+
+		// Cumulative counts of different keys must not be mixed.
+		a.resetCum.Store(true)
+	}
+
+	a.drain(a.queues.Load())
+	a.flush(windowStart, windowEnd)
+
+	if next.MaxQueue != cur.MaxQueue {
+		old = a.queues.Swap(newIngestQueues(next.MaxQueue))
+	}
+
+	a.settings.Store(&next)
+
+	return old, nil
+}
+
+// drain applies everything currently buffered in q without blocking.
+func (a *Aggregator) drain(q *ingestQueues) {
+	for {
+		select {
+		case ev := <-q.in:
+			a.add(ev)
+		case b := <-q.inBatch:
+			a.apply(b)
+		default:
+			return
+		}
+	}
+}
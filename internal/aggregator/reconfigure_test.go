@@ -0,0 +1,130 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueFilter_Allows(t *testing.T) {
+	f := ValueFilter{Include: []string{"api-", "web"}, Exclude: []string{"api-internal"}}
+
+	require.True(t, f.Allows("api-1"))
+	require.True(t, f.Allows("web"))
+	require.False(t, f.Allows("api-internal-1"))
+	require.False(t, f.Allows("db"))
+	require.True(t, ValueFilter{}.Allows("anything"))
+}
+
+func TestAggregator_ReconfigureClosesWindow(t *testing.T) {
+	fs := &failingSink{}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+	a.SetValueFilter(ValueFilter{Exclude: []string{"skip"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	require.True(t, a.EnqueueBatch(Batch{Values: []string{"a", "skip-me"}, Missing: 1}))
+
+	next := a.Settings()
+	next.AttributeKey = "bar"
+	next.Window = 30 * time.Minute
+	next.MaxQueue = 1
+	next.Filter = ValueFilter{}
+
+	got, err := a.Reconfigure(context.Background(), next)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, got.Generation)
+	require.Equal(t, "bar", got.AttributeKey)
+	require.Equal(t, got, a.Settings())
+
+	// The new queue size is in effect.
+	require.True(t, a.Enqueue("skip-me"))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+
+	cancel()
+	a.Stop(context.Background())
+
+	snaps := fs.snapshots()
+	require.Len(t, snaps, 2)
+
+	require.Equal(t, "foo", snaps[0].AttributeKey)
+	require.EqualValues(t, 1, snaps[0].Generation)
+	require.Equal(t, map[string]uint64{"a": 1}, snaps[0].Counts)
+	require.EqualValues(t, 2, snaps[0].Total)
+
+	require.Equal(t, "bar", snaps[1].AttributeKey)
+	require.EqualValues(t, 2, snaps[1].Generation)
+	require.Equal(t, map[string]uint64{"skip-me": 1}, snaps[1].Counts)
+	require.Equal(t, snaps[0].WindowEnd, snaps[1].WindowStart)
+}
+
+func TestAggregator_ReconfigureRejects(t *testing.T) {
+	a := New(time.Minute, "foo", &failingSink{}, slog.Default(), 10)
+	require.NoError(t, a.AddRollup(time.Hour, &failingSink{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	for _, s := range []Settings{
+		{AttributeKey: "", Window: time.Minute},
+		{AttributeKey: "foo", Window: 0},
+		{AttributeKey: "foo", Window: time.Minute, MaxQueue: -1},
+		{AttributeKey: "foo", Window: 7 * time.Minute},
+	} {
+		_, err := a.Reconfigure(context.Background(), s)
+		require.ErrorIs(t, err, ErrInvalidSettings)
+	}
+
+	next := a.Settings()
+	next.Generation = 5
+	_, err := a.Reconfigure(context.Background(), next)
+	require.ErrorIs(t, err, ErrConflict)
+	require.EqualValues(t, 1, a.Settings().Generation)
+
+	cancel()
+	a.Stop(context.Background())
+
+	_, err = a.Reconfigure(context.Background(), a.Settings())
+	require.ErrorIs(t, err, ErrStopped)
+}
+
+func TestAggregator_DropsBatchesOfReplacedKey(t *testing.T) {
+	fs := &failingSink{}
+	a := New(time.Hour, "foo", fs, slog.Default(), 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+
+	// An export resolved its values under "foo" just before the key changed.
+	resolved := a.Settings()
+
+	next := a.Settings()
+	next.AttributeKey = "bar"
+	_, err := a.Reconfigure(context.Background(), next)
+	require.NoError(t, err)
+
+	next = a.Settings()
+	next.Filter = ValueFilter{Exclude: []string{"x"}}
+	_, err = a.Reconfigure(context.Background(), next)
+	require.NoError(t, err)
+
+	// Stale batches are refused, so the caller reports them as dropped; a filter
+	// change alone does not make a batch stale.
+	require.False(t, a.EnqueueBatch(Batch{Generation: resolved.Generation, Values: []string{"foo-value"}, Missing: 1}))
+	require.True(t, a.EnqueueBatch(Batch{Generation: 2, Values: []string{"bar-value"}}))
+	require.Eventually(t, func() bool { return a.QueueLen() == 0 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, a.Stop(context.Background()))
+
+	snaps := fs.snapshots()
+	last := snaps[len(snaps)-1]
+	require.Equal(t, "bar", last.AttributeKey)
+	require.Equal(t, map[string]uint64{"bar-value": 1}, last.Counts)
+	require.EqualValues(t, 1, last.Total)
+	require.Zero(t, last.Dropped)
+}
@@ -0,0 +1,191 @@
+package aggregator
+
+import (
+	"fmt"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// tier merges closed windows into coarser windows aligned to its resolution
+// (UTC epoch multiples). It is owned by the aggregation goroutine.
+//
+// A window belongs to the bucket containing its start. With tiers configured
+// the aggregator aligns its windows to epoch multiples of the window, which
+// divides every resolution, so a window never crosses a bucket boundary. Only
+// a window recovered from a run without tiers, or one cut short by a
+// reconfiguration, may start off a multiple; it still ends at the next one.
+type tier struct {
+	name       string
+	resolution time.Duration
+	sink       sink.Sink
+
+	// open accumulates the current bucket; bucketEnd is its exclusive end in ms.
+	open      *sink.Snapshot
+	bucketEnd int64
+}
+
+// AddRollup adds a rollup tier publishing merged windows of the given
+// resolution to s. Tiers must be added finest first; each resolution must be a
+// multiple of the window and of the previous tier. Adding a tier makes the
+// aggregator close its windows at epoch multiples of the window. Must be
+// called before Start.
+func (a *Aggregator) AddRollup(resolution time.Duration, s sink.Sink) error {
+	prev := a.Settings().Window
+	if n := len(a.tiers); n > 0 {
+		prev = a.tiers[n-1].resolution
+	}
+
+	if prev <= 0 || resolution <= prev || resolution%prev != 0 || resolution%time.Millisecond != 0 {
+		return fmt.Errorf("rollup resolution %s must be a whole multiple of %s", resolution, prev)
+	}
+
+	a.tiers = append(a.tiers, &tier{name: RollupTarget(resolution), resolution: resolution, sink: s})
+
+	return nil
+}
+
+// RollupTarget names the delivery target of the tier with the given resolution,
+// as used in logs and durable state.
+func RollupTarget(resolution time.Duration) string { return "rollup/" + resolution.String() }
+
+// rollup folds a closed window into the tiers. Windows closed by a tier feed
+// the next one, and every tier whose bucket ended by snap.WindowEnd is closed
+// even when snap is empty.
+func (a *Aggregator) rollup(snap sink.Snapshot) {
+	var in []sink.Snapshot
+	if snap.Total > 0 || snap.Dropped > 0 {
+		in = append(in, snap)
+	}
+
+	a.cascade(in, func(t *tier) []sink.Snapshot { return t.advance(snap.WindowEnd) })
+}
+
+// closeRollups emits every open tier window, partial or not.
+func (a *Aggregator) closeRollups() {
+	a.cascade(nil, func(t *tier) []sink.Snapshot {
+		if t.open == nil {
+			return nil
+		}
+
+		return []sink.Snapshot{t.take()}
+	})
+}
+
+func (a *Aggregator) cascade(in []sink.Snapshot, closeFn func(*tier) []sink.Snapshot) {
+	for _, t := range a.tiers {
+		var out []sink.Snapshot
+		for _, s := range in {
+			out = append(out, t.add(s)...)
+		}
+
+		out = append(out, closeFn(t)...)
+		for _, s := range out {
+			a.enqueuePublish(t.name, s)
+		}
+
+		in = out
+	}
+}
+
+// openRollups returns the open window of every tier, keyed by tier name.
+func (a *Aggregator) openRollups() map[string]sink.Snapshot {
+	var out map[string]sink.Snapshot
+
+	for _, t := range a.tiers {
+		if t.open == nil {
+			continue
+		}
+
+		if out == nil {
+			out = make(map[string]sink.Snapshot, len(a.tiers))
+		}
+
+		out[t.name] = *t.open
+	}
+
+	return out
+}
+
+// restoreRollups reopens tier windows recovered from durable state. Windows of
+// tiers that are no longer configured are dropped.
+func (a *Aggregator) restoreRollups() {
+	for _, t := range a.tiers {
+		snap, ok := a.recoveredRollups[t.name]
+		if !ok {
+			continue
+		}
+
+		if snap.Counts == nil {
+			snap.Counts = make(map[string]uint64)
+		}
+
+		t.open = &snap
+		t.bucketEnd = t.bucketStart(snap.WindowStart) + t.resolution.Milliseconds()
+	}
+
+	a.recoveredRollups = nil
+}
+
+func (t *tier) bucketStart(ms int64) int64 {
+	res := t.resolution.Milliseconds()
+	return ms - ms%res
+}
+
+// add merges s into the open bucket and returns the bucket it displaced, if
+// s starts in a later bucket or aggregates a different attribute key.
+func (t *tier) add(s sink.Snapshot) []sink.Snapshot {
+	var closed []sink.Snapshot
+
+	start := t.bucketStart(s.WindowStart)
+	if t.open != nil && (start != t.bucketEnd-t.resolution.Milliseconds() || s.AttributeKey != t.open.AttributeKey) {
+		closed = append(closed, t.take())
+	}
+
+	if t.open == nil {
+		t.open = &sink.Snapshot{
+			WindowStart:  s.WindowStart,
+			WindowEnd:    s.WindowEnd,
+			Temporality:  sink.TemporalityDelta,
+			AttributeKey: s.AttributeKey,
+			Tenant:       s.Tenant,
+			Counts:       make(map[string]uint64, len(s.Counts)),
+		}
+		t.bucketEnd = start + t.resolution.Milliseconds()
+	}
+
+	o := t.open
+	for k, v := range s.Counts {
+		o.Counts[k] += v
+	}
+
+	o.WindowStart = min(o.WindowStart, s.WindowStart)
+	o.WindowEnd = max(o.WindowEnd, s.WindowEnd)
+	o.Missing += s.Missing
+	o.Null += s.Null
+	o.Unsupported += s.Unsupported
+	o.Total += s.Total
+	o.Dropped += s.Dropped
+	o.Labels = s.Labels
+	// A bucket spanning a reconfiguration reports the latest generation.
+	o.Generation = max(o.Generation, s.Generation)
+
+	return closed
+}
+
+// advance closes the open bucket once now has reached its end.
+func (t *tier) advance(now int64) []sink.Snapshot {
+	if t.open == nil || now < t.bucketEnd {
+		return nil
+	}
+
+	return []sink.Snapshot{t.take()}
+}
+
+// take hands the open bucket over; it is not touched afterwards.
+func (t *tier) take() sink.Snapshot {
+	s := *t.open
+	t.open = nil
+
+	return s
+}
@@ -0,0 +1,188 @@
+package aggregator
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// drain returns the snapshots queued for target, in order.
+func drain(a *Aggregator, target string) []sink.Snapshot {
+	var out []sink.Snapshot
+
+	for {
+		select {
+		case p := <-a.pubQueue:
+			if p.target == target {
+				out = append(out, p.snap)
+			}
+		default:
+			return out
+		}
+	}
+}
+
+func window(start, end int64, counts map[string]uint64, dropped uint64) sink.Snapshot {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+
+	return sink.Snapshot{WindowStart: start, WindowEnd: end, AttributeKey: "foo", Counts: counts, Total: total, Dropped: dropped}
+}
+
+func TestAddRollup_Validation(t *testing.T) {
+	a := New(10*time.Second, "foo", nil, nil, 0)
+
+	require.Error(t, a.AddRollup(15*time.Second, nil), "not a multiple of the window")
+	require.Error(t, a.AddRollup(10*time.Second, nil), "not coarser than the window")
+	require.NoError(t, a.AddRollup(time.Minute, nil))
+	require.Error(t, a.AddRollup(90*time.Second, nil), "not a multiple of the previous tier")
+	require.NoError(t, a.AddRollup(time.Hour, nil))
+}
+
+func TestRollup_TotalsAndDrops(t *testing.T) {
+	a := New(10*time.Millisecond, "foo", nil, nil, 0)
+	a.SetPublishQueue(100, 1)
+	require.NoError(t, a.AddRollup(30*time.Millisecond, nil))
+	require.NoError(t, a.AddRollup(60*time.Millisecond, nil))
+
+	var collected []pendingSnapshot
+
+	for start := int64(0); start < 60; start += 10 {
+		w := window(start, start+10, map[string]uint64{"a": 1, "b": 2}, 1)
+		w.Missing = 1
+		w.Total++
+		a.rollup(w)
+
+		for len(a.pubQueue) > 0 {
+			collected = append(collected, <-a.pubQueue)
+		}
+	}
+
+	require.Len(t, collected, 3)
+
+	require.Equal(t, RollupTarget(30*time.Millisecond), collected[0].target)
+	require.EqualValues(t, 0, collected[0].snap.WindowStart)
+	require.EqualValues(t, 30, collected[0].snap.WindowEnd)
+	require.Equal(t, map[string]uint64{"a": 3, "b": 6}, collected[0].snap.Counts)
+	require.EqualValues(t, 3, collected[0].snap.Missing)
+	require.EqualValues(t, 12, collected[0].snap.Total)
+	require.EqualValues(t, 3, collected[0].snap.Dropped)
+
+	// The coarse tier is fed by the fine tier and closes with its second bucket.
+	require.Equal(t, RollupTarget(30*time.Millisecond), collected[1].target)
+	require.Equal(t, RollupTarget(60*time.Millisecond), collected[2].target)
+	require.EqualValues(t, 0, collected[2].snap.WindowStart)
+	require.EqualValues(t, 60, collected[2].snap.WindowEnd)
+	require.Equal(t, map[string]uint64{"a": 6, "b": 12}, collected[2].snap.Counts)
+	require.EqualValues(t, 24, collected[2].snap.Total)
+	require.EqualValues(t, 6, collected[2].snap.Dropped)
+	require.Equal(t, sink.TemporalityDelta, collected[2].snap.Temporality)
+}
+
+func TestRollup_EmptyWindowsCloseBuckets(t *testing.T) {
+	a := New(10*time.Millisecond, "foo", nil, nil, 0)
+	require.NoError(t, a.AddRollup(30*time.Millisecond, nil))
+
+	a.rollup(window(0, 10, map[string]uint64{"a": 1}, 0))
+	a.rollup(window(10, 20, nil, 0))
+	require.Empty(t, drain(a, RollupTarget(30*time.Millisecond)))
+
+	a.rollup(window(20, 30, nil, 0))
+	got := drain(a, RollupTarget(30*time.Millisecond))
+	require.Len(t, got, 1)
+	require.EqualValues(t, 1, got[0].Total)
+
+	// Nothing is emitted for buckets without records.
+	a.rollup(window(30, 40, nil, 0))
+	a.rollup(window(50, 60, nil, 0))
+	require.Empty(t, drain(a, RollupTarget(30*time.Millisecond)))
+}
+
+func TestRollup_CloseAndRestore(t *testing.T) {
+	a := New(10*time.Millisecond, "foo", nil, nil, 0)
+	require.NoError(t, a.AddRollup(30*time.Millisecond, nil))
+	require.NoError(t, a.AddRollup(60*time.Millisecond, nil))
+
+	a.rollup(window(0, 10, map[string]uint64{"a": 1}, 0))
+	a.rollup(window(10, 20, map[string]uint64{"a": 2}, 0))
+
+	// Open buckets survive a restart through durable state.
+	b := New(10*time.Millisecond, "foo", nil, nil, 0)
+	require.NoError(t, b.AddRollup(30*time.Millisecond, nil))
+	require.NoError(t, b.AddRollup(60*time.Millisecond, nil))
+
+	b.recoveredRollups = a.openRollups()
+	b.restoreRollups()
+	b.rollup(window(20, 30, map[string]uint64{"a": 4}, 0))
+
+	got := drain(b, RollupTarget(30*time.Millisecond))
+	require.Len(t, got, 1)
+	require.EqualValues(t, 0, got[0].WindowStart)
+	require.EqualValues(t, 7, got[0].Total)
+
+	// On shutdown partial buckets are emitted and cascade to coarser tiers.
+	b.rollup(window(30, 40, map[string]uint64{"a": 8}, 0))
+	b.closeRollups()
+
+	var targets []string
+
+	var totals []uint64
+
+	for len(b.pubQueue) > 0 {
+		p := <-b.pubQueue
+		targets = append(targets, p.target)
+		totals = append(totals, p.snap.Total)
+	}
+
+	require.Equal(t, []string{RollupTarget(30 * time.Millisecond), RollupTarget(60 * time.Millisecond)}, targets)
+	require.Equal(t, []uint64{8, 15}, totals)
+}
+
+func TestAlignedWindowBounds(t *testing.T) {
+	w := 10 * time.Millisecond
+
+	require.Equal(t, 7*time.Millisecond, untilBoundary(time.UnixMilli(1003), 1003, w))
+	require.Equal(t, 2*time.Millisecond, untilBoundary(time.UnixMilli(1008), 1003, w))
+	require.Equal(t, time.Millisecond, untilBoundary(time.UnixMilli(1015), 1003, w), "overdue")
+
+	require.EqualValues(t, 1010, alignedEnd(1003, 1012, w), "ticker latency is cut off")
+	require.EqualValues(t, 1020, alignedEnd(1010, 1020, w))
+	require.EqualValues(t, 1005, alignedEnd(1003, 1005, w), "never empty")
+}
+
+func TestAggregator_RollupsAlignWindows(t *testing.T) {
+	fs := &failingSink{}
+	a := New(20*time.Millisecond, "foo", fs, slog.Default(), 10)
+	require.NoError(t, a.AddRollup(40*time.Millisecond, &failingSink{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	// Empty windows are not published, so keep every window busy.
+	require.Eventually(t, func() bool {
+		a.Enqueue("v")
+		return len(fs.snapshots()) >= 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, a.Stop(context.Background()))
+
+	// Every window closed by the ticker ends on a multiple of the window.
+	got := fs.snapshots()
+	slices.SortFunc(got, func(x, y sink.Snapshot) int { return cmp.Compare(x.WindowStart, y.WindowStart) })
+
+	for _, s := range got[:len(got)-1] {
+		require.Zero(t, s.WindowEnd%20, "window %d-%d", s.WindowStart, s.WindowEnd)
+	}
+
+	for _, s := range got[1 : len(got)-1] {
+		require.EqualValues(t, 20, s.WindowEnd-s.WindowStart)
+	}
+}
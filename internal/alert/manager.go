@@ -0,0 +1,252 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Status is the state an alert transitioned to.
+type Status string
+
+const (
+	StatusFiring   Status = "firing"
+	StatusResolved Status = "resolved"
+)
+
+// Alert describes one rule transition. StartsAt is the start of the window in
+// which the rule began firing; EndsAt is set when it resolved.
+type Alert struct {
+	Status       Status  `json:"status"`
+	Rule         string  `json:"rule"`
+	Expr         string  `json:"expr"`
+	AttributeKey string  `json:"attribute_key"`
+	Value        float64 `json:"value"`
+	Threshold    float64 `json:"threshold"`
+	WindowStart  int64   `json:"window_start"`
+	WindowEnd    int64   `json:"window_end"`
+	StartsAt     int64   `json:"starts_at"`
+	EndsAt       int64   `json:"ends_at,omitempty"`
+}
+
+// Notifier delivers the transitions of one evaluation.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// Manager evaluates rules against closed windows off the aggregation goroutine
+// and notifies only on transitions, so a rule that keeps firing is reported once.
+//
+// A transition counts as notified only once it was delivered. Until then the
+// receiver's view and the rule's state differ, and every later window reports
+// the difference again, so a failed delivery is retried with the next window
+// rather than lost.
+type Manager struct {
+	rules    []Rule
+	notifier Notifier
+	logger   *slog.Logger
+	onNotify func(Alert, error)
+
+	// states maps rule name to what was observed and what was delivered.
+	states map[string]*ruleState
+
+	in   chan sink.Snapshot
+	done chan struct{}
+
+	// ctx bounds the notifications; Close cancels it once its deadline passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// ruleState tracks one rule. holding and since follow the evaluated windows;
+// notified is the status the receiver was last told about.
+type ruleState struct {
+	holding  bool
+	notified bool
+	// since is the start of the window in which the rule began holding, and
+	// until the end of the window in which it stopped.
+	since int64
+	until int64
+}
+
+// NewManager returns a manager buffering up to queue closed windows.
+func NewManager(rules []Rule, n Notifier, logger *slog.Logger, queue int) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		rules:    rules,
+		notifier: n,
+		logger:   logger,
+		states:   make(map[string]*ruleState, len(rules)),
+		in:       make(chan sink.Snapshot, max(queue, 1)),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// SetNotifyCallback installs an optional callback invoked per delivered or
+// failed alert, e.g. for metrics.
+func (m *Manager) SetNotifyCallback(fn func(Alert, error)) { m.onNotify = fn }
+
+// Evaluate applies every rule to a closed window and returns the transitions
+// not yet delivered; Delivered records them once they were. Rules that do not
+// apply to the window's attribute key resolve if firing. A rule that starts
+// and stops holding before anything was delivered is not reported at all.
+func (m *Manager) Evaluate(snap sink.Snapshot) []Alert {
+	var out []Alert
+
+	for _, r := range m.rules {
+		value := 0.0
+		holds := false
+
+		if r.Applies(snap) {
+			value = r.Value(snap)
+			holds = r.Holds(value)
+		}
+
+		st := m.states[r.Name]
+		if st == nil {
+			st = &ruleState{}
+			m.states[r.Name] = st
+		}
+
+		switch {
+		case holds && !st.holding:
+			st.holding = true
+			// A rule that resumes before its resolution was delivered keeps
+			// the start the receiver knows.
+			if !st.notified {
+				st.since = snap.WindowStart
+			}
+		case !holds && st.holding:
+			st.holding, st.until = false, snap.WindowEnd
+		}
+
+		if st.holding == st.notified {
+			continue
+		}
+
+		a := Alert{
+			Rule:         r.Name,
+			Expr:         r.Expr,
+			AttributeKey: snap.AttributeKey,
+			Value:        value,
+			Threshold:    r.Threshold(),
+			WindowStart:  snap.WindowStart,
+			WindowEnd:    snap.WindowEnd,
+			StartsAt:     st.since,
+		}
+
+		if st.holding {
+			a.Status = StatusFiring
+		} else {
+			a.Status, a.EndsAt = StatusResolved, st.until
+		}
+
+		out = append(out, a)
+	}
+
+	return out
+}
+
+// Delivered records that the receiver was told about alerts, so that they are
+// not reported again.
+func (m *Manager) Delivered(alerts []Alert) {
+	for _, a := range alerts {
+		if st := m.states[a.Rule]; st != nil {
+			st.notified = a.Status == StatusFiring
+		}
+	}
+}
+
+// Firing returns the names of the rules the receiver was told are firing.
+func (m *Manager) Firing() []string {
+	out := make([]string, 0, len(m.states))
+	for _, r := range m.rules {
+		if st := m.states[r.Name]; st != nil && st.notified {
+			out = append(out, r.Name)
+		}
+	}
+
+	return out
+}
+
+// Observe queues a closed window without blocking; a window that does not fit
+// is skipped and its transitions are picked up by the next one.
+func (m *Manager) Observe(snap sink.Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	select {
+	case m.in <- snap:
+	default:
+		m.logger.Warn("alert queue full; skipping window", slog.Int64("window_start", snap.WindowStart))
+	}
+}
+
+// Start begins evaluating queued windows.
+func (m *Manager) Start() {
+	go func() {
+		defer close(m.done)
+
+		for snap := range m.in {
+			alerts := m.Evaluate(snap)
+			if len(alerts) == 0 {
+				continue
+			}
+
+			err := m.notifier.Notify(m.ctx, alerts)
+			if err == nil {
+				m.Delivered(alerts)
+			}
+
+			for _, a := range alerts {
+				if err != nil {
+					m.logger.Error(
+						"failed to deliver alert notification; retrying with the next window",
+						slog.String("err", err.Error()),
+						slog.String("rule", a.Rule),
+						slog.String("status", string(a.Status)),
+					)
+				} else {
+					m.logger.Info("alert "+string(a.Status), slog.String("rule", a.Rule), slog.Float64("value", a.Value))
+				}
+
+				if m.onNotify != nil {
+					m.onNotify(a, err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting windows and waits until the queued ones are evaluated
+// and notified. Once ctx is done, pending notifications are cancelled and
+// their alerts left undelivered. Later Observe calls are ignored.
+func (m *Manager) Close(ctx context.Context) {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.in)
+	}
+	m.mu.Unlock()
+
+	defer m.cancel()
+
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		m.cancel()
+		<-m.done
+	}
+}
@@ -0,0 +1,161 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+type recordingNotifier struct {
+	got [][]Alert
+	err error
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, alerts []Alert) error {
+	r.got = append(r.got, alerts)
+	return r.err
+}
+
+func win(start int64, payment uint64) sink.Snapshot {
+	return sink.Snapshot{
+		WindowStart:  start,
+		WindowEnd:    start + 10,
+		AttributeKey: "foo",
+		Counts:       map[string]uint64{"payment": payment},
+		Total:        payment,
+	}
+}
+
+func TestManager_FiresOnceAndResolves(t *testing.T) {
+	rules, err := ParseRules("high=count(payment) > 100")
+	require.NoError(t, err)
+
+	m := NewManager(rules, &recordingNotifier{}, slog.New(slog.NewTextHandler(io.Discard, nil)), 1)
+
+	require.Empty(t, m.Evaluate(win(0, 50)))
+
+	fired := m.Evaluate(win(10, 150))
+	require.Len(t, fired, 1)
+	m.Delivered(fired)
+	require.Equal(t, StatusFiring, fired[0].Status)
+	require.Equal(t, "high", fired[0].Rule)
+	require.InDelta(t, 150, fired[0].Value, 0)
+	require.InDelta(t, 100, fired[0].Threshold, 0)
+	require.EqualValues(t, 10, fired[0].StartsAt)
+	require.Equal(t, []string{"high"}, m.Firing())
+
+	// Still firing: deduplicated.
+	require.Empty(t, m.Evaluate(win(20, 500)))
+
+	resolved := m.Evaluate(win(30, 0))
+	require.Len(t, resolved, 1)
+	m.Delivered(resolved)
+	require.Equal(t, StatusResolved, resolved[0].Status)
+	require.EqualValues(t, 10, resolved[0].StartsAt)
+	require.EqualValues(t, 40, resolved[0].EndsAt)
+	require.Empty(t, m.Firing())
+}
+
+func TestManager_ResolvesWhenKeyChanges(t *testing.T) {
+	rules, err := ParseRules("count(foo=payment) > 1")
+	require.NoError(t, err)
+
+	m := NewManager(rules, &recordingNotifier{}, slog.New(slog.NewTextHandler(io.Discard, nil)), 1)
+	m.Delivered(m.Evaluate(win(0, 5)))
+	require.Len(t, m.Firing(), 1)
+
+	other := win(10, 5)
+	other.AttributeKey = "bar"
+	got := m.Evaluate(other)
+	require.Len(t, got, 1)
+	require.Equal(t, StatusResolved, got[0].Status)
+}
+
+func TestManager_NotifiesTransitions(t *testing.T) {
+	rules, err := ParseRules("high=count(payment) > 100")
+	require.NoError(t, err)
+
+	n := &recordingNotifier{err: errors.New("down")}
+	m := NewManager(rules, n, slog.New(slog.NewTextHandler(io.Discard, nil)), 8)
+
+	var failures int
+
+	m.SetNotifyCallback(func(_ Alert, err error) {
+		if err != nil {
+			failures++
+		}
+	})
+	m.Start()
+
+	for i, p := range []uint64{500, 500, 0} {
+		m.Observe(win(int64(i)*10, p))
+	}
+
+	m.Close(context.Background())
+	m.Observe(win(100, 500)) // ignored after Close
+
+	// The failed firing is retried with the next window; once the rule stops
+	// holding there is nothing the receiver needs to be told.
+	require.Len(t, n.got, 2)
+	require.Equal(t, StatusFiring, n.got[0][0].Status)
+	require.Equal(t, StatusFiring, n.got[1][0].Status)
+	require.EqualValues(t, 0, n.got[1][0].StartsAt)
+	require.Equal(t, 2, failures)
+}
+
+func TestManager_RetriesUndeliveredTransitions(t *testing.T) {
+	rules, err := ParseRules("high=count(payment) > 100")
+	require.NoError(t, err)
+
+	m := NewManager(rules, &recordingNotifier{}, slog.New(slog.NewTextHandler(io.Discard, nil)), 1)
+
+	m.Delivered(m.Evaluate(win(0, 500)))
+
+	// The resolution is not delivered, so the next window reports it again,
+	// with the end of the window in which the rule stopped holding.
+	require.Len(t, m.Evaluate(win(10, 0)), 1)
+
+	again := m.Evaluate(win(20, 0))
+	require.Len(t, again, 1)
+	require.Equal(t, StatusResolved, again[0].Status)
+	require.EqualValues(t, 0, again[0].StartsAt)
+	require.EqualValues(t, 20, again[0].EndsAt)
+	require.Equal(t, []string{"high"}, m.Firing())
+
+	// Holding again before the resolution was delivered: the receiver is
+	// still right, so nothing is reported.
+	require.Empty(t, m.Evaluate(win(30, 500)))
+
+	m.Delivered(m.Evaluate(win(40, 0)))
+	require.Empty(t, m.Firing())
+	require.Empty(t, m.Evaluate(win(50, 0)))
+}
+
+type blockingNotifier struct{}
+
+func (blockingNotifier) Notify(ctx context.Context, _ []Alert) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestManager_CloseCancelsNotify(t *testing.T) {
+	rules, err := ParseRules("total > 1")
+	require.NoError(t, err)
+
+	m := NewManager(rules, blockingNotifier{}, slog.New(slog.NewTextHandler(io.Discard, nil)), 1)
+	m.Start()
+	m.Observe(win(0, 5))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	m.Close(ctx)
+	require.Empty(t, m.Firing())
+}
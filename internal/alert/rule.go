@@ -0,0 +1,207 @@
+// Package alert evaluates threshold rules against closed windows and notifies
+// a webhook when a rule starts or stops firing.
+//
+// A rule is an expression of the form
+//
+//	<metric> <op> <threshold>[%]
+//
+// where metric is one of total, dropped, distinct, count(<value>) or
+// ratio(<value>), op is one of > >= < <= == !=, and a trailing % divides the
+// threshold by 100. The value inside count() and ratio() may be prefixed with
+// the attribute key ("foo=payment"), in which case the rule only applies while
+// that key is being aggregated. Values are addressed as sink.LabeledCounts
+// lists them: reserved buckets by their labels, so "ratio(__missing__) > 20%"
+// fires when more than a fifth of the records lack the attribute, and values
+// starting with sink.ReservedPrefix in their escaped form.
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Rule is a named, parsed threshold expression.
+type Rule struct {
+	Name string
+	Expr string
+
+	metric    string
+	key       string
+	value     string
+	op        string
+	threshold float64
+}
+
+var ops = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// ParseRule parses expr into a rule called name; an empty name defaults to expr.
+func ParseRule(name, expr string) (Rule, error) {
+	expr = strings.TrimSpace(expr)
+	if name == "" {
+		name = expr
+	}
+
+	r := Rule{Name: name, Expr: expr}
+
+	lhs, rhs, op, ok := splitOp(expr)
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q: missing comparison operator", name)
+	}
+
+	r.op = op
+
+	thr := strings.TrimSpace(rhs)
+	percent := strings.HasSuffix(thr, "%")
+	thr = strings.TrimSuffix(thr, "%")
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(thr), 64)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: invalid threshold %q", name, rhs)
+	}
+
+	if percent {
+		v /= 100
+	}
+
+	r.threshold = v
+
+	lhs = strings.TrimSpace(lhs)
+	switch {
+	case lhs == "total" || lhs == "dropped" || lhs == "distinct":
+		r.metric = lhs
+	case strings.HasPrefix(lhs, "count(") && strings.HasSuffix(lhs, ")"):
+		r.metric = "count"
+	case strings.HasPrefix(lhs, "ratio(") && strings.HasSuffix(lhs, ")"):
+		r.metric = "ratio"
+	default:
+		return Rule{}, fmt.Errorf("rule %q: unknown metric %q: want total|dropped|distinct|count(value)|ratio(value)", name, lhs)
+	}
+
+	if r.metric == "count" || r.metric == "ratio" {
+		arg := strings.TrimSpace(lhs[len(r.metric)+1 : len(lhs)-1])
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			r.key, arg = strings.TrimSpace(k), strings.TrimSpace(v)
+		}
+
+		if arg == "" {
+			return Rule{}, fmt.Errorf("rule %q: %s() needs a value", name, r.metric)
+		}
+
+		r.value = arg
+	}
+
+	return r, nil
+}
+
+// ParseRules parses a ';'-separated list of rules, each optionally named as
+// "name=expr" where the name contains no parentheses.
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, expr := "", part
+		if n, e, ok := strings.Cut(part, "="); ok && !strings.ContainsAny(n, "()<>!= ") && n != "" {
+			name, expr = n, e
+		}
+
+		r, err := ParseRule(name, expr)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+
+		seen[r.Name] = true
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// splitOp finds the comparison operator outside any parentheses.
+func splitOp(expr string) (lhs, rhs, op string, ok bool) {
+	depth := 0
+
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+
+		if depth != 0 {
+			continue
+		}
+
+		for _, o := range ops {
+			if strings.HasPrefix(expr[i:], o) {
+				return expr[:i], expr[i+len(o):], o, true
+			}
+		}
+	}
+
+	return "", "", "", false
+}
+
+// Applies reports whether the rule targets the snapshot's attribute key.
+func (r Rule) Applies(snap sink.Snapshot) bool { return r.key == "" || r.key == snap.AttributeKey }
+
+// Value computes the rule's metric for a closed window.
+func (r Rule) Value(snap sink.Snapshot) float64 {
+	switch r.metric {
+	case "total":
+		return float64(snap.Total)
+	case "dropped":
+		return float64(snap.Dropped)
+	case "distinct":
+		return float64(len(snap.Counts))
+	case "count":
+		return float64(snap.LabeledCounts()[r.value])
+	case "ratio":
+		if snap.Total == 0 {
+			return 0
+		}
+
+		return float64(snap.LabeledCounts()[r.value]) / float64(snap.Total)
+	default:
+		return 0
+	}
+}
+
+// Threshold returns the parsed threshold; percentages are already divided by 100.
+func (r Rule) Threshold() float64 { return r.threshold }
+
+// Holds reports whether value satisfies the rule's comparison.
+func (r Rule) Holds(value float64) bool {
+	switch r.op {
+	case ">":
+		return value > r.threshold
+	case ">=":
+		return value >= r.threshold
+	case "<":
+		return value < r.threshold
+	case "<=":
+		return value <= r.threshold
+	case "==":
+		return value == r.threshold
+	case "!=":
+		return value != r.threshold
+	default:
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+package alert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestParseRule_Evaluates(t *testing.T) {
+	snap := sink.Snapshot{
+		AttributeKey: "foo",
+		Counts:       map[string]uint64{"payment": 1200, "search": 300},
+		Missing:      500,
+		Labels:       sink.DefaultBucketLabels(),
+		Total:        2000,
+		Dropped:      3,
+	}
+
+	tests := []struct {
+		expr  string
+		value float64
+		holds bool
+	}{
+		{"count(foo=payment) > 1000", 1200, true},
+		{"count(payment) <= 1000", 1200, false},
+		{"ratio(__missing__) > 20%", 0.25, true},
+		{"ratio(__missing__)>=0.3", 0.25, false},
+		{"total == 2000", 2000, true},
+		{"dropped != 0", 3, true},
+		{"distinct < 2", 2, false},
+		{"count(absent) < 1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			r, err := ParseRule("", tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.expr, r.Name)
+			require.True(t, r.Applies(snap))
+			require.InDelta(t, tt.value, r.Value(snap), 1e-9)
+			require.Equal(t, tt.holds, r.Holds(r.Value(snap)))
+		})
+	}
+}
+
+func TestParseRule_KeyScoping(t *testing.T) {
+	r, err := ParseRule("p", "count(bar=payment) > 0")
+	require.NoError(t, err)
+	require.False(t, r.Applies(sink.Snapshot{AttributeKey: "foo"}))
+	require.True(t, r.Applies(sink.Snapshot{AttributeKey: "bar"}))
+}
+
+func TestParseRule_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"count(payment)",
+		"count(payment) > lots",
+		"sum(payment) > 1",
+		"count() > 1",
+		"ratio(=) > 1",
+	} {
+		_, err := ParseRule("", expr)
+		require.Errorf(t, err, "expr %q", expr)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("payments_high=count(foo=payment) > 1000; ratio(__missing__) > 20% ;total >= 1;")
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	require.Equal(t, "payments_high", rules[0].Name)
+	require.Equal(t, "count(foo=payment) > 1000", rules[0].Expr)
+	require.Equal(t, "ratio(__missing__) > 20%", rules[1].Name)
+	require.InDelta(t, 0.2, rules[1].Threshold(), 1e-9)
+	require.Equal(t, "total >= 1", rules[2].Name)
+
+	_, err = ParseRules("a=total > 1;a=total > 2")
+	require.ErrorContains(t, err, "duplicate")
+}
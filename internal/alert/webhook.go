@@ -0,0 +1,38 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Payload is the JSON body posted to the webhook.
+type Payload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Webhook posts alert transitions as JSON to an HTTP endpoint through the
+// same sink.Poster as the snapshot webhook. Network errors, 429 and 5xx
+// responses are retried with the policy's backoff; other non-2xx responses
+// fail immediately.
+type Webhook struct {
+	p     *sink.Poster
+	retry sink.RetryPolicy
+}
+
+// NewWebhook returns a webhook notifier; each attempt is bounded by retry.Timeout.
+func NewWebhook(url string, retry sink.RetryPolicy) *Webhook {
+	return &Webhook{p: sink.NewPoster(url), retry: retry}
+}
+
+// Notify posts alerts, retrying transient failures.
+func (w *Webhook) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(Payload{Alerts: alerts})
+	if err != nil {
+		return fmt.Errorf("encode alerts: %w", err)
+	}
+
+	return sink.Retry(ctx, w.retry, func(ctx context.Context) error { return w.p.Post(ctx, body) }, nil)
+}
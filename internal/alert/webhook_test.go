@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestWebhook_PostsJSONAndRetries(t *testing.T) {
+	var calls atomic.Int32
+
+	var got Payload
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, sink.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Timeout: time.Second})
+	alerts := []Alert{{Status: StatusFiring, Rule: "high", Expr: "count(payment) > 100", Value: 150, Threshold: 100}}
+
+	require.NoError(t, wh.Notify(context.Background(), alerts))
+	require.EqualValues(t, 2, calls.Load())
+	require.Equal(t, alerts, got.Alerts)
+}
+
+func TestWebhook_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, sink.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	require.EqualError(t, wh.Notify(context.Background(), []Alert{{Rule: "r"}}), "webhook responded 400")
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestWebhook_GivesUpAfterAttempts(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, sink.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	require.Error(t, wh.Notify(context.Background(), []Alert{{Rule: "r"}}))
+	require.EqualValues(t, 2, calls.Load())
+}
@@ -0,0 +1,266 @@
+// Package anomaly flags attribute values whose per-window count deviates from
+// their learned baseline.
+//
+// Each value keeps an exponentially weighted moving average and variance of its
+// count per closed window, optionally one per slot of a seasonal cycle (e.g.
+// one per hour of the day). A window whose count lies more than Threshold
+// standard deviations away from the baseline yields a spike or drop event;
+// values appearing after warm-up and established values that stop appearing
+// yield new-value and disappeared-value events.
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Kind classifies an anomaly event.
+type Kind string
+
+const (
+	KindSpike       Kind = "spike"
+	KindDrop        Kind = "drop"
+	KindNewValue    Kind = "new_value"
+	KindDisappeared Kind = "disappeared_value"
+)
+
+// Event reports one anomalous value in a closed window. Expected is the
+// baseline mean the observation was compared against; ZScore is zero for
+// new-value and disappeared-value events.
+type Event struct {
+	Kind         Kind    `json:"kind"`
+	AttributeKey string  `json:"attribute_key"`
+	Value        string  `json:"value"`
+	WindowStart  int64   `json:"window_start"`
+	WindowEnd    int64   `json:"window_end"`
+	Expected     float64 `json:"expected"`
+	Observed     uint64  `json:"observed"`
+	ZScore       float64 `json:"z_score"`
+}
+
+// Config tunes a Detector. Zero fields take the values of DefaultConfig.
+type Config struct {
+	// Alpha is the EWMA smoothing factor in (0, 1]; higher adapts faster.
+	Alpha float64
+	// Threshold is the absolute z-score at which a count is anomalous.
+	Threshold float64
+	// Warmup is the number of windows a baseline (slot) needs before it is
+	// judged, and the number of windows after which unseen values count as new.
+	Warmup int
+	// Season is the length of the seasonal cycle, e.g. 24h.
+	Season time.Duration
+	// SeasonSlots splits Season into this many equal slots, one baseline each;
+	// a window counts towards the slot containing its start, measured from the
+	// UTC epoch. 0 or 1, or a zero Season, disables seasonality.
+	SeasonSlots int
+	// DisappearAfter is the number of consecutive empty windows after which an
+	// established value is reported as disappeared and forgotten.
+	DisappearAfter int
+	// MinExpected ignores baselines below this mean, so rare values do not
+	// produce noise.
+	MinExpected float64
+}
+
+// DefaultConfig returns the detector defaults.
+func DefaultConfig() Config {
+	return Config{Alpha: 0.3, Threshold: 3, Warmup: 5, DisappearAfter: 3, MinExpected: 1}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		c.Alpha = d.Alpha
+	}
+
+	if c.Threshold <= 0 {
+		c.Threshold = d.Threshold
+	}
+
+	if c.Warmup <= 0 {
+		c.Warmup = d.Warmup
+	}
+
+	if c.SeasonSlots <= 0 || c.Season <= 0 {
+		c.SeasonSlots = 1
+	}
+
+	if c.DisappearAfter <= 0 {
+		c.DisappearAfter = d.DisappearAfter
+	}
+
+	if c.MinExpected <= 0 {
+		c.MinExpected = d.MinExpected
+	}
+
+	return c
+}
+
+// slot is the EWMA baseline of one value in one seasonal slot.
+type slot struct {
+	mean, variance float64
+	n              int
+}
+
+func (s *slot) update(x, alpha float64) {
+	if s.n == 0 {
+		s.mean = x
+	} else {
+		diff := x - s.mean
+		s.mean += alpha * diff
+		s.variance = (1 - alpha) * (s.variance + alpha*diff*diff)
+	}
+
+	s.n++
+}
+
+type baseline struct {
+	slots  []slot
+	absent int
+	// established is set once a slot had a judged baseline; lastMean is that
+	// slot's mean when the value was last seen.
+	established bool
+	lastMean    float64
+}
+
+// Detector learns per-value baselines from closed windows. It is not safe for
+// concurrent use.
+type Detector struct {
+	cfg       Config
+	values    map[string]*baseline
+	windows   int
+	lastStart int64
+	// key is the attribute key the baselines were learned for.
+	key string
+}
+
+// New returns a detector with cfg, defaulting zero fields.
+func New(cfg Config) *Detector {
+	return &Detector{cfg: cfg.withDefaults(), values: make(map[string]*baseline)}
+}
+
+// Observe folds a closed delta window into the baselines and returns the
+// anomalies it contains, ordered by value. Empty windows must be observed too:
+// they are what drops and disappearances are made of. Windows that do not
+// start after the last observed one are ignored. A window counting another
+// attribute key starts over, warm-up included, as its values are unrelated.
+func (d *Detector) Observe(snap sink.Snapshot) []Event {
+	if d.windows > 0 && snap.AttributeKey != d.key {
+		d.values = make(map[string]*baseline)
+		d.windows = 0
+	}
+
+	if d.windows > 0 && snap.WindowStart <= d.lastStart {
+		return nil
+	}
+
+	d.lastStart, d.key = snap.WindowStart, snap.AttributeKey
+	slotIdx := d.seasonSlot(snap.WindowStart)
+	warm := d.windows >= d.cfg.Warmup
+	d.windows++
+
+	counts := snap.LabeledCounts()
+	event := func(kind Kind, value string, expected float64, observed uint64, z float64) Event {
+		return Event{
+			Kind:         kind,
+			AttributeKey: snap.AttributeKey,
+			Value:        value,
+			WindowStart:  snap.WindowStart,
+			WindowEnd:    snap.WindowEnd,
+			Expected:     expected,
+			Observed:     observed,
+			ZScore:       z,
+		}
+	}
+
+	var events []Event
+
+	for value, n := range counts {
+		b, ok := d.values[value]
+		if !ok {
+			b = &baseline{slots: make([]slot, d.cfg.SeasonSlots)}
+			d.values[value] = b
+
+			if warm {
+				events = append(events, event(KindNewValue, value, 0, n, 0))
+			}
+		}
+
+		b.absent = 0
+		s := &b.slots[slotIdx]
+
+		if s.n >= d.cfg.Warmup && s.mean >= d.cfg.MinExpected {
+			if z := d.zScore(s, float64(n)); z >= d.cfg.Threshold {
+				events = append(events, event(KindSpike, value, s.mean, n, z))
+			} else if z <= -d.cfg.Threshold {
+				events = append(events, event(KindDrop, value, s.mean, n, z))
+			}
+		}
+
+		s.update(float64(n), d.cfg.Alpha)
+
+		b.lastMean = s.mean
+		if s.n >= d.cfg.Warmup && s.mean >= d.cfg.MinExpected {
+			b.established = true
+		}
+	}
+
+	for value, b := range d.values {
+		if _, ok := counts[value]; ok {
+			continue
+		}
+
+		b.absent++
+		b.slots[slotIdx].update(0, d.cfg.Alpha)
+
+		if b.absent < d.cfg.DisappearAfter {
+			continue
+		}
+
+		// Report only values that were established; forget the rest quietly.
+		if b.established {
+			events = append(events, event(KindDisappeared, value, b.lastMean, 0, 0))
+		}
+
+		delete(d.values, value)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Value != events[j].Value {
+			return events[i].Value < events[j].Value
+		}
+
+		return events[i].Kind < events[j].Kind
+	})
+
+	return events
+}
+
+// seasonSlot returns the slot of the seasonal cycle containing ms, so that
+// gaps and restarts do not shift the phase.
+func (d *Detector) seasonSlot(ms int64) int {
+	season := d.cfg.Season.Milliseconds()
+	if d.cfg.SeasonSlots == 1 || season <= 0 {
+		return 0
+	}
+
+	pos := ms % season
+	if pos < 0 {
+		pos += season
+	}
+
+	return int(pos * int64(d.cfg.SeasonSlots) / season)
+}
+
+// Len returns the number of values with a baseline.
+func (d *Detector) Len() int { return len(d.values) }
+
+// zScore measures x against the slot baseline. The deviation is floored at the
+// Poisson deviation of the mean so that perfectly steady values do not turn
+// every small wobble into an infinite z-score.
+func (d *Detector) zScore(s *slot, x float64) float64 {
+	sd := math.Max(math.Sqrt(s.variance), math.Sqrt(math.Max(s.mean, 1)))
+	return (x - s.mean) / sd
+}
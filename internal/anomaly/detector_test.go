@@ -0,0 +1,161 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// feeder observes consecutive 10ms windows.
+type feeder struct {
+	d     *Detector
+	start int64
+}
+
+func (f *feeder) window(counts map[string]uint64) []Event {
+	snap := sink.Snapshot{WindowStart: f.start, WindowEnd: f.start + 10, AttributeKey: "service", Counts: counts}
+	f.start += 10
+
+	return f.d.Observe(snap)
+}
+
+func kinds(events []Event) []Kind {
+	out := make([]Kind, 0, len(events))
+	for _, ev := range events {
+		out = append(out, ev.Kind)
+	}
+
+	return out
+}
+
+func TestDetector_SpikeAndDrop(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 3})}
+
+	for _, n := range []uint64{100, 104, 97, 101, 99} {
+		require.Empty(t, f.window(map[string]uint64{"checkout": n}))
+	}
+
+	events := f.window(map[string]uint64{"checkout": 2000})
+	require.Len(t, events, 1)
+	ev := events[0]
+	require.Equal(t, KindSpike, ev.Kind)
+	require.Equal(t, "service", ev.AttributeKey)
+	require.Equal(t, "checkout", ev.Value)
+	require.EqualValues(t, 2000, ev.Observed)
+	require.InDelta(t, 100, ev.Expected, 5)
+	require.Greater(t, ev.ZScore, 3.0)
+	require.EqualValues(t, 50, ev.WindowStart)
+
+	f = &feeder{d: New(Config{Warmup: 3})}
+	for _, n := range []uint64{100, 104, 97, 101, 99} {
+		f.window(map[string]uint64{"checkout": n})
+	}
+
+	require.Equal(t, []Kind{KindDrop}, kinds(f.window(map[string]uint64{"checkout": 3})))
+}
+
+func TestDetector_SteadyValuesStayQuiet(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 2})}
+
+	// Perfectly constant counts have zero variance; small wobbles must not fire.
+	for range 10 {
+		require.Empty(t, f.window(map[string]uint64{"a": 50}))
+	}
+
+	require.Empty(t, f.window(map[string]uint64{"a": 55}))
+}
+
+func TestDetector_NewAndDisappearedValues(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 2, DisappearAfter: 2})}
+
+	// Values seen during warm-up are not new.
+	require.Empty(t, f.window(map[string]uint64{"a": 10, "rare": 0}))
+	require.Empty(t, f.window(map[string]uint64{"a": 10}))
+	require.Empty(t, f.window(map[string]uint64{"a": 10}))
+
+	events := f.window(map[string]uint64{"a": 10, "b": 7})
+	require.Equal(t, []Kind{KindNewValue}, kinds(events))
+	require.Equal(t, "b", events[0].Value)
+	require.EqualValues(t, 7, events[0].Observed)
+
+	require.Empty(t, f.window(map[string]uint64{"b": 7}))
+
+	// "a" is gone for two windows; "rare" never had a baseline and is forgotten silently.
+	events = f.window(map[string]uint64{"b": 7})
+	require.Equal(t, []Kind{KindDisappeared}, kinds(events))
+	require.Equal(t, "a", events[0].Value)
+	require.InDelta(t, 10, events[0].Expected, 0.001)
+	require.Equal(t, 1, f.d.Len())
+
+	// A returning value starts over as new.
+	require.Equal(t, []Kind{KindNewValue}, kinds(f.window(map[string]uint64{"a": 10, "b": 7})))
+}
+
+func TestDetector_ReservedBucketsUseLabels(t *testing.T) {
+	d := New(Config{Warmup: 1})
+	labels := sink.DefaultBucketLabels()
+
+	d.Observe(sink.Snapshot{WindowStart: 0, Labels: labels, Missing: 5})
+	events := d.Observe(sink.Snapshot{WindowStart: 10, Labels: labels, Missing: 5, Null: 3})
+
+	require.Equal(t, []Kind{KindNewValue}, kinds(events))
+	require.Equal(t, labels.Null, events[0].Value)
+}
+
+func TestDetector_SeasonalBaselines(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 3, Season: 20 * time.Millisecond, SeasonSlots: 2})}
+
+	// Alternating high/low windows are normal with two slots...
+	for range 5 {
+		require.Empty(t, f.window(map[string]uint64{"a": 1000}))
+		require.Empty(t, f.window(map[string]uint64{"a": 10}))
+	}
+
+	// ...but high traffic in the low slot is not.
+	require.Empty(t, f.window(map[string]uint64{"a": 1000}))
+	require.Equal(t, []Kind{KindSpike}, kinds(f.window(map[string]uint64{"a": 1000})))
+}
+
+func TestDetector_SeasonSlotFollowsWindowStart(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 3, Season: 20 * time.Millisecond, SeasonSlots: 2})}
+
+	for range 5 {
+		f.window(map[string]uint64{"a": 1000})
+		f.window(map[string]uint64{"a": 10})
+	}
+
+	// A skipped window, e.g. across a restart, does not shift the phase: the
+	// window at 110 belongs to the low slot and the one at 120 to the high one.
+	f.start += 10
+	require.Empty(t, f.window(map[string]uint64{"a": 10}))
+	require.Equal(t, []Kind{KindDrop}, kinds(f.window(map[string]uint64{"a": 10})))
+}
+
+func TestDetector_IgnoresStaleWindows(t *testing.T) {
+	d := New(Config{})
+	d.Observe(sink.Snapshot{WindowStart: 100, Counts: map[string]uint64{"a": 1}})
+	require.Nil(t, d.Observe(sink.Snapshot{WindowStart: 50, Counts: map[string]uint64{"b": 1}}))
+	require.Nil(t, d.Observe(sink.Snapshot{WindowStart: 100, Counts: map[string]uint64{"c": 1}}))
+	require.Equal(t, 1, d.Len())
+}
+
+func TestDetector_ResetsOnAttributeKeyChange(t *testing.T) {
+	f := &feeder{d: New(Config{Warmup: 3})}
+
+	for _, n := range []uint64{100, 104, 97, 101, 99} {
+		f.window(map[string]uint64{"checkout": n})
+	}
+
+	// The same value under another key is a different series: no spike, no
+	// disappearance of the old values, and a fresh warm-up before new values.
+	snap := sink.Snapshot{WindowStart: f.start, WindowEnd: f.start + 10, AttributeKey: "region", Counts: map[string]uint64{"checkout": 2000}}
+	require.Empty(t, f.d.Observe(snap))
+	require.Equal(t, 1, f.d.Len())
+
+	snap.WindowStart, snap.WindowEnd = snap.WindowEnd, snap.WindowEnd+10
+	snap.Counts = map[string]uint64{"checkout": 2000, "eu": 5}
+	require.Empty(t, f.d.Observe(snap))
+}
@@ -0,0 +1,88 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Stream runs a Detector off the aggregation goroutine and writes its events to
+// w as JSON lines.
+type Stream struct {
+	det     *Detector
+	in      chan sink.Snapshot
+	enc     *json.Encoder
+	logger  *slog.Logger
+	onEvent func(Event)
+	done    chan struct{}
+
+	// mu guards closing in against late Observe calls.
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewStream returns a stream buffering up to queue closed windows.
+func NewStream(det *Detector, w io.Writer, logger *slog.Logger, queue int) *Stream {
+	return &Stream{
+		det:    det,
+		in:     make(chan sink.Snapshot, max(queue, 1)),
+		enc:    json.NewEncoder(w),
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
+
+// SetEventCallback installs an optional callback invoked for every event, e.g. for metrics.
+func (s *Stream) SetEventCallback(fn func(Event)) { s.onEvent = fn }
+
+// Observe queues a closed window without blocking. If the detector is behind,
+// the window is skipped and the baselines simply miss one observation.
+func (s *Stream) Observe(snap sink.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.in <- snap:
+	default:
+		s.logger.Warn("anomaly detector queue full; skipping window", slog.Int64("window_start", snap.WindowStart))
+	}
+}
+
+// Start begins processing queued windows.
+func (s *Stream) Start() {
+	go func() {
+		defer close(s.done)
+
+		for snap := range s.in {
+			for _, ev := range s.det.Observe(snap) {
+				if s.onEvent != nil {
+					s.onEvent(ev)
+				}
+
+				if err := s.enc.Encode(ev); err != nil {
+					s.logger.Error("failed to write anomaly event", slog.String("err", err.Error()), slog.String("value", ev.Value))
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting windows and waits until the queued ones are processed.
+// Later Observe calls are ignored.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.in)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
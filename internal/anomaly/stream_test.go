@@ -0,0 +1,39 @@
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestStream_WritesEventsAsJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+
+	s := NewStream(New(Config{Warmup: 1}), &buf, slog.New(slog.NewTextHandler(io.Discard, nil)), 4)
+
+	var seen []Kind
+
+	s.SetEventCallback(func(ev Event) { seen = append(seen, ev.Kind) })
+	s.Start()
+	s.Observe(sink.Snapshot{WindowStart: 0, WindowEnd: 10, AttributeKey: "k", Counts: map[string]uint64{"a": 1}})
+	s.Observe(sink.Snapshot{WindowStart: 10, WindowEnd: 20, AttributeKey: "k", Counts: map[string]uint64{"a": 1, "b": 2}})
+	s.Close()
+	s.Observe(sink.Snapshot{WindowStart: 20}) // ignored after Close
+
+	require.Equal(t, []Kind{KindNewValue}, seen)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ev))
+	require.Equal(t, Event{Kind: KindNewValue, AttributeKey: "k", Value: "b", WindowStart: 10, WindowEnd: 20, Observed: 2}, ev)
+	require.Contains(t, lines[0], `"kind":"new_value"`)
+}
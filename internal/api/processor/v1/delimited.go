@@ -0,0 +1,30 @@
+package processorv1
+
+import (
+	"bufio"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// DelimitedReader reads Snapshot messages each prefixed with its size as a
+// varint, as written by the protobuf output format.
+type DelimitedReader struct {
+	r *bufio.Reader
+}
+
+// NewDelimitedReader returns a reader of the length-delimited snapshots in r.
+func NewDelimitedReader(r io.Reader) *DelimitedReader {
+	return &DelimitedReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next snapshot, or io.EOF after the last one. A snapshot
+// cut short returns io.ErrUnexpectedEOF.
+func (d *DelimitedReader) Next() (*Snapshot, error) {
+	msg := &Snapshot{}
+	if err := protodelim.UnmarshalFrom(d.r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -17,20 +17,213 @@ type Config struct {
 	OutputFile      string
 	LogLevel        string
 	GracefulTimeout time.Duration
+
+	// LogFormat encodes the application logs on stderr: text, json or none.
+	// LogOTel also sends them to the OpenTelemetry log bridge.
+	LogFormat string
+	LogOTel   bool
+
+	// Encoding options shared by the output formats; OutputTimeFormat is
+	// unix_ms, rfc3339 or rfc3339nano, empty for the format's default.
+	OutputPretty     bool
+	OutputTimeFormat string
+
+	// Output file rotation by size (MiB) and age, retention of rotated files
+	// and fsync policy; zero limits are disabled.
+	OutputMaxSizeMB      int
+	OutputRotateInterval time.Duration
+	OutputMaxBackups     int
+	OutputMaxAge         time.Duration
+	OutputCompress       bool
+	OutputFsync          string
+	OutputFsyncInterval  time.Duration
+
+	// Temporality selects the snapshot views: delta, cumulative or both.
+	Temporality string
+
+	// Rollups lists coarser tiers as resolution=path pairs, e.g. "1m=rollup-1m.jsonl,1h=rollup-1h.jsonl".
+	Rollups string
+
+	// Anomaly detection over closed windows; disabled when AnomalyFile is empty.
+	AnomalyFile           string
+	AnomalyThreshold      float64
+	AnomalyAlpha          float64
+	AnomalyWarmup         int
+	AnomalySeason         time.Duration
+	AnomalyDisappearAfter int
+	AnomalyMinExpected    float64
+
+	// Threshold alert rules, ';'-separated, notified to AlertWebhook.
+	AlertRules   string
+	AlertWebhook string
+
+	// HTTPListenAddr serves the JSON/HTTP APIs; empty disables them.
+	HTTPListenAddr string
+	// QueryHistory is the number of closed snapshots kept for the query API.
+	QueryHistory int
+
+	// Comma-separated value prefixes to count or to ignore; see aggregator.ValueFilter.
+	IncludeValues string
+	ExcludeValues string
+
+	// Tenant labels every snapshot of this instance; subscribers may filter on it.
+	Tenant string
+	// Per-subscriber snapshot buffer and what to do when it is full.
+	SubscribeBuffer int
+	SubscribePolicy string
+
+	// Labels for the reserved buckets of records without a usable value.
+	MissingLabel     string
+	NullLabel        string
+	UnsupportedLabel string
+
+	// Publish retries; snapshots that exhaust them go to DeadLetterFile if set.
+	PublishMaxAttempts    int
+	PublishInitialBackoff time.Duration
+	PublishMaxBackoff     time.Duration
+	PublishTimeout        time.Duration
+	DeadLetterFile        string
+	// Asynchronous delivery: closed snapshots wait in a queue of PublishQueue
+	// entries for one of PublishWorkers publishers.
+	PublishQueue   int
+	PublishWorkers int
+	// ReplayDeadLetter, if set, re-publishes the snapshots in this file, each to
+	// the sink it failed on, and exits.
+	ReplayDeadLetter string
+
+	// OTLP metrics export of every snapshot; disabled when OTLPMetricsEndpoint
+	// is empty. Headers are comma-separated key=value pairs.
+	OTLPMetricsEndpoint string
+	OTLPMetricsProtocol string
+	OTLPMetricsHeaders  string
+	OTLPMetricsInsecure bool
+
+	// Forwarding of received requests to an upstream OTLP endpoint after
+	// counting; disabled when ForwardEndpoint is empty. ForwardBatchSize merges
+	// requests into batches of at least that many records.
+	ForwardEndpoint     string
+	ForwardProtocol     string
+	ForwardHeaders      string
+	ForwardInsecure     bool
+	ForwardQueue        int
+	ForwardBatchSize    int
+	ForwardBatchTimeout time.Duration
+	ForwardMaxAttempts  int
+	ForwardTimeout      time.Duration
+	// SampleRatio is the fraction of log records counted and forwarded.
+	SampleRatio float64
+
+	// SnapshotWebhook, if set, receives every snapshot as a JSON POST.
+	SnapshotWebhook string
+	// CSVDir and ParquetDir, if set, receive the snapshots in long format as
+	// rolling CSV or Parquet files.
+	CSVDir              string
+	ParquetDir          string
+	TableMaxRows        int64
+	TableRollInterval   time.Duration
+	ParquetRowGroupSize int
+	ParquetCompression  string
+	// SinkOptions overrides the queue, workers and retries of added sinks:
+	// ';'-separated name:key=value,... entries.
+	SinkOptions string
+
+	// Prometheus serves /metrics on HTTPListenAddr with the self-metrics and
+	// the per-value counts, limited to PrometheusMaxValues value series.
+	Prometheus          bool
+	PrometheusMaxValues int
+
+	// Durable window state; disabled when StateDir is empty.
+	StateDir           string
+	StateFsync         string
+	StateFsyncInterval time.Duration
+
+	// ConfigFile is a YAML or JSON file layered under environment overrides
+	// and command line flags; see Loader. ValidateConfig only checks it.
+	ConfigFile     string
+	ValidateConfig bool
 }
 
 // RegisterFlags registers CLI flags and returns a reader that captures them after flag.Parse().
 func RegisterFlags() func() Config {
+	configFile := flag.String("config", "", "YAML or JSON config file; environment variables and flags override its settings")
+	validateConfig := flag.Bool("validateConfig", false, "Validate the configuration, print the result and exit")
 	listenAddr := flag.String("listenAddr", "localhost:4317", "The listen address")
 	maxRecv := flag.Int("maxReceiveMessageSize", 16*1024*1024, "The max message size in bytes the server can receive")
 
-	attrKey := flag.String("attributeKey", "foo", "Attribute key to aggregate on")
+	attrKey := flag.String("attributeKey", "foo", "Attribute key to aggregate on; reserved @-prefixed keys (e.g. @severity_text, @scope.name, @trace_present) select record fields")
 	window := flag.Duration("window", 10*time.Second, "Aggregation window duration")
 	maxQueue := flag.Int("maxQueue", 100_000, "Max ingestion queue size")
-	outFmt := flag.String("outputFormat", "json", "Output format: json|log")
-	outFile := flag.String("outputFile", "", "If set, write JSON snapshots to this file instead of stdout")
+	outFmt := flag.String("outputFormat", "json", "Output format: json|log|protobuf")
+	outFile := flag.String("outputFile", "", "If set, write snapshots to this file instead of stdout")
+	outPretty := flag.Bool("outputPretty", false, "Indent JSON snapshots over several lines")
+	outTimeFormat := flag.String("outputTimeFormat", "", "Snapshot timestamps: unix_ms|rfc3339|rfc3339nano; empty uses the format's default (json: unix_ms, log: rfc3339)")
+	outMaxSize := flag.Int("outputMaxSizeMB", 0, "Rotate -outputFile before it grows beyond this many MiB; 0 disables size rotation")
+	outRotateInterval := flag.Duration("outputRotateInterval", 0, "Rotate -outputFile after it has been written to for this long; 0 disables time rotation")
+	outMaxBackups := flag.Int("outputMaxBackups", 0, "Rotated output files to keep; 0 keeps all")
+	outMaxAge := flag.Duration("outputMaxAge", 0, "Remove rotated output files older than this; 0 keeps them")
+	outCompress := flag.Bool("outputCompress", false, "Gzip rotated output files")
+	outFsync := flag.String("outputFsync", "never", "When to fsync -outputFile: always|interval|never")
+	outFsyncInterval := flag.Duration("outputFsyncInterval", time.Second, "Minimum time between output fsyncs with -outputFsync=interval")
 	logLevel := flag.String("logLevel", "info", "Log level: debug|info|warn|error")
+	logFormat := flag.String("logFormat", "text", "Application log lines on stderr: text|json|none")
+	logOTel := flag.Bool("logOTel", false, "Also send application logs to the OpenTelemetry log exporter (OTEL_LOGS_EXPORTER)")
 	graceful := flag.Duration("gracefulTimeout", 10*time.Second, "Graceful shutdown timeout")
+	temporality := flag.String("temporality", "delta", "Snapshot counts: delta (per window), cumulative (since start or last reset) or both")
+	rollups := flag.String("rollups", "", "Comma-separated rollup tiers as resolution=file, finest first (e.g. 1m=rollup-1m.jsonl,1h=rollup-1h.jsonl)")
+	anomalyFile := flag.String("anomalyFile", "", "If set, write anomaly events (spikes, drops, new and disappeared values) to this JSONL file")
+	anomalyThreshold := flag.Float64("anomalyThreshold", 3, "Absolute z-score at which a value's window count is anomalous")
+	anomalyAlpha := flag.Float64("anomalyAlpha", 0.3, "EWMA smoothing factor for anomaly baselines, in (0,1]")
+	anomalyWarmup := flag.Int("anomalyWarmup", 5, "Windows a baseline needs before it is judged")
+	anomalySeason := flag.Duration("anomalySeason", 0, "Seasonal cycle for anomaly baselines (e.g. 24h), a multiple of -window; 0 disables seasonality")
+	anomalyDisappearAfter := flag.Int("anomalyDisappearAfter", 3, "Consecutive empty windows after which an established value is reported as disappeared")
+	anomalyMinExpected := flag.Float64("anomalyMinExpected", 1, "Ignore values whose baseline mean per window is below this")
+	alertRules := flag.String("alertRules", "", "';'-separated threshold rules evaluated per window, optionally named (e.g. payments=count(foo=payment) > 1000;ratio(__missing__) > 20%)")
+	alertWebhook := flag.String("alertWebhook", "", "URL receiving alert firing/resolved notifications as JSON POSTs; required with -alertRules")
+	httpListenAddr := flag.String("httpListenAddr", "", "If set, serve the JSON/HTTP query API on this address")
+	queryHistory := flag.Int("queryHistory", 60, "Number of closed snapshots kept in memory for the query API")
+	includeValues := flag.String("includeValues", "", "Comma-separated value prefixes to count; empty counts all values")
+	excludeValues := flag.String("excludeValues", "", "Comma-separated value prefixes to ignore")
+	tenant := flag.String("tenant", "", "Optional label stamped on every snapshot as tenant")
+	subscribeBuffer := flag.Int("subscribeBuffer", 16, "Snapshots buffered per streaming subscriber")
+	subscribePolicy := flag.String("subscribePolicy", "drop_oldest", "When a subscriber's buffer is full: drop_oldest|disconnect")
+	missingLabel := flag.String("missingLabel", "__missing__", "Label for records where the attribute key is absent; must start with __")
+	nullLabel := flag.String("nullLabel", "__null__", "Label for records where the attribute value is null or empty; must start with __")
+	unsupportedLabel := flag.String("unsupportedLabel", "__unsupported__", "Label for records where the attribute value type is unsupported; must start with __")
+	publishMaxAttempts := flag.Int("publishMaxAttempts", 3, "Max attempts per snapshot publish, including the first")
+	publishInitialBackoff := flag.Duration("publishInitialBackoff", 200*time.Millisecond, "Backoff before the first publish retry; doubles per retry")
+	publishMaxBackoff := flag.Duration("publishMaxBackoff", 5*time.Second, "Upper bound for the publish retry backoff")
+	publishTimeout := flag.Duration("publishTimeout", 10*time.Second, "Timeout for a single snapshot publish attempt")
+	publishQueue := flag.Int("publishQueue", 64, "Max closed snapshots waiting for delivery; when full, snapshots go straight to the dead-letter file")
+	publishWorkers := flag.Int("publishWorkers", 1, "Number of concurrent snapshot publishers; more than one may deliver windows out of order")
+	deadLetterFile := flag.String("deadLetterFile", "", "If set, append snapshots that exhaust publish retries to this JSONL file")
+	replayDeadLetter := flag.String("replayDeadLetter", "", "If set, re-publish the snapshots in this dead-letter file to the sinks they failed on and exit")
+	otlpMetricsEndpoint := flag.String("otlpMetricsEndpoint", "", "If set, also export snapshots as OTLP metrics to this collector (host:port for grpc, URL for http/protobuf)")
+	otlpMetricsProtocol := flag.String("otlpMetricsProtocol", "grpc", "OTLP metrics transport: grpc|http/protobuf")
+	otlpMetricsHeaders := flag.String("otlpMetricsHeaders", "", "Comma-separated key=value headers sent with every OTLP metrics export")
+	otlpMetricsInsecure := flag.Bool("otlpMetricsInsecure", false, "Use plaintext for an OTLP metrics endpoint given without http:// or https://")
+	forwardEndpoint := flag.String("forwardEndpoint", "", "If set, forward every received request unchanged to this OTLP logs endpoint after counting (host:port for grpc, URL for http/protobuf)")
+	forwardProtocol := flag.String("forwardProtocol", "grpc", "OTLP transport for -forwardEndpoint: grpc|http/protobuf")
+	forwardHeaders := flag.String("forwardHeaders", "", "Comma-separated key=value headers sent with every forwarded request")
+	forwardInsecure := flag.Bool("forwardInsecure", false, "Use plaintext for a forward endpoint given without http:// or https://")
+	forwardQueue := flag.Int("forwardQueue", 256, "Received requests that may wait to be forwarded; when full, clients get RESOURCE_EXHAUSTED")
+	forwardBatchSize := flag.Int("forwardBatchSize", 0, "Merge queued requests into batches of at least this many log records; 0 forwards each request on its own")
+	forwardBatchTimeout := flag.Duration("forwardBatchTimeout", 200*time.Millisecond, "Longest time a partial forward batch waits for more requests")
+	forwardMaxAttempts := flag.Int("forwardMaxAttempts", 5, "Attempts per forwarded request, including the first")
+	forwardTimeout := flag.Duration("forwardTimeout", 10*time.Second, "Timeout of each forward attempt")
+	sampleRatio := flag.Float64("sampleRatio", 1, "Fraction of log records counted and forwarded, in (0, 1]; records of a trace are kept or dropped together")
+	snapshotWebhook := flag.String("snapshotWebhook", "", "If set, also POST every snapshot as JSON to this URL")
+	csvDir := flag.String("csvDir", "", "If set, also write every snapshot as rows of window_start,window_end,key,value,count to rolling CSV files in this directory")
+	parquetDir := flag.String("parquetDir", "", "If set, also write every snapshot as rows of window_start,window_end,key,value,count to rolling Parquet files in this directory")
+	tableMaxRows := flag.Int64("tableMaxRows", 1000000, "Start a new CSV or Parquet file once the current one holds this many rows; 0 disables")
+	tableRollInterval := flag.Duration("tableRollInterval", time.Hour, "Start a new CSV or Parquet file once the current one is this old; 0 disables")
+	parquetRowGroupSize := flag.Int("parquetRowGroupSize", 10000, "Rows per Parquet row group; buffered rows are written when a group is full or the file is finished")
+	parquetCompression := flag.String("parquetCompression", "snappy", "Parquet page compression: none|snappy|gzip|zstd")
+	sinkOptions := flag.String("sinkOptions", "", "Per-sink delivery settings, e.g. 'webhook:queue=128,workers=2,attempts=5,timeout=3s;otlp_metrics:attempts=10'")
+	prometheus := flag.Bool("prometheus", false, "Serve Prometheus metrics on /metrics of -httpListenAddr")
+	prometheusMaxValues := flag.Int("prometheusMaxValues", 1000, "Max attribute value series on /metrics; further values are counted as __overflow__")
+	stateDir := flag.String("stateDir", "", "If set, persist the open window in this directory and resume it after a restart")
+	stateFsync := flag.String("stateFsync", "interval", "When to fsync window state records: always|interval|never")
+	stateFsyncInterval := flag.Duration("stateFsyncInterval", time.Second, "Minimum time between fsyncs with -stateFsync=interval")
 
 	return func() Config {
 		return Config{
@@ -41,8 +234,77 @@ func RegisterFlags() func() Config {
 			MaxQueue:              *maxQueue,
 			OutputFormat:          *outFmt,
 			OutputFile:            *outFile,
+			OutputPretty:          *outPretty,
+			OutputTimeFormat:      *outTimeFormat,
+			OutputMaxSizeMB:       *outMaxSize,
+			OutputRotateInterval:  *outRotateInterval,
+			OutputMaxBackups:      *outMaxBackups,
+			OutputMaxAge:          *outMaxAge,
+			OutputCompress:        *outCompress,
+			OutputFsync:           *outFsync,
+			OutputFsyncInterval:   *outFsyncInterval,
 			LogLevel:              *logLevel,
+			LogFormat:             *logFormat,
+			LogOTel:               *logOTel,
 			GracefulTimeout:       *graceful,
+			Temporality:           *temporality,
+			Rollups:               *rollups,
+			AnomalyFile:           *anomalyFile,
+			AnomalyThreshold:      *anomalyThreshold,
+			AnomalyAlpha:          *anomalyAlpha,
+			AnomalyWarmup:         *anomalyWarmup,
+			AnomalySeason:         *anomalySeason,
+			AnomalyDisappearAfter: *anomalyDisappearAfter,
+			AnomalyMinExpected:    *anomalyMinExpected,
+			AlertRules:            *alertRules,
+			AlertWebhook:          *alertWebhook,
+			HTTPListenAddr:        *httpListenAddr,
+			QueryHistory:          *queryHistory,
+			IncludeValues:         *includeValues,
+			ExcludeValues:         *excludeValues,
+			Tenant:                *tenant,
+			SubscribeBuffer:       *subscribeBuffer,
+			SubscribePolicy:       *subscribePolicy,
+			MissingLabel:          *missingLabel,
+			NullLabel:             *nullLabel,
+			UnsupportedLabel:      *unsupportedLabel,
+			PublishMaxAttempts:    *publishMaxAttempts,
+			PublishInitialBackoff: *publishInitialBackoff,
+			PublishMaxBackoff:     *publishMaxBackoff,
+			PublishTimeout:        *publishTimeout,
+			PublishQueue:          *publishQueue,
+			PublishWorkers:        *publishWorkers,
+			DeadLetterFile:        *deadLetterFile,
+			ReplayDeadLetter:      *replayDeadLetter,
+			OTLPMetricsEndpoint:   *otlpMetricsEndpoint,
+			OTLPMetricsProtocol:   *otlpMetricsProtocol,
+			OTLPMetricsHeaders:    *otlpMetricsHeaders,
+			OTLPMetricsInsecure:   *otlpMetricsInsecure,
+			ForwardEndpoint:       *forwardEndpoint,
+			ForwardProtocol:       *forwardProtocol,
+			ForwardHeaders:        *forwardHeaders,
+			ForwardInsecure:       *forwardInsecure,
+			ForwardQueue:          *forwardQueue,
+			ForwardBatchSize:      *forwardBatchSize,
+			ForwardBatchTimeout:   *forwardBatchTimeout,
+			ForwardMaxAttempts:    *forwardMaxAttempts,
+			ForwardTimeout:        *forwardTimeout,
+			SampleRatio:           *sampleRatio,
+			SnapshotWebhook:       *snapshotWebhook,
+			CSVDir:                *csvDir,
+			ParquetDir:            *parquetDir,
+			TableMaxRows:          *tableMaxRows,
+			TableRollInterval:     *tableRollInterval,
+			ParquetRowGroupSize:   *parquetRowGroupSize,
+			ParquetCompression:    *parquetCompression,
+			SinkOptions:           *sinkOptions,
+			Prometheus:            *prometheus,
+			PrometheusMaxValues:   *prometheusMaxValues,
+			StateDir:              *stateDir,
+			StateFsync:            *stateFsync,
+			StateFsyncInterval:    *stateFsyncInterval,
+			ConfigFile:            *configFile,
+			ValidateConfig:        *validateConfig,
 		}
 	}
 }
@@ -24,6 +24,12 @@ func TestRegisterFlags_Defaults(t *testing.T) {
 	require.Equal(t, 16*1024*1024, cfg.MaxReceiveMessageSize)
 	require.NotEmpty(t, cfg.AttributeKey)
 	require.Greater(t, cfg.Window, time.Duration(0))
+	require.Equal(t, "delta", cfg.Temporality)
+	require.Equal(t, 16, cfg.SubscribeBuffer)
+	require.Equal(t, "drop_oldest", cfg.SubscribePolicy)
+	require.Equal(t, "__missing__", cfg.MissingLabel)
+	require.Equal(t, "__null__", cfg.NullLabel)
+	require.Equal(t, "__unsupported__", cfg.UnsupportedLabel)
 }
 
 func TestRegisterFlags_Overrides(t *testing.T) {
@@ -0,0 +1,359 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables overriding config file settings,
+// e.g. OTLP_PROCESSOR_AGGREGATION_WINDOW for aggregation.window.
+const EnvPrefix = "OTLP_PROCESSOR_"
+
+// binding maps a config file path onto the flag holding its value. Lists and
+// mappings are joined with sep into the flag's own syntax, mapping entries as
+// key=value.
+type binding struct {
+	path       string
+	flag       string
+	sep        string
+	reloadable bool
+}
+
+var bindings = []binding{
+	{path: "listeners.otlp.addr", flag: "listenAddr"},
+	{path: "listeners.otlp.max_receive_message_size", flag: "maxReceiveMessageSize"},
+	{path: "listeners.http.addr", flag: "httpListenAddr"},
+
+	{path: "aggregation.attribute_key", flag: "attributeKey", reloadable: true},
+	{path: "aggregation.window", flag: "window", reloadable: true},
+	{path: "aggregation.max_queue", flag: "maxQueue", reloadable: true},
+	{path: "aggregation.include_values", flag: "includeValues", sep: ",", reloadable: true},
+	{path: "aggregation.exclude_values", flag: "excludeValues", sep: ",", reloadable: true},
+	{path: "aggregation.temporality", flag: "temporality"},
+	{path: "aggregation.tenant", flag: "tenant"},
+	{path: "aggregation.labels.missing", flag: "missingLabel"},
+	{path: "aggregation.labels.null", flag: "nullLabel"},
+	{path: "aggregation.labels.unsupported", flag: "unsupportedLabel"},
+
+	{path: "sinks.output.format", flag: "outputFormat"},
+	{path: "sinks.output.file", flag: "outputFile"},
+	{path: "sinks.output.pretty", flag: "outputPretty"},
+	{path: "sinks.output.time_format", flag: "outputTimeFormat"},
+	{path: "sinks.output.max_size_mb", flag: "outputMaxSizeMB"},
+	{path: "sinks.output.rotate_interval", flag: "outputRotateInterval"},
+	{path: "sinks.output.max_backups", flag: "outputMaxBackups"},
+	{path: "sinks.output.max_age", flag: "outputMaxAge"},
+	{path: "sinks.output.compress", flag: "outputCompress"},
+	{path: "sinks.output.fsync", flag: "outputFsync"},
+	{path: "sinks.output.fsync_interval", flag: "outputFsyncInterval"},
+	{path: "sinks.dead_letter_file", flag: "deadLetterFile"},
+	{path: "sinks.publish.max_attempts", flag: "publishMaxAttempts"},
+	{path: "sinks.publish.initial_backoff", flag: "publishInitialBackoff"},
+	{path: "sinks.publish.max_backoff", flag: "publishMaxBackoff"},
+	{path: "sinks.publish.timeout", flag: "publishTimeout"},
+	{path: "sinks.publish.queue", flag: "publishQueue"},
+	{path: "sinks.publish.workers", flag: "publishWorkers"},
+	{path: "sinks.subscriptions.buffer", flag: "subscribeBuffer"},
+	{path: "sinks.subscriptions.policy", flag: "subscribePolicy"},
+	{path: "sinks.otlp_metrics.endpoint", flag: "otlpMetricsEndpoint"},
+	{path: "sinks.otlp_metrics.protocol", flag: "otlpMetricsProtocol"},
+	{path: "sinks.otlp_metrics.headers", flag: "otlpMetricsHeaders", sep: ","},
+	{path: "sinks.otlp_metrics.insecure", flag: "otlpMetricsInsecure"},
+	{path: "sinks.webhook.url", flag: "snapshotWebhook"},
+	{path: "sinks.csv.dir", flag: "csvDir"},
+	{path: "sinks.parquet.dir", flag: "parquetDir"},
+	{path: "sinks.parquet.row_group_size", flag: "parquetRowGroupSize"},
+	{path: "sinks.parquet.compression", flag: "parquetCompression"},
+	{path: "sinks.table.max_rows", flag: "tableMaxRows"},
+	{path: "sinks.table.roll_interval", flag: "tableRollInterval"},
+	{path: "sinks.options", flag: "sinkOptions", sep: ";"},
+
+	{path: "forward.endpoint", flag: "forwardEndpoint"},
+	{path: "forward.protocol", flag: "forwardProtocol"},
+	{path: "forward.headers", flag: "forwardHeaders", sep: ","},
+	{path: "forward.insecure", flag: "forwardInsecure"},
+	{path: "forward.queue", flag: "forwardQueue"},
+	{path: "forward.batch_size", flag: "forwardBatchSize"},
+	{path: "forward.batch_timeout", flag: "forwardBatchTimeout"},
+	{path: "forward.max_attempts", flag: "forwardMaxAttempts"},
+	{path: "forward.timeout", flag: "forwardTimeout"},
+	{path: "forward.sample_ratio", flag: "sampleRatio"},
+
+	{path: "pipelines.rollups", flag: "rollups", sep: ","},
+	{path: "pipelines.anomaly.file", flag: "anomalyFile"},
+	{path: "pipelines.anomaly.threshold", flag: "anomalyThreshold"},
+	{path: "pipelines.anomaly.alpha", flag: "anomalyAlpha"},
+	{path: "pipelines.anomaly.warmup", flag: "anomalyWarmup"},
+	{path: "pipelines.anomaly.season", flag: "anomalySeason"},
+	{path: "pipelines.anomaly.disappear_after", flag: "anomalyDisappearAfter"},
+	{path: "pipelines.anomaly.min_expected", flag: "anomalyMinExpected"},
+	{path: "pipelines.alerts.rules", flag: "alertRules", sep: ";"},
+	{path: "pipelines.alerts.webhook", flag: "alertWebhook"},
+	{path: "pipelines.query.history", flag: "queryHistory"},
+
+	{path: "state.dir", flag: "stateDir"},
+	{path: "state.fsync", flag: "stateFsync"},
+	{path: "state.fsync_interval", flag: "stateFsyncInterval"},
+
+	{path: "telemetry.prometheus.enabled", flag: "prometheus"},
+	{path: "telemetry.prometheus.max_values", flag: "prometheusMaxValues"},
+
+	{path: "log.level", flag: "logLevel", reloadable: true},
+	{path: "log.format", flag: "logFormat"},
+	{path: "log.otel", flag: "logOTel"},
+	{path: "shutdown.graceful_timeout", flag: "gracefulTimeout"},
+}
+
+// fileKey returns the config file path of a flag, or "" if it has none.
+func fileKey(flag string) string {
+	for _, b := range bindings {
+		if b.flag == flag {
+			return b.path
+		}
+	}
+
+	return ""
+}
+
+func lookupBinding(path string) (binding, bool) {
+	for _, b := range bindings {
+		if b.path == path {
+			return b, true
+		}
+	}
+
+	return binding{}, false
+}
+
+// Reloadable reports whether a change to the config file path can be applied
+// without a restart.
+func Reloadable(path string) bool {
+	b, ok := lookupBinding(path)
+	return ok && b.reloadable
+}
+
+// EnvName returns the environment variable overriding the config file path.
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// Loader layers defaults, the config file, environment variables and command
+// line flags, in increasing precedence, and validates the result. It can be
+// called again to reload; flags set on the command line keep winning.
+type Loader struct {
+	fs        *flag.FlagSet
+	read      func() Config
+	cli       map[string]bool
+	lookupEnv func(string) (string, bool)
+	validate  func(Config) error
+	last      map[string]string
+}
+
+// NewLoader returns a loader for the flags registered by RegisterFlags on fs.
+// It must be created after fs has been parsed.
+func NewLoader(fs *flag.FlagSet, read func() Config) *Loader {
+	l := &Loader{fs: fs, read: read, cli: make(map[string]bool), lookupEnv: os.LookupEnv, validate: Validate}
+	fs.Visit(func(f *flag.Flag) { l.cli[f.Name] = true })
+
+	return l
+}
+
+// SetValidator replaces Validate with fn, e.g. to also check the settings
+// parsed by the components. fn should include Validate.
+func (l *Loader) SetValidator(fn func(Config) error) { l.validate = fn }
+
+// Load reads the config file named by -config, if any, applies environment
+// overrides and validates the result. It returns the config file paths whose
+// value changed since the previous successful Load. On error the previous
+// settings are kept.
+func (l *Loader) Load() (Config, []string, error) {
+	prev := l.values()
+
+	if err := l.apply(); err != nil {
+		l.restore(prev)
+		return Config{}, nil, err
+	}
+
+	cfg := l.read()
+	if err := l.validate(cfg); err != nil {
+		l.restore(prev)
+		return Config{}, nil, err
+	}
+
+	now := l.values()
+
+	var changed []string
+
+	if l.last != nil {
+		for _, b := range bindings {
+			if now[b.flag] != l.last[b.flag] {
+				changed = append(changed, b.path)
+			}
+		}
+	}
+
+	l.last = now
+
+	return cfg, changed, nil
+}
+
+func (l *Loader) apply() error {
+	// Start over from the defaults so that settings removed from the file revert.
+	for _, b := range bindings {
+		if f := l.fs.Lookup(b.flag); f != nil && !l.cli[b.flag] {
+			if err := f.Value.Set(f.DefValue); err != nil {
+				return err
+			}
+		}
+	}
+
+	if path := l.read().ConfigFile; path != "" {
+		if err := l.applyFile(path); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+
+	for _, b := range bindings {
+		name := EnvName(b.path)
+		if v, ok := l.lookupEnv(name); ok && !l.cli[b.flag] {
+			if err := l.fs.Set(b.flag, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", name, v, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *Loader) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	var doc yaml.Node
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: the top level must be a mapping of sections", path)
+	}
+
+	var errs []error
+
+	walk(doc.Content[0], "", func(key string, k, n *yaml.Node) {
+		pos := fmt.Sprintf("%s:%d:%d", path, k.Line, k.Column)
+
+		b, ok := lookupBinding(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", pos, key))
+			return
+		}
+
+		v, err := scalar(n, b.sep)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", pos, key, err))
+			return
+		}
+
+		if n.Tag == "!!null" || l.cli[b.flag] {
+			return
+		}
+
+		if err := l.fs.Set(b.flag, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: invalid value %q: %w", pos, key, v, err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// walk calls fn with the dotted path, key node and value node of every leaf
+// of mapping n. A mapping is a leaf when its path is bound to a list setting.
+func walk(n *yaml.Node, prefix string, fn func(path string, key, val *yaml.Node)) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+
+		path := k.Value
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		if b, ok := lookupBinding(path); v.Kind != yaml.MappingNode || (ok && b.sep != "") {
+			fn(path, k, v)
+			continue
+		}
+
+		walk(v, path, fn)
+	}
+}
+
+// scalar renders n in flag syntax. Sequences are joined with sep and mapping
+// entries become key=value, keeping their order.
+func scalar(n *yaml.Node, sep string) (string, error) {
+	switch {
+	case n.Kind == yaml.ScalarNode:
+		return n.Value, nil
+	case sep != "" && n.Kind == yaml.SequenceNode:
+		parts := make([]string, 0, len(n.Content))
+		for _, c := range n.Content {
+			if c.Kind != yaml.ScalarNode {
+				return "", errors.New("list entries must be scalars")
+			}
+
+			parts = append(parts, c.Value)
+		}
+
+		return strings.Join(parts, sep), nil
+	case sep != "" && n.Kind == yaml.MappingNode:
+		parts := make([]string, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i+1].Kind != yaml.ScalarNode {
+				return "", errors.New("mapping values must be scalars")
+			}
+
+			parts = append(parts, n.Content[i].Value+"="+n.Content[i+1].Value)
+		}
+
+		return strings.Join(parts, sep), nil
+	case sep != "":
+		return "", errors.New("want a scalar, list or mapping")
+	default:
+		return "", errors.New("want a scalar value")
+	}
+}
+
+func (l *Loader) values() map[string]string {
+	out := make(map[string]string, len(bindings))
+	for _, b := range bindings {
+		if f := l.fs.Lookup(b.flag); f != nil {
+			out[b.flag] = f.Value.String()
+		}
+	}
+
+	return out
+}
+
+func (l *Loader) restore(vals map[string]string) {
+	for name, v := range vals {
+		_ = l.fs.Set(name, v)
+	}
+}
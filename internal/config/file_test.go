@@ -0,0 +1,159 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newLoader registers the flags on a fresh FlagSet, parses args and returns a
+// loader reading env from the given map.
+func newLoader(t *testing.T, env map[string]string, args ...string) *Loader {
+	t.Helper()
+
+	orig := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+
+	t.Cleanup(func() { flag.CommandLine = orig })
+
+	read := RegisterFlags()
+	require.NoError(t, flag.CommandLine.Parse(args))
+
+	l := NewLoader(flag.CommandLine, read)
+	l.lookupEnv = func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	return l
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestBindings_FlagsExist(t *testing.T) {
+	orig := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+
+	t.Cleanup(func() { flag.CommandLine = orig })
+
+	RegisterFlags()
+
+	for _, b := range bindings {
+		require.NotNil(t, flag.CommandLine.Lookup(b.flag), b.path)
+	}
+}
+
+func TestLoader_Precedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+listeners:
+  otlp:
+    addr: 0.0.0.0:4317
+aggregation:
+  attribute_key: service.name
+  window: 30s
+  exclude_values: [debug-, test-]
+  labels:
+    missing: __none
+pipelines:
+  rollups:
+    1m: rollup-1m.jsonl
+    1h: rollup-1h.jsonl
+  alerts:
+    rules:
+      busy: total > 100
+    webhook: http://localhost/hook
+`)
+	env := map[string]string{"OTLP_PROCESSOR_AGGREGATION_WINDOW": "1m", "OTLP_PROCESSOR_AGGREGATION_MAX_QUEUE": "5"}
+
+	cfg, changed, err := newLoader(t, env, "-config", path, "-maxQueue", "7").Load()
+	require.NoError(t, err)
+	require.Nil(t, changed)
+
+	require.Equal(t, "0.0.0.0:4317", cfg.ListenAddr)
+	require.Equal(t, "service.name", cfg.AttributeKey)
+	require.Equal(t, time.Minute, cfg.Window, "env overrides the file")
+	require.Equal(t, 7, cfg.MaxQueue, "flags override env")
+	require.Equal(t, "debug-,test-", cfg.ExcludeValues)
+	require.Equal(t, "__none", cfg.MissingLabel)
+	require.Equal(t, "1m=rollup-1m.jsonl,1h=rollup-1h.jsonl", cfg.Rollups)
+	require.Equal(t, "busy=total > 100", cfg.AlertRules)
+	require.Equal(t, "__null__", cfg.NullLabel, "unset settings keep their defaults")
+}
+
+func TestLoader_JSON(t *testing.T) {
+	path := writeFile(t, "config.json", `{"aggregation": {"attribute_key": "k", "window": "5s"}, "log": {"level": "debug", "format": "json", "otel": true}}`)
+
+	cfg, _, err := newLoader(t, nil, "-config", path).Load()
+	require.NoError(t, err)
+	require.Equal(t, "k", cfg.AttributeKey)
+	require.Equal(t, 5*time.Second, cfg.Window)
+	require.Equal(t, "debug", cfg.LogLevel)
+	require.Equal(t, "json", cfg.LogFormat)
+	require.True(t, cfg.LogOTel)
+}
+
+func TestLoader_Errors(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+aggregation:
+  windw: 30s
+  max_queue: lots
+  attribute_key: [a, b]
+`)
+
+	_, _, err := newLoader(t, nil, "-config", path).Load()
+	require.ErrorContains(t, err, path+":3:3: unknown setting \"aggregation.windw\"")
+	require.ErrorContains(t, err, path+":4:3: aggregation.max_queue: invalid value \"lots\"")
+	require.ErrorContains(t, err, path+":5:3: aggregation.attribute_key: want a scalar value")
+
+	_, _, err = newLoader(t, map[string]string{"OTLP_PROCESSOR_AGGREGATION_WINDOW": "soon"}).Load()
+	require.ErrorContains(t, err, "OTLP_PROCESSOR_AGGREGATION_WINDOW: invalid value \"soon\"")
+
+	_, _, err = newLoader(t, nil, "-config", filepath.Join(t.TempDir(), "missing.yaml")).Load()
+	require.ErrorContains(t, err, "read config")
+
+	_, _, err = newLoader(t, nil, "-config", writeFile(t, "config.yaml", "aggregation: [")).Load()
+	require.ErrorContains(t, err, "parse config")
+
+	path = writeFile(t, "config.yaml", "aggregation:\n  window: 0s\n")
+	_, _, err = newLoader(t, nil, "-config", path).Load()
+	require.ErrorContains(t, err, "-window (aggregation.window): must be positive")
+}
+
+func TestLoader_Reload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "aggregation:\n  window: 30s\n  tenant: a\n")
+	l := newLoader(t, nil, "-config", path)
+
+	_, _, err := l.Load()
+	require.NoError(t, err)
+
+	// Removed settings revert to their defaults.
+	require.NoError(t, os.WriteFile(path, []byte("aggregation:\n  attribute_key: bar\n"), 0o600))
+
+	cfg, changed, err := l.Load()
+	require.NoError(t, err)
+	require.Equal(t, []string{"aggregation.attribute_key", "aggregation.window", "aggregation.tenant"}, changed)
+	require.Equal(t, 10*time.Second, cfg.Window)
+	require.Empty(t, cfg.Tenant)
+
+	// A broken file leaves the previous settings in place.
+	require.NoError(t, os.WriteFile(path, []byte("aggregation:\n  window: -1s\n"), 0o600))
+
+	_, _, err = l.Load()
+	require.Error(t, err)
+	require.Equal(t, "bar", l.read().AttributeKey)
+	require.Equal(t, 10*time.Second, l.read().Window)
+
+	require.True(t, Reloadable("aggregation.window"))
+	require.False(t, Reloadable("listeners.otlp.addr"))
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Validate checks settings that are wrong regardless of how the rest of the
+// configuration looks, reporting every problem at once. Settings parsed by
+// the components themselves, such as alert rules, are checked there.
+func Validate(cfg Config) error {
+	var errs []error
+
+	check := func(ok bool, flag, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("-%s (%s): %s", flag, fileKey(flag), fmt.Sprintf(format, args...)))
+		}
+	}
+
+	oneOf := func(flag, v string, allowed ...string) {
+		check(slices.Contains(allowed, v), flag, "got %q, want one of %v", v, allowed)
+	}
+
+	check(cfg.ListenAddr != "", "listenAddr", "must not be empty")
+	check(cfg.MaxReceiveMessageSize > 0, "maxReceiveMessageSize", "must be positive, got %d", cfg.MaxReceiveMessageSize)
+	check(cfg.AttributeKey != "", "attributeKey", "must not be empty")
+	check(cfg.Window > 0, "window", "must be positive, got %s", cfg.Window)
+	check(cfg.MaxQueue >= 0, "maxQueue", "must not be negative, got %d", cfg.MaxQueue)
+	check(cfg.GracefulTimeout >= 0, "gracefulTimeout", "must not be negative, got %s", cfg.GracefulTimeout)
+	oneOf("outputTimeFormat", cfg.OutputTimeFormat, "", "unix_ms", "rfc3339", "rfc3339nano")
+	oneOf("outputFsync", cfg.OutputFsync, "always", "interval", "never")
+	check(cfg.OutputMaxSizeMB >= 0, "outputMaxSizeMB", "must not be negative, got %d", cfg.OutputMaxSizeMB)
+	check(cfg.OutputRotateInterval >= 0, "outputRotateInterval", "must not be negative, got %s", cfg.OutputRotateInterval)
+	check(cfg.OutputMaxBackups >= 0, "outputMaxBackups", "must not be negative, got %d", cfg.OutputMaxBackups)
+	check(cfg.OutputMaxAge >= 0, "outputMaxAge", "must not be negative, got %s", cfg.OutputMaxAge)
+	oneOf("logLevel", cfg.LogLevel, "debug", "info", "warn", "error")
+	oneOf("logFormat", cfg.LogFormat, "", "text", "json", "none")
+	oneOf("temporality", cfg.Temporality, "delta", "cumulative", "both")
+	oneOf("subscribePolicy", cfg.SubscribePolicy, "drop_oldest", "disconnect")
+	oneOf("otlpMetricsProtocol", cfg.OTLPMetricsProtocol, "grpc", "http/protobuf")
+	check(cfg.TableMaxRows >= 0, "tableMaxRows", "must not be negative, got %d", cfg.TableMaxRows)
+	check(cfg.TableRollInterval >= 0, "tableRollInterval", "must not be negative, got %s", cfg.TableRollInterval)
+	check(cfg.ParquetRowGroupSize >= 0, "parquetRowGroupSize", "must not be negative, got %d", cfg.ParquetRowGroupSize)
+	oneOf("parquetCompression", cfg.ParquetCompression, "none", "snappy", "gzip", "zstd")
+	oneOf("forwardProtocol", cfg.ForwardProtocol, "grpc", "http/protobuf")
+	check(cfg.ForwardQueue >= 0, "forwardQueue", "must not be negative, got %d", cfg.ForwardQueue)
+	check(cfg.ForwardBatchSize >= 0, "forwardBatchSize", "must not be negative, got %d", cfg.ForwardBatchSize)
+	check(cfg.ForwardBatchTimeout >= 0, "forwardBatchTimeout", "must not be negative, got %s", cfg.ForwardBatchTimeout)
+	check(cfg.ForwardMaxAttempts >= 0, "forwardMaxAttempts", "must not be negative, got %d", cfg.ForwardMaxAttempts)
+	check(cfg.ForwardTimeout >= 0, "forwardTimeout", "must not be negative, got %s", cfg.ForwardTimeout)
+	check(cfg.SampleRatio > 0 && cfg.SampleRatio <= 1, "sampleRatio", "must be in (0,1], got %g", cfg.SampleRatio)
+	oneOf("stateFsync", cfg.StateFsync, "always", "interval", "never")
+	check(cfg.QueryHistory >= 0, "queryHistory", "must not be negative, got %d", cfg.QueryHistory)
+	check(cfg.SubscribeBuffer >= 0, "subscribeBuffer", "must not be negative, got %d", cfg.SubscribeBuffer)
+	check(cfg.PublishMaxAttempts >= 0, "publishMaxAttempts", "must not be negative, got %d", cfg.PublishMaxAttempts)
+	check(cfg.PublishInitialBackoff >= 0, "publishInitialBackoff", "must not be negative, got %s", cfg.PublishInitialBackoff)
+	check(cfg.PublishMaxBackoff >= 0, "publishMaxBackoff", "must not be negative, got %s", cfg.PublishMaxBackoff)
+	check(cfg.PublishTimeout >= 0, "publishTimeout", "must not be negative, got %s", cfg.PublishTimeout)
+	check(cfg.PublishQueue >= 0, "publishQueue", "must not be negative, got %d", cfg.PublishQueue)
+	check(cfg.PublishWorkers >= 0, "publishWorkers", "must not be negative, got %d", cfg.PublishWorkers)
+	check(cfg.AnomalyAlpha > 0 && cfg.AnomalyAlpha <= 1, "anomalyAlpha", "must be in (0,1], got %g", cfg.AnomalyAlpha)
+	check(cfg.AnomalyThreshold > 0, "anomalyThreshold", "must be positive, got %g", cfg.AnomalyThreshold)
+	check(cfg.AnomalyWarmup >= 0, "anomalyWarmup", "must not be negative, got %d", cfg.AnomalyWarmup)
+	check(cfg.AnomalySeason >= 0, "anomalySeason", "must not be negative, got %s", cfg.AnomalySeason)
+	check(cfg.AnomalySeason == 0 || cfg.Window <= 0 || cfg.AnomalySeason%cfg.Window == 0,
+		"anomalySeason", "%s must be a whole multiple of -window %s", cfg.AnomalySeason, cfg.Window)
+	check(!cfg.Prometheus || cfg.HTTPListenAddr != "", "prometheus", "requires -httpListenAddr")
+	check(cfg.PrometheusMaxValues >= 0, "prometheusMaxValues", "must not be negative, got %d", cfg.PrometheusMaxValues)
+	check(cfg.AlertRules == "" || cfg.AlertWebhook != "", "alertRules", "requires -alertWebhook")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() Config {
+	return Config{
+		ListenAddr:            "localhost:4317",
+		MaxReceiveMessageSize: 1024,
+		AttributeKey:          "foo",
+		Window:                time.Second,
+		OutputFormat:          "json",
+		LogLevel:              "info",
+		Temporality:           "delta",
+		SubscribePolicy:       "drop_oldest",
+		StateFsync:            "interval",
+		OutputFsync:           "never",
+		OTLPMetricsProtocol:   "grpc",
+		ForwardProtocol:       "grpc",
+		SampleRatio:           1,
+		ParquetCompression:    "snappy",
+		AnomalyAlpha:          0.3,
+		AnomalyThreshold:      3,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(validConfig()))
+
+	cfg := validConfig()
+	cfg.AttributeKey = ""
+	cfg.Window = 0
+	cfg.MaxQueue = -1
+	cfg.Temporality = "hourly"
+	cfg.AlertRules = "total > 1"
+	cfg.OTLPMetricsProtocol = "http/json"
+	cfg.Prometheus = true
+	cfg.OutputMaxBackups = -1
+	cfg.SampleRatio = 0
+	cfg.ParquetCompression = "brotli"
+
+	err := Validate(cfg)
+	require.ErrorContains(t, err, "-attributeKey (aggregation.attribute_key): must not be empty")
+	require.ErrorContains(t, err, "-window (aggregation.window): must be positive, got 0s")
+	require.ErrorContains(t, err, "-maxQueue (aggregation.max_queue): must not be negative, got -1")
+	require.ErrorContains(t, err, `-temporality (aggregation.temporality): got "hourly", want one of [delta cumulative both]`)
+	require.ErrorContains(t, err, "-alertRules (pipelines.alerts.rules): requires -alertWebhook")
+	require.ErrorContains(t, err, "-outputMaxBackups (sinks.output.max_backups): must not be negative, got -1")
+	require.ErrorContains(t, err, "-prometheus (telemetry.prometheus.enabled): requires -httpListenAddr")
+	require.ErrorContains(t, err, `-otlpMetricsProtocol (sinks.otlp_metrics.protocol): got "http/json"`)
+	require.ErrorContains(t, err, "-sampleRatio (forward.sample_ratio): must be in (0,1], got 0")
+	require.ErrorContains(t, err, `-parquetCompression (sinks.parquet.compression): got "brotli"`)
+
+	cfg = validConfig()
+	cfg.AnomalySeason = 90 * time.Second
+	cfg.Window = time.Minute
+	require.ErrorContains(t, Validate(cfg), "whole multiple of -window")
+}
@@ -0,0 +1,200 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"dash0.com/otlp-log-processor-backend/internal/metricsink"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// maxErrorBody bounds how much of an HTTP error response ends up in the error.
+const maxErrorBody = 256
+
+// throttleError is a failure the upstream asked to retry no sooner than delay.
+type throttleError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e throttleError) Error() string { return e.err.Error() }
+func (e throttleError) Unwrap() error { return e.err }
+
+// throttleDelay returns the delay the upstream asked for, if any.
+func throttleDelay(err error) (time.Duration, bool) {
+	var te throttleError
+	if errors.As(err, &te) {
+		return te.delay, true
+	}
+
+	return 0, false
+}
+
+type grpcExporter struct {
+	conn   *grpc.ClientConn
+	client collogspb.LogsServiceClient
+	md     metadata.MD
+}
+
+func newGRPCExporter(o Options) (*grpcExporter, error) {
+	target, plain, ok := metricsink.SplitScheme(o.Endpoint)
+	if !ok {
+		plain = o.Insecure
+	}
+
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if plain {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("forward endpoint %q: %w", o.Endpoint, err)
+	}
+
+	return &grpcExporter{conn: conn, client: collogspb.NewLogsServiceClient(conn), md: metadata.New(o.Headers)}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	if len(e.md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.md)
+	}
+
+	resp, err := e.client.Export(ctx, req)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+
+	return resp.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (e *grpcExporter) close() error { return e.conn.Close() }
+
+// grpcError classifies an export failure as the OTLP specification does:
+// RESOURCE_EXHAUSTED is only retried when the upstream says when, other
+// transient codes always are.
+func grpcError(err error) error {
+	st := status.Convert(err)
+
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.GetRetryDelay() != nil {
+			return throttleError{err: err, delay: ri.GetRetryDelay().AsDuration()}
+		}
+	}
+
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return err
+	default:
+		return sink.Permanent(err)
+	}
+}
+
+type httpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPExporter(o Options) (*httpExporter, error) {
+	endpoint := o.Endpoint
+	if _, _, ok := metricsink.SplitScheme(endpoint); !ok {
+		scheme := "https://"
+		if o.Insecure {
+			scheme = "http://"
+		}
+
+		endpoint = scheme + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("forward endpoint %q: want a URL or host:port", o.Endpoint)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/logs"
+	}
+
+	return &httpExporter{url: u.String(), headers: o.Headers, client: &http.Client{}}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return 0, sink.Permanent(fmt.Errorf("encode logs: %w", err))
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, sink.Permanent(err)
+	}
+
+	hreq.Header.Set("Content-Type", "application/x-protobuf")
+
+	for k, v := range e.headers {
+		hreq.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(hreq)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("upstream responded %d: %s", resp.StatusCode, strings.TrimSpace(string(data[:min(len(data), maxErrorBody)])))
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && secs >= 0 {
+				return 0, throttleError{err: err, delay: time.Duration(secs) * time.Second}
+			}
+
+			return 0, err
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return 0, err
+		default:
+			return 0, sink.Permanent(err)
+		}
+	}
+
+	var out collogspb.ExportLogsServiceResponse
+	if len(data) > 0 && resp.Header.Get("Content-Type") == "application/x-protobuf" {
+		if err := proto.Unmarshal(data, &out); err != nil {
+			return 0, fmt.Errorf("decode upstream response: %w", err)
+		}
+	}
+
+	return out.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package forward relays received OTLP log requests to an upstream OTLP
+// endpoint, so the processor can sit inline in front of a collector.
+//
+// Requests wait in a bounded queue for a single sender, which keeps their
+// order. Optionally queued requests are merged into batches; either way the
+// resource, scope and log records are forwarded as received.
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+
+	"dash0.com/otlp-log-processor-backend/internal/metricsink"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// DefaultQueueSize is the number of requests that may await forwarding.
+const DefaultQueueSize = 256
+
+// DefaultBatchTimeout is how long a partial batch waits for more requests.
+const DefaultBatchTimeout = 200 * time.Millisecond
+
+// Options configure a Forwarder. Endpoint, Protocol, Headers and Insecure
+// follow the conventions of metricsink.Options; an HTTP URL without a path is
+// sent to /v1/logs.
+type Options struct {
+	Endpoint string
+	Protocol metricsink.Protocol
+	Headers  map[string]string
+	Insecure bool
+	// QueueSize bounds the requests waiting to be sent; 0 means DefaultQueueSize.
+	QueueSize int
+	// BatchSize merges queued requests until a batch holds at least this many
+	// log records or BatchTimeout passed; 0 sends every request on its own.
+	BatchSize    int
+	BatchTimeout time.Duration
+	// Retry bounds the attempts per request and their backoff.
+	Retry sink.RetryPolicy
+}
+
+// exporter sends one request and returns the number of log records the
+// upstream rejected. Failures that retrying cannot fix are marked with
+// sink.Permanent.
+type exporter interface {
+	export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error)
+	close() error
+}
+
+// Forwarder queues requests and sends them upstream in the background.
+type Forwarder struct {
+	opts   Options
+	exp    exporter
+	logger *slog.Logger
+	queue  chan *collogspb.ExportLogsServiceRequest
+
+	// closed guards queue against sends after Close.
+	mu     sync.RWMutex
+	closed bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	onResult func(forwarded, failed int64)
+}
+
+// New returns a forwarder to o.Endpoint. No connection is made until the first
+// request is sent.
+func New(o Options, logger *slog.Logger) (*Forwarder, error) {
+	if o.Endpoint == "" {
+		return nil, errors.New("forward endpoint must not be empty")
+	}
+
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+
+	if o.BatchTimeout <= 0 {
+		o.BatchTimeout = DefaultBatchTimeout
+	}
+
+	var (
+		exp exporter
+		err error
+	)
+
+	switch o.Protocol {
+	case "", metricsink.ProtocolGRPC:
+		exp, err = newGRPCExporter(o)
+	case metricsink.ProtocolHTTP:
+		exp, err = newHTTPExporter(o)
+	default:
+		err = fmt.Errorf("invalid OTLP protocol %q: want grpc|http/protobuf", o.Protocol)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Forwarder{
+		opts:   o,
+		exp:    exp,
+		logger: logger,
+		queue:  make(chan *collogspb.ExportLogsServiceRequest, o.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// SetResultCallback installs an optional callback with the number of log
+// records forwarded and given up on, once per sent request or batch. Must be
+// called before Start.
+func (f *Forwarder) SetResultCallback(fn func(forwarded, failed int64)) { f.onResult = fn }
+
+// Start starts the sender.
+func (f *Forwarder) Start() {
+	f.wg.Add(1)
+
+	go f.run()
+}
+
+// Forward queues req without blocking and reports whether there was room. req
+// must not be modified afterwards.
+func (f *Forwarder) Forward(req *collogspb.ExportLogsServiceRequest) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return false
+	}
+
+	select {
+	case f.queue <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+// QueueLen returns the number of requests waiting to be sent.
+func (f *Forwarder) QueueLen() int { return len(f.queue) }
+
+// Close stops accepting requests and sends the queued ones. When ctx is done
+// first, pending retries are abandoned and the remaining requests dropped.
+func (f *Forwarder) Close(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		f.cancel()
+		<-done
+	}
+
+	f.cancel()
+
+	return f.exp.close()
+}
+
+func (f *Forwarder) run() {
+	defer f.wg.Done()
+
+	for req := range f.queue {
+		if f.ctx.Err() != nil {
+			f.report(0, Records(req))
+			continue
+		}
+
+		if f.opts.BatchSize <= 0 {
+			f.send(req, Records(req))
+			continue
+		}
+
+		batch, n, open := f.collect(req)
+		f.send(batch, n)
+
+		if !open {
+			return
+		}
+	}
+}
+
+// collect adds queued requests to first until the batch holds BatchSize
+// records or BatchTimeout passed. open is false once the queue is closed.
+func (f *Forwarder) collect(first *collogspb.ExportLogsServiceRequest) (batch *collogspb.ExportLogsServiceRequest, n int64, open bool) {
+	reqs := []*collogspb.ExportLogsServiceRequest{first}
+	n = Records(first)
+
+	timer := time.NewTimer(f.opts.BatchTimeout)
+	defer timer.Stop()
+
+	for n < int64(f.opts.BatchSize) {
+		select {
+		case req, ok := <-f.queue:
+			if !ok {
+				return merge(reqs), n, false
+			}
+
+			reqs = append(reqs, req)
+			n += Records(req)
+		case <-timer.C:
+			return merge(reqs), n, true
+		}
+	}
+
+	return merge(reqs), n, true
+}
+
+// send exports req with retries. Throttled attempts wait at least as long as
+// the upstream asked for.
+func (f *Forwarder) send(req *collogspb.ExportLogsServiceRequest, n int64) {
+	attempts := max(f.opts.Retry.MaxAttempts, 1)
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		var rejected int64
+
+		if rejected, err = f.exportOnce(req); err == nil {
+			if rejected > 0 {
+				f.logger.Warn("upstream rejected forwarded log records", slog.Int64("rejected", rejected))
+			}
+
+			f.report(n-rejected, rejected)
+
+			return
+		}
+
+		if sink.IsPermanent(err) || attempt >= attempts {
+			break
+		}
+
+		delay := f.opts.Retry.Backoff(attempt)
+		if d, ok := throttleDelay(err); ok {
+			delay = max(delay, d)
+		}
+
+		f.logger.Warn("retrying log forward", slog.String("err", err.Error()), slog.Int("retry", attempt), slog.Duration("delay", delay))
+
+		t := time.NewTimer(delay)
+		select {
+		case <-f.ctx.Done():
+			t.Stop()
+		case <-t.C:
+		}
+
+		if f.ctx.Err() != nil {
+			break
+		}
+	}
+
+	f.logger.Error("failed to forward logs; records dropped", slog.String("err", err.Error()), slog.Int64("records", n))
+	f.report(0, n)
+}
+
+func (f *Forwarder) exportOnce(req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	ctx := f.ctx
+	if f.opts.Retry.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, f.opts.Retry.Timeout)
+		defer cancel()
+	}
+
+	return f.exp.export(ctx, req)
+}
+
+func (f *Forwarder) report(forwarded, failed int64) {
+	if f.onResult != nil {
+		f.onResult(forwarded, failed)
+	}
+}
+
+// merge concatenates the resource logs of reqs into one request.
+func merge(reqs []*collogspb.ExportLogsServiceRequest) *collogspb.ExportLogsServiceRequest {
+	if len(reqs) == 1 {
+		return reqs[0]
+	}
+
+	out := &collogspb.ExportLogsServiceRequest{}
+	for _, r := range reqs {
+		out.ResourceLogs = append(out.ResourceLogs, r.GetResourceLogs()...)
+	}
+
+	return out
+}
+
+// Records returns the number of log records in req.
+func Records(req *collogspb.ExportLogsServiceRequest) int64 {
+	var n int64
+
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			n += int64(len(sl.GetLogRecords()))
+		}
+	}
+
+	return n
+}
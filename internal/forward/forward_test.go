@@ -0,0 +1,239 @@
+package forward
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"dash0.com/otlp-log-processor-backend/internal/metricsink"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// fakeUpstream is an in-process OTLP logs receiver answering with the queued
+// errors before accepting.
+type fakeUpstream struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu       sync.Mutex
+	reqs     []*collogspb.ExportLogsServiceRequest
+	failures []error
+	at       []time.Time
+}
+
+func (u *fakeUpstream) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.at = append(u.at, time.Now())
+
+	if len(u.failures) > 0 {
+		err := u.failures[0]
+		u.failures = u.failures[1:]
+
+		return nil, err
+	}
+
+	u.reqs = append(u.reqs, req)
+
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func (u *fakeUpstream) received() []*collogspb.ExportLogsServiceRequest {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]*collogspb.ExportLogsServiceRequest(nil), u.reqs...)
+}
+
+func startUpstream(t *testing.T, u *fakeUpstream) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, u)
+
+	go func() { _ = srv.Serve(lis) }()
+
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func request(names ...string) *collogspb.ExportLogsServiceRequest {
+	recs := make([]*logspb.LogRecord, 0, len(names))
+	for _, name := range names {
+		recs = append(recs, &logspb.LogRecord{EventName: name})
+	}
+
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{ScopeLogs: []*logspb.ScopeLogs{{LogRecords: recs}}}}}
+}
+
+type results struct {
+	mu                sync.Mutex
+	forwarded, failed int64
+}
+
+func (r *results) add(forwarded, failed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.forwarded += forwarded
+	r.failed += failed
+}
+
+func (r *results) get() (int64, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.forwarded, r.failed
+}
+
+func newForwarder(t *testing.T, o Options) (*Forwarder, *results) {
+	t.Helper()
+
+	f, err := New(o, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	res := &results{}
+	f.SetResultCallback(res.add)
+	f.Start()
+
+	return f, res
+}
+
+func TestForwarder_ForwardsUnchanged(t *testing.T) {
+	up := &fakeUpstream{}
+	f, res := newForwarder(t, Options{Endpoint: startUpstream(t, up), Insecure: true, Retry: sink.RetryPolicy{MaxAttempts: 1}})
+
+	req := request("a", "b")
+	require.True(t, f.Forward(req))
+	require.NoError(t, f.Close(context.Background()))
+
+	require.Len(t, up.received(), 1)
+	require.True(t, proto.Equal(req, up.received()[0]))
+
+	forwarded, failed := res.get()
+	require.EqualValues(t, 2, forwarded)
+	require.Zero(t, failed)
+
+	require.False(t, f.Forward(req), "closed")
+}
+
+func TestForwarder_Batches(t *testing.T) {
+	up := &fakeUpstream{}
+	f, _ := newForwarder(t, Options{Endpoint: startUpstream(t, up), Insecure: true, BatchSize: 3, BatchTimeout: time.Hour})
+
+	require.True(t, f.Forward(request("a")))
+	require.True(t, f.Forward(request("b", "c")))
+	require.True(t, f.Forward(request("d")))
+	require.Eventually(t, func() bool { return len(up.received()) == 1 }, 2*time.Second, time.Millisecond)
+
+	// The batch closed at three records; the rest goes out on Close.
+	require.NoError(t, f.Close(context.Background()))
+
+	got := up.received()
+	require.Len(t, got, 2)
+	require.Len(t, got[0].GetResourceLogs(), 2)
+	require.EqualValues(t, 3, Records(got[0]))
+	require.Equal(t, "d", got[1].GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()[0].GetEventName())
+}
+
+func TestForwarder_ResourceExhausted(t *testing.T) {
+	throttled, err := status.New(codes.ResourceExhausted, "slow down").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(50 * time.Millisecond)})
+	require.NoError(t, err)
+
+	up := &fakeUpstream{failures: []error{throttled.Err()}}
+	f, res := newForwarder(t, Options{Endpoint: startUpstream(t, up), Insecure: true, Retry: sink.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+
+	// Retried no sooner than the upstream asked.
+	require.True(t, f.Forward(request("a")))
+	require.Eventually(t, func() bool { forwarded, _ := res.get(); return forwarded == 1 }, 2*time.Second, time.Millisecond)
+
+	up.mu.Lock()
+	require.GreaterOrEqual(t, up.at[1].Sub(up.at[0]), 50*time.Millisecond)
+	up.failures = []error{status.Error(codes.ResourceExhausted, "no hint")}
+	up.mu.Unlock()
+
+	// Without a retry delay RESOURCE_EXHAUSTED is final.
+	require.True(t, f.Forward(request("b")))
+	require.Eventually(t, func() bool { _, failed := res.get(); return failed == 1 }, 2*time.Second, time.Millisecond)
+
+	require.NoError(t, f.Close(context.Background()))
+	require.Len(t, up.received(), 1)
+}
+
+func TestForwarder_QueueFull(t *testing.T) {
+	f, err := New(Options{Endpoint: "127.0.0.1:1", Insecure: true, QueueSize: 1}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	// Not started, so nothing drains the queue.
+	require.True(t, f.Forward(request("a")))
+	require.False(t, f.Forward(request("b")))
+	require.Equal(t, 1, f.QueueLen())
+}
+
+func TestForwarder_HTTP(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+		got   collogspb.ExportLogsServiceRequest
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.Equal(t, "/v1/logs", r.URL.Path)
+		require.Equal(t, "secret", r.Header.Get("authorization"))
+
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, proto.Unmarshal(body, &got))
+	}))
+	defer srv.Close()
+
+	f, res := newForwarder(t, Options{
+		Endpoint: srv.URL,
+		Protocol: metricsink.ProtocolHTTP,
+		Headers:  map[string]string{"authorization": "secret"},
+		Retry:    sink.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+
+	require.True(t, f.Forward(request("a")))
+	require.NoError(t, f.Close(context.Background()))
+
+	forwarded, _ := res.get()
+	require.EqualValues(t, 1, forwarded)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, 2, calls)
+	require.True(t, proto.Equal(request("a"), &got))
+}
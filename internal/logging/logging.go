@@ -0,0 +1,180 @@
+// Package logging builds the application logger: a text or JSON handler on
+// stderr, optionally teed to the OpenTelemetry log bridge, behind one level
+// that can change at runtime.
+//
+// Snapshots go to stdout, so the application logs never share a stream with
+// them.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+)
+
+// Format is the encoding of the log lines written to stderr.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	// FormatNone writes nothing to stderr, e.g. when logs only go to the
+	// OpenTelemetry bridge.
+	FormatNone Format = "none"
+)
+
+// ParseFormat parses text, json or none; "" means text.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON, FormatNone:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid log format %q: want text|json|none", s)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error, in any case.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q: want debug|info|warn|error", s)
+	}
+}
+
+// LevelName returns the name of l as accepted by ParseLevel, e.g. "warn".
+// Levels in between are named like "info+2".
+func LevelName(l slog.Level) string {
+	return strings.ToLower(l.String())
+}
+
+// Options configure New.
+type Options struct {
+	// Level is the minimum level of every handler; nil means info. A
+	// *slog.LevelVar changes it at runtime.
+	Level  slog.Leveler
+	Format Format
+	// Writer receives the formatted lines; nil means os.Stderr.
+	Writer io.Writer
+	// OTel also sends each record to the OpenTelemetry log bridge under the
+	// instrumentation scope Name, to be exported like the other signals.
+	OTel bool
+	Name string
+}
+
+// New returns a logger writing as opts describe.
+func New(opts Options) (*slog.Logger, error) {
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+
+	if opts.Writer == nil {
+		opts.Writer = os.Stderr
+	}
+
+	var handlers []slog.Handler
+
+	hopts := &slog.HandlerOptions{Level: opts.Level}
+
+	switch opts.Format {
+	case FormatText, "":
+		handlers = append(handlers, slog.NewTextHandler(opts.Writer, hopts))
+	case FormatJSON:
+		handlers = append(handlers, slog.NewJSONHandler(opts.Writer, hopts))
+	case FormatNone:
+	default:
+		return nil, fmt.Errorf("invalid log format %q: want text|json|none", opts.Format)
+	}
+
+	if opts.OTel {
+		handlers = append(handlers, levelHandler{level: opts.Level, h: otelslog.NewHandler(opts.Name)})
+	}
+
+	if len(handlers) == 1 {
+		return slog.New(handlers[0]), nil
+	}
+
+	return slog.New(teeHandler(handlers)), nil
+}
+
+// levelHandler drops records below level before they reach h, for handlers
+// without a level of their own such as the OpenTelemetry bridge.
+type levelHandler struct {
+	level slog.Leveler
+	h     slog.Handler
+}
+
+func (l levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= l.level.Level() && l.h.Enabled(ctx, level)
+}
+
+func (l levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return l.h.Handle(ctx, r)
+}
+
+func (l levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{level: l.level, h: l.h.WithAttrs(attrs)}
+}
+
+func (l levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{level: l.level, h: l.h.WithGroup(name)}
+}
+
+// teeHandler hands each record to every handler enabled for its level. With
+// no handlers it discards everything.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+
+	return out
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// recorder collects the records exported through the OpenTelemetry bridge.
+type recorder struct{ bodies []string }
+
+func (r *recorder) OnEmit(_ context.Context, rec *sdklog.Record) error {
+	r.bodies = append(r.bodies, rec.Body().AsString())
+	return nil
+}
+
+func (r *recorder) Shutdown(context.Context) error { return nil }
+
+func (r *recorder) ForceFlush(context.Context) error { return nil }
+
+func TestNew_LevelChangesAtRuntime(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		level slog.LevelVar
+	)
+
+	logger, err := New(Options{Level: &level, Format: FormatJSON, Writer: &buf})
+	require.NoError(t, err)
+
+	logger.Debug("hidden")
+	logger.Info("shown", "n", 1)
+	require.JSONEq(t, `{"level":"INFO","msg":"shown","n":1}`, withoutTime(t, buf.Bytes()))
+
+	buf.Reset()
+	level.Set(slog.LevelDebug)
+	logger.Debug("now shown")
+	require.Contains(t, buf.String(), `"msg":"now shown"`)
+}
+
+func TestNew_TeeToOTel(t *testing.T) {
+	rec := &recorder{}
+
+	prev := global.GetLoggerProvider()
+	global.SetLoggerProvider(sdklog.NewLoggerProvider(sdklog.WithProcessor(rec)))
+
+	t.Cleanup(func() { global.SetLoggerProvider(prev) })
+
+	var (
+		buf   bytes.Buffer
+		level slog.LevelVar
+	)
+
+	level.Set(slog.LevelWarn)
+
+	logger, err := New(Options{Level: &level, Format: FormatText, Writer: &buf, OTel: true, Name: "test"})
+	require.NoError(t, err)
+
+	logger = logger.With("component", "x")
+	logger.Info("dropped by both")
+	logger.Warn("kept by both")
+
+	require.Equal(t, []string{"kept by both"}, rec.bodies)
+	require.Contains(t, buf.String(), `level=WARN msg="kept by both" component=x`)
+	require.NotContains(t, buf.String(), "dropped")
+
+	// Without a stderr handler, only the bridge receives records.
+	buf.Reset()
+
+	logger, err = New(Options{Level: &level, Format: FormatNone, Writer: &buf, OTel: true, Name: "test"})
+	require.NoError(t, err)
+	logger.Error("bridge only")
+	require.Empty(t, buf.String())
+	require.Equal(t, []string{"kept by both", "bridge only"}, rec.bodies)
+}
+
+func TestParse(t *testing.T) {
+	l, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelWarn, l)
+	require.Equal(t, "warn", LevelName(l))
+
+	_, err = ParseLevel("trace")
+	require.Error(t, err)
+
+	f, err := ParseFormat("")
+	require.NoError(t, err)
+	require.Equal(t, FormatText, f)
+
+	_, err = ParseFormat("logfmt")
+	require.Error(t, err)
+}
+
+// withoutTime returns the JSON line in b without its time field.
+func withoutTime(t *testing.T, b []byte) string {
+	t.Helper()
+
+	i := bytes.Index(b, []byte(`"level"`))
+	require.Positive(t, i)
+
+	return "{" + string(bytes.TrimSpace(b[i:]))
+}
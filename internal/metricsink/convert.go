@@ -0,0 +1,115 @@
+package metricsink
+
+import (
+	"sort"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Names of the exported metrics. MetricCount has one data point per attribute
+// value, labeled with the snapshot's attribute key; the reserved buckets use
+// their configured labels.
+const (
+	MetricCount   = "logs.window.count"
+	MetricTotal   = "logs.window.total"
+	MetricDropped = "logs.window.dropped"
+)
+
+// scopeName identifies the processor as the instrumentation scope.
+const scopeName = "dash0.com/otlp-log-processor-backend"
+
+// Request converts snap into an OTLP export request of monotonic Sums. Delta
+// snapshots cover their window; cumulative ones start at snap.StartTime. The
+// tenant, if any, becomes a resource attribute.
+func Request(snap sink.Snapshot, service string) *colmetricspb.ExportMetricsServiceRequest {
+	var res []*commonpb.KeyValue
+	if service != "" {
+		res = append(res, stringAttr("service.name", service))
+	}
+
+	if snap.Tenant != "" {
+		res = append(res, stringAttr("tenant", snap.Tenant))
+	}
+
+	temporality := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	start := snap.WindowStart
+
+	if snap.Temporality == sink.TemporalityCumulative {
+		temporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		start = snap.StartTime
+	}
+
+	point := func(n uint64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+		return &metricspb.NumberDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: millisToNanos(start),
+			TimeUnixNano:      millisToNanos(snap.WindowEnd),
+			Value:             &metricspb.NumberDataPoint_AsInt{AsInt: int64(n)},
+		}
+	}
+
+	sum := func(name, desc string, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+		return &metricspb.Metric{
+			Name:        name,
+			Description: desc,
+			Unit:        "{record}",
+			Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				DataPoints:             points,
+				AggregationTemporality: temporality,
+				IsMonotonic:            true,
+			}},
+		}
+	}
+
+	counts := snap.LabeledCounts()
+
+	values := make([]string, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+
+	sort.Strings(values)
+
+	points := make([]*metricspb.NumberDataPoint, 0, len(values))
+	for _, v := range values {
+		points = append(points, point(counts[v], stringAttr(snap.AttributeKey, v)))
+	}
+
+	metrics := make([]*metricspb.Metric, 0, 3)
+	if len(points) > 0 {
+		metrics = append(metrics, sum(MetricCount, "Log records per value of the aggregated attribute", points...))
+	}
+
+	metrics = append(metrics,
+		sum(MetricTotal, "Log records aggregated", point(snap.Total)),
+		sum(MetricDropped, "Log records dropped before aggregation", point(snap.Dropped)),
+	)
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: res},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: scopeName},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func millisToNanos(ms int64) uint64 {
+	if ms <= 0 {
+		return 0
+	}
+
+	return uint64(time.UnixMilli(ms).UnixNano())
+}
@@ -0,0 +1,81 @@
+package metricsink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestRequest_Delta(t *testing.T) {
+	snap := sink.Snapshot{
+		WindowStart:  1_000,
+		WindowEnd:    11_000,
+		Temporality:  sink.TemporalityDelta,
+		AttributeKey: "foo",
+		Tenant:       "eu-1",
+		Counts:       map[string]uint64{"beta": 2, "alpha": 3},
+		Missing:      1,
+		Labels:       sink.DefaultBucketLabels(),
+		Total:        6,
+		Dropped:      4,
+	}
+
+	req := Request(snap, "processor")
+	rm := req.GetResourceMetrics()[0]
+
+	require.Len(t, rm.GetResource().GetAttributes(), 2)
+	require.Equal(t, "service.name", rm.GetResource().GetAttributes()[0].GetKey())
+	require.Equal(t, "eu-1", rm.GetResource().GetAttributes()[1].GetValue().GetStringValue())
+
+	metrics := rm.GetScopeMetrics()[0].GetMetrics()
+	require.Len(t, metrics, 3)
+	require.Equal(t, MetricCount, metrics[0].GetName())
+
+	sum := metrics[0].GetSum()
+	require.True(t, sum.GetIsMonotonic())
+	require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.GetAggregationTemporality())
+
+	got := map[string]int64{}
+	for _, p := range sum.GetDataPoints() {
+		require.Equal(t, "foo", p.GetAttributes()[0].GetKey())
+		require.EqualValues(t, 1_000_000_000, p.GetStartTimeUnixNano())
+		require.EqualValues(t, 11_000_000_000, p.GetTimeUnixNano())
+
+		got[p.GetAttributes()[0].GetValue().GetStringValue()] = p.GetAsInt()
+	}
+
+	require.Equal(t, map[string]int64{"alpha": 3, "beta": 2, "__missing__": 1}, got)
+	require.Equal(t, "__missing__", sum.GetDataPoints()[0].GetAttributes()[0].GetValue().GetStringValue())
+
+	require.Equal(t, MetricTotal, metrics[1].GetName())
+	require.EqualValues(t, 6, metrics[1].GetSum().GetDataPoints()[0].GetAsInt())
+	require.Empty(t, metrics[1].GetSum().GetDataPoints()[0].GetAttributes())
+	require.Equal(t, MetricDropped, metrics[2].GetName())
+	require.EqualValues(t, 4, metrics[2].GetSum().GetDataPoints()[0].GetAsInt())
+}
+
+func TestRequest_CumulativeAndEmpty(t *testing.T) {
+	snap := sink.Snapshot{
+		WindowStart:  5_000,
+		WindowEnd:    6_000,
+		StartTime:    1_000,
+		Temporality:  sink.TemporalityCumulative,
+		AttributeKey: "foo",
+	}
+
+	req := Request(snap, "")
+	rm := req.GetResourceMetrics()[0]
+	require.Empty(t, rm.GetResource().GetAttributes())
+
+	// Without values there is no count series, but total and dropped remain.
+	metrics := rm.GetScopeMetrics()[0].GetMetrics()
+	require.Len(t, metrics, 2)
+	require.Equal(t, MetricTotal, metrics[0].GetName())
+
+	sum := metrics[0].GetSum()
+	require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.GetAggregationTemporality())
+	require.EqualValues(t, 1_000_000_000, sum.GetDataPoints()[0].GetStartTimeUnixNano())
+}
@@ -0,0 +1,165 @@
+package metricsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// maxErrorBody bounds how much of an HTTP error response ends up in the error.
+const maxErrorBody = 256
+
+type grpcExporter struct {
+	conn   *grpc.ClientConn
+	client colmetricspb.MetricsServiceClient
+	md     metadata.MD
+}
+
+func newGRPCExporter(o Options) (*grpcExporter, error) {
+	target, plain, ok := SplitScheme(o.Endpoint)
+	if !ok {
+		plain = o.Insecure
+	}
+
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if plain {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("OTLP metrics endpoint %q: %w", o.Endpoint, err)
+	}
+
+	return &grpcExporter{conn: conn, client: colmetricspb.NewMetricsServiceClient(conn), md: metadata.New(o.Headers)}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsPartialSuccess, error) {
+	if len(e.md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.md)
+	}
+
+	resp, err := e.client.Export(ctx, req)
+	if err != nil {
+		if retryableCode(status.Code(err)) {
+			return nil, err
+		}
+
+		return nil, sink.Permanent(err)
+	}
+
+	return resp.GetPartialSuccess(), nil
+}
+
+func (e *grpcExporter) close() error { return e.conn.Close() }
+
+// retryableCode follows the OTLP specification's list of transient codes.
+func retryableCode(c codes.Code) bool {
+	switch c {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+type httpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPExporter(o Options) (*httpExporter, error) {
+	endpoint := o.Endpoint
+	if _, _, ok := SplitScheme(endpoint); !ok {
+		scheme := "https://"
+		if o.Insecure {
+			scheme = "http://"
+		}
+
+		endpoint = scheme + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("OTLP metrics endpoint %q: want a URL or host:port", o.Endpoint)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+
+	return &httpExporter{url: u.String(), headers: o.Headers, client: &http.Client{}}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsPartialSuccess, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, sink.Permanent(fmt.Errorf("encode metrics: %w", err))
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, sink.Permanent(err)
+	}
+
+	hreq.Header.Set("Content-Type", "application/x-protobuf")
+
+	for k, v := range e.headers {
+		hreq.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("collector responded %d: %s", resp.StatusCode, strings.TrimSpace(string(data[:min(len(data), maxErrorBody)])))
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nil, err
+		default:
+			return nil, sink.Permanent(err)
+		}
+	}
+
+	var out colmetricspb.ExportMetricsServiceResponse
+	if len(data) > 0 && resp.Header.Get("Content-Type") == "application/x-protobuf" {
+		if err := proto.Unmarshal(data, &out); err != nil {
+			return nil, fmt.Errorf("decode collector response: %w", err)
+		}
+	}
+
+	return out.GetPartialSuccess(), nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package metricsink publishes snapshots as OTLP metrics to a downstream
+// collector over OTLP/gRPC or OTLP/HTTP.
+package metricsink
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Protocol selects the OTLP transport.
+type Protocol string
+
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http/protobuf"
+)
+
+// ParseProtocol parses grpc|http/protobuf; "" means grpc.
+func ParseProtocol(s string) (Protocol, error) {
+	switch Protocol(s) {
+	case "", ProtocolGRPC:
+		return ProtocolGRPC, nil
+	case ProtocolHTTP:
+		return ProtocolHTTP, nil
+	default:
+		return "", fmt.Errorf("invalid OTLP protocol %q: want grpc|http/protobuf", s)
+	}
+}
+
+// ParseHeaders parses comma-separated key=value pairs, e.g.
+// "authorization=Bearer abc,dash0-dataset=logs".
+func ParseHeaders(s string) (map[string]string, error) {
+	out := make(map[string]string)
+
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(part, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, fmt.Errorf("invalid header %q: want key=value", part)
+		}
+
+		out[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+
+	return out, nil
+}
+
+// Options configure a Sink.
+type Options struct {
+	// Endpoint is host:port for gRPC, or the base URL for HTTP; a URL without
+	// a path is sent to /v1/metrics. An http:// or https:// scheme overrides
+	// Insecure.
+	Endpoint string
+	Protocol Protocol
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string
+	// Insecure disables TLS for endpoints given without a scheme.
+	Insecure bool
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+}
+
+// exporter delivers one export request and returns the collector's partial
+// success, if any. Failures that retrying cannot fix are marked with
+// sink.Permanent.
+type exporter interface {
+	export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsPartialSuccess, error)
+	close() error
+}
+
+// Sink converts each snapshot into an OTLP export request; see Request. It
+// does not retry itself: the aggregator retries failed publishes and stops
+// early on rejections the collector reports as permanent.
+type Sink struct {
+	exp     exporter
+	service string
+
+	onPartial func(rejected int64, msg string)
+}
+
+// New returns a sink exporting to o.Endpoint. No connection is made until the
+// first publish.
+func New(o Options) (*Sink, error) {
+	if o.Endpoint == "" {
+		return nil, fmt.Errorf("OTLP metrics endpoint must not be empty")
+	}
+
+	var (
+		exp exporter
+		err error
+	)
+
+	switch o.Protocol {
+	case "", ProtocolGRPC:
+		exp, err = newGRPCExporter(o)
+	case ProtocolHTTP:
+		exp, err = newHTTPExporter(o)
+	default:
+		err = fmt.Errorf("invalid OTLP protocol %q: want grpc|http/protobuf", o.Protocol)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sink{exp: exp, service: o.ServiceName}, nil
+}
+
+// SetPartialSuccessCallback installs fn, called with the collector's partial
+// success when it rejected data points or sent a warning. Must be called
+// before the first publish.
+func (s *Sink) SetPartialSuccessCallback(fn func(rejected int64, msg string)) { s.onPartial = fn }
+
+// Publish exports snap as metrics. A partial success counts as delivered:
+// the collector would reject the same data points again, so they are only
+// reported to the partial success callback.
+func (s *Sink) Publish(ctx context.Context, snap sink.Snapshot) error {
+	ps, err := s.exp.export(ctx, Request(snap, s.service))
+	if err != nil {
+		return err
+	}
+
+	if (ps.GetRejectedDataPoints() > 0 || ps.GetErrorMessage() != "") && s.onPartial != nil {
+		s.onPartial(ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+
+	return nil
+}
+
+// Close releases the connection to the collector.
+func (s *Sink) Close() error { return s.exp.close() }
+
+// SplitScheme strips an http:// or https:// scheme from an OTLP endpoint and
+// reports whether it asks for plaintext. ok is false when there is no scheme.
+func SplitScheme(endpoint string) (rest string, insecure, ok bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return endpoint, false, false
+	}
+
+	return u.Host, u.Scheme == "http", true
+}
@@ -0,0 +1,212 @@
+package metricsink
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// fakeCollector is an in-process OTLP metrics receiver answering with the
+// queued errors or partial successes before accepting.
+type fakeCollector struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	reqs     []*colmetricspb.ExportMetricsServiceRequest
+	auth     []string
+	failures []error
+	partial  *colmetricspb.ExportMetricsPartialSuccess
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.auth = append(c.auth, md.Get("authorization")...)
+
+	if len(c.failures) > 0 {
+		err := c.failures[0]
+		c.failures = c.failures[1:]
+
+		return nil, err
+	}
+
+	c.reqs = append(c.reqs, req)
+
+	return &colmetricspb.ExportMetricsServiceResponse{PartialSuccess: c.partial}, nil
+}
+
+func (c *fakeCollector) received() []*colmetricspb.ExportMetricsServiceRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*colmetricspb.ExportMetricsServiceRequest(nil), c.reqs...)
+}
+
+func startGRPCCollector(t *testing.T, c *fakeCollector) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(srv, c)
+
+	go func() { _ = srv.Serve(lis) }()
+
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func testSnapshot() sink.Snapshot {
+	return sink.Snapshot{
+		WindowStart:  1_000,
+		WindowEnd:    2_000,
+		AttributeKey: "foo",
+		Counts:       map[string]uint64{"alpha": 2},
+		Total:        2,
+	}
+}
+
+func TestSink_GRPC(t *testing.T) {
+	c := &fakeCollector{failures: []error{status.Error(codes.Unavailable, "starting")}}
+	addr := startGRPCCollector(t, c)
+
+	s, err := New(Options{Endpoint: addr, Insecure: true, Headers: map[string]string{"authorization": "Bearer t"}, ServiceName: "processor"})
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	// Unavailable is transient: the retry loop tries again.
+	p := sink.RetryPolicy{MaxAttempts: 3}
+	require.NoError(t, sink.PublishWithRetry(context.Background(), s, testSnapshot(), p, nil))
+
+	reqs := c.received()
+	require.Len(t, reqs, 1)
+	require.Equal(t, MetricCount, reqs[0].GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()[0].GetName())
+	require.Equal(t, []string{"Bearer t", "Bearer t"}, c.auth)
+}
+
+func TestSink_GRPCPermanentErrors(t *testing.T) {
+	c := &fakeCollector{failures: []error{status.Error(codes.InvalidArgument, "bad")}}
+	addr := startGRPCCollector(t, c)
+
+	s, err := New(Options{Endpoint: "http://" + addr})
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	p := sink.RetryPolicy{MaxAttempts: 3}
+	err = sink.PublishWithRetry(context.Background(), s, testSnapshot(), p, nil)
+	require.True(t, sink.IsPermanent(err))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+}
+
+func TestSink_GRPCPartialSuccessIsDelivered(t *testing.T) {
+	c := &fakeCollector{partial: &colmetricspb.ExportMetricsPartialSuccess{RejectedDataPoints: 1, ErrorMessage: "too old"}}
+	addr := startGRPCCollector(t, c)
+
+	s, err := New(Options{Endpoint: "http://" + addr})
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	var (
+		rejected int64
+		msg      string
+	)
+
+	s.SetPartialSuccessCallback(func(n int64, m string) { rejected, msg = n, m })
+
+	// Retrying would only be rejected again, so the publish succeeds.
+	require.NoError(t, s.Publish(context.Background(), testSnapshot()))
+	require.EqualValues(t, 1, rejected)
+	require.Equal(t, "too old", msg)
+	require.Len(t, c.received(), 1)
+}
+
+func TestSink_HTTP(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		calls    int
+		received colmetricspb.ExportMetricsServiceRequest
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		require.Equal(t, "/v1/metrics", r.URL.Path)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "logs", r.Header.Get("Dash0-Dataset"))
+
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, proto.Unmarshal(body, &received))
+
+		if calls == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("malformed"))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Endpoint: srv.URL, Protocol: ProtocolHTTP, Headers: map[string]string{"dash0-dataset": "logs"}})
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	p := sink.RetryPolicy{MaxAttempts: 3}
+	require.NoError(t, sink.PublishWithRetry(context.Background(), s, testSnapshot(), p, nil))
+	require.Len(t, received.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics(), 3)
+
+	err = sink.PublishWithRetry(context.Background(), s, testSnapshot(), p, nil)
+	require.True(t, sink.IsPermanent(err))
+	require.EqualError(t, err, "collector responded 400: malformed")
+	require.Equal(t, 3, calls)
+}
+
+func TestParseHeadersAndProtocol(t *testing.T) {
+	h, err := ParseHeaders("Authorization=Bearer a=b, dash0-dataset=logs,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"authorization": "Bearer a=b", "dash0-dataset": "logs"}, h)
+
+	_, err = ParseHeaders("novalue")
+	require.Error(t, err)
+
+	p, err := ParseProtocol("")
+	require.NoError(t, err)
+	require.Equal(t, ProtocolGRPC, p)
+
+	_, err = ParseProtocol("http/json")
+	require.Error(t, err)
+
+	_, err = New(Options{})
+	require.Error(t, err)
+}
@@ -13,6 +13,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	aggregator "dash0.com/otlp-log-processor-backend/internal/aggregator"
 	orchestrator "dash0.com/otlp-log-processor-backend/internal/orchestrator"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -41,32 +42,18 @@ func (m *MockOrchestrator) EXPECT() *MockOrchestratorMockRecorder {
 	return m.recorder
 }
 
-// AttributeKey mocks base method.
-func (m *MockOrchestrator) AttributeKey() string {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AttributeKey")
-	ret0, _ := ret[0].(string)
-	return ret0
-}
-
-// AttributeKey indicates an expected call of AttributeKey.
-func (mr *MockOrchestratorMockRecorder) AttributeKey() *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttributeKey", reflect.TypeOf((*MockOrchestrator)(nil).AttributeKey))
-}
-
 // EnqueueBatch mocks base method.
-func (m *MockOrchestrator) EnqueueBatch(values []string) bool {
+func (m *MockOrchestrator) EnqueueBatch(b aggregator.Batch) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EnqueueBatch", values)
+	ret := m.ctrl.Call(m, "EnqueueBatch", b)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // EnqueueBatch indicates an expected call of EnqueueBatch.
-func (mr *MockOrchestratorMockRecorder) EnqueueBatch(values any) *gomock.Call {
+func (mr *MockOrchestratorMockRecorder) EnqueueBatch(b any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueBatch", reflect.TypeOf((*MockOrchestrator)(nil).EnqueueBatch), values)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueBatch", reflect.TypeOf((*MockOrchestrator)(nil).EnqueueBatch), b)
 }
 
 // IncrMetric mocks base method.
@@ -92,3 +79,29 @@ func (mr *MockOrchestratorMockRecorder) RecordDrop(n any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordDrop", reflect.TypeOf((*MockOrchestrator)(nil).RecordDrop), n)
 }
+
+// RecordExportBatch mocks base method.
+func (m *MockOrchestrator) RecordExportBatch(ctx context.Context, n int64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RecordExportBatch", ctx, n)
+}
+
+// RecordExportBatch indicates an expected call of RecordExportBatch.
+func (mr *MockOrchestratorMockRecorder) RecordExportBatch(ctx, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordExportBatch", reflect.TypeOf((*MockOrchestrator)(nil).RecordExportBatch), ctx, n)
+}
+
+// RuntimeConfig mocks base method.
+func (m *MockOrchestrator) RuntimeConfig() aggregator.Settings {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RuntimeConfig")
+	ret0, _ := ret[0].(aggregator.Settings)
+	return ret0
+}
+
+// RuntimeConfig indicates an expected call of RuntimeConfig.
+func (mr *MockOrchestratorMockRecorder) RuntimeConfig() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RuntimeConfig", reflect.TypeOf((*MockOrchestrator)(nil).RuntimeConfig))
+}
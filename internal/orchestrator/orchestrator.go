@@ -4,7 +4,15 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -12,17 +20,39 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 
 	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	"dash0.com/otlp-log-processor-backend/internal/alert"
+	"dash0.com/otlp-log-processor-backend/internal/anomaly"
 	cfgpkg "dash0.com/otlp-log-processor-backend/internal/config"
+	"dash0.com/otlp-log-processor-backend/internal/forward"
+	"dash0.com/otlp-log-processor-backend/internal/metricsink"
+	"dash0.com/otlp-log-processor-backend/internal/query"
+	"dash0.com/otlp-log-processor-backend/internal/rotate"
 	"dash0.com/otlp-log-processor-backend/internal/sink"
+	"dash0.com/otlp-log-processor-backend/internal/subscribe"
+	"dash0.com/otlp-log-processor-backend/internal/tabular"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
 )
 
 const instrumentationName = "dash0.com/otlp-log-processor-backend"
 
+// anomalyQueue is the number of closed windows buffered for the anomaly detector.
+const anomalyQueue = 16
+
+// defaultQueryHistory is the number of closed snapshots kept for the query API when unset.
+const defaultQueryHistory = 60
+
+// defaultSubscribeBuffer is the per-subscriber snapshot buffer when unset.
+const defaultSubscribeBuffer = 16
+
+// alertQueue is the number of closed windows buffered for alert evaluation.
+const alertQueue = 16
+
 type Orchestrator interface {
-	AttributeKey() string
-	EnqueueBatch(values []string) bool
+	RuntimeConfig() aggregator.Settings
+	EnqueueBatch(b aggregator.Batch) bool
 	RecordDrop(n uint64)
 	IncrMetric(ctx context.Context, mt MetricType, n int64)
+	RecordExportBatch(ctx context.Context, n int64)
 }
 
 // orchestratorSvc holds all instance-scoped dependencies and metrics.
@@ -39,9 +69,43 @@ type orchestratorSvc struct {
 	Flushes       otelmetric.Int64Counter
 	PublishFailed otelmetric.Int64Counter
 
+	LogsSampledOut    otelmetric.Int64Counter
+	LogsThrottled     otelmetric.Int64Counter
+	ForwardRecords    otelmetric.Int64Counter
+	ForwardQueueDepth otelmetric.Int64ObservableGauge
+	MetricsRejected   otelmetric.Int64Counter
+
+	QueueDepth       otelmetric.Int64ObservableGauge
+	QueueUtilization otelmetric.Float64ObservableGauge
+	FlushDuration    otelmetric.Float64Histogram
+	WindowValues     otelmetric.Int64Gauge
+	ExportBatchSize  otelmetric.Int64Histogram
+
+	PublishDuration   otelmetric.Float64Histogram
+	PublishQueueDepth otelmetric.Int64ObservableGauge
+	SinkDeliveries    otelmetric.Int64Counter
+	SinkHealthy       otelmetric.Int64ObservableGauge
+	Anomalies         otelmetric.Int64Counter
+	Alerts            otelmetric.Int64Counter
+	SubscriberDrops   otelmetric.Int64Counter
+
 	Aggregator *aggregator.Aggregator
 
-	outSink sink.Sink
+	outSink    sink.Sink
+	extraSinks []namedSink
+	sinkOpts   map[string]aggregator.SinkOptions
+	observers  []func(sink.Snapshot)
+	deadLetter *sink.DeadLetter
+	stateLog   *wal.Log
+	rollupOut  []*os.File
+	anomalyOut *os.File
+	anomalies  *anomaly.Stream
+	alerts     *alert.Manager
+	history    *query.Ring
+	hub        *subscribe.Hub
+	metricsOut *metricsink.Sink
+	tableOut   []*tabular.Sink
+	forwarder  *forward.Forwarder
 
 	aggCancel context.CancelFunc
 }
@@ -54,6 +118,33 @@ func WithSink(s sink.Sink) Option {
 	return func(svc *orchestratorSvc) error { svc.outSink = s; return nil }
 }
 
+// namedSink is a sink added next to the primary one.
+type namedSink struct {
+	name string
+	sink sink.Sink
+}
+
+// WithAdditionalSink delivers every snapshot to s as well, through a queue,
+// workers and retries of its own; -sinkOptions configures them by name.
+func WithAdditionalSink(name string, s sink.Sink) Option {
+	return func(svc *orchestratorSvc) error {
+		svc.extraSinks = append(svc.extraSinks, namedSink{name: name, sink: s})
+		return nil
+	}
+}
+
+// WithWindowObserver registers fn for every closed delta window, see
+// aggregator.AddWindowObserver.
+func WithWindowObserver(fn func(sink.Snapshot)) Option {
+	return func(svc *orchestratorSvc) error { svc.observers = append(svc.observers, fn); return nil }
+}
+
+// WithMeterProvider registers the instruments with mp instead of the global
+// meter provider.
+func WithMeterProvider(mp otelmetric.MeterProvider) Option {
+	return func(svc *orchestratorSvc) error { svc.Meter = mp.Meter(instrumentationName); return nil }
+}
+
 func New(cfg cfgpkg.Config, logger *slog.Logger, opts ...Option) (*orchestratorSvc, error) {
 	s := &orchestratorSvc{
 		Cfg:    cfg,
@@ -62,6 +153,18 @@ func New(cfg cfgpkg.Config, logger *slog.Logger, opts ...Option) (*orchestratorS
 		Meter:  otel.Meter(instrumentationName),
 	}
 
+	// Apply options
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	labels := bucketLabels(cfg)
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
 	var err error
 	if s.LogsReceived, err = s.Meter.Int64Counter(
 		"com.dash0.homeexercise.logs.received",
@@ -87,6 +190,22 @@ func New(cfg cfgpkg.Config, logger *slog.Logger, opts ...Option) (*orchestratorS
 		return nil, err
 	}
 
+	if s.LogsSampledOut, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.logs.sampled_out",
+		otelmetric.WithDescription("The number of logs neither counted nor forwarded because sampling left them out"),
+		otelmetric.WithUnit("{log}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.LogsThrottled, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.logs.throttled",
+		otelmetric.WithDescription("The number of logs refused with RESOURCE_EXHAUSTED because the forward queue was full"),
+		otelmetric.WithUnit("{log}"),
+	); err != nil {
+		return nil, err
+	}
+
 	if s.Flushes, err = s.Meter.Int64Counter(
 		"com.dash0.homeexercise.flushes",
 		otelmetric.WithDescription("Number of aggregation window flushes"),
@@ -103,49 +222,1048 @@ func New(cfg cfgpkg.Config, logger *slog.Logger, opts ...Option) (*orchestratorS
 		return nil, err
 	}
 
-	// Apply options
-	for _, opt := range opts {
-		if err := opt(s); err != nil {
-			return nil, err
-		}
+	if s.PublishDuration, err = s.Meter.Float64Histogram(
+		"com.dash0.homeexercise.publish.duration",
+		otelmetric.WithDescription("Time to deliver a snapshot to a sink, including retries, by sink"),
+		otelmetric.WithUnit("s"),
+		// Retries and slow sinks stretch a delivery to seconds.
+		otelmetric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	); err != nil {
+		return nil, err
 	}
 
-	// Default sink to stdout JSON if not set
+	if s.FlushDuration, err = s.Meter.Float64Histogram(
+		"com.dash0.homeexercise.flush.duration",
+		otelmetric.WithDescription("Time the aggregation loop spends closing a window, excluding delivery"),
+		otelmetric.WithUnit("s"),
+		// A flush only hands the snapshot over, well under a millisecond.
+		otelmetric.WithExplicitBucketBoundaries(0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.ExportBatchSize, err = s.Meter.Int64Histogram(
+		"com.dash0.homeexercise.export.batch.size",
+		otelmetric.WithDescription("Number of log records per accepted Export request"),
+		otelmetric.WithUnit("{log}"),
+		// From single records up to the large batches of SDKs and collectors.
+		otelmetric.WithExplicitBucketBoundaries(1, 10, 50, 100, 250, 512, 1000, 2048, 5000, 10000),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.WindowValues, err = s.Meter.Int64Gauge(
+		"com.dash0.homeexercise.window.values",
+		otelmetric.WithDescription("Number of distinct values counted in the last closed window, excluding the reserved buckets"),
+		otelmetric.WithUnit("{value}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.Anomalies, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.anomalies",
+		otelmetric.WithDescription("Number of anomaly events detected, by kind"),
+		otelmetric.WithUnit("{event}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.Alerts, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.alerts",
+		otelmetric.WithDescription("Number of alert notifications, by status and delivery outcome"),
+		otelmetric.WithUnit("{notification}"),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.SubscriberDrops, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.subscribers.dropped",
+		otelmetric.WithDescription("Snapshots dropped or subscribers disconnected because a subscriber fell behind, by policy"),
+		otelmetric.WithUnit("{event}"),
+	); err != nil {
+		return nil, err
+	}
+
+	// Default sink to stdout in the configured format if not set
 	if s.outSink == nil {
-		s.outSink = sink.NewStdoutJSON()
+		if s.outSink, err = OutputSink(cfg, os.Stdout); err != nil {
+			return nil, err
+		}
 	}
 
 	// Aggregator
 	s.Aggregator = aggregator.New(cfg.Window, cfg.AttributeKey, s.outSink, logger, cfg.MaxQueue)
+	s.Aggregator.SetBucketLabels(labels)
+	s.Aggregator.SetTenant(cfg.Tenant)
+	s.Aggregator.SetValueFilter(aggregator.ValueFilter{Include: ParsePrefixes(cfg.IncludeValues), Exclude: ParsePrefixes(cfg.ExcludeValues)})
+	s.Aggregator.SetRetryPolicy(PublishRetryPolicy(cfg))
+
+	temporalities, err := sink.ParseTemporalities(cfg.Temporality)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Aggregator.SetTemporalities(temporalities)
+
+	if cfg.PublishQueue > 0 || cfg.PublishWorkers > 0 {
+		s.Aggregator.SetPublishQueue(publishQueueSize(cfg), cfg.PublishWorkers)
+	}
 	// Wire aggregator metric callbacks
 	s.Aggregator.SetMetricsCallbacks(
 		func(n int64) { s.IncrMetric(context.Background(), MetricFlushes, n) },
 		func(n int64) { s.IncrMetric(context.Background(), MetricPublishFailed, n) },
 	)
+	s.Aggregator.SetPublishMetrics(func(name string, d time.Duration) {
+		s.PublishDuration.Record(context.Background(), d.Seconds(), otelmetric.WithAttributes(attribute.String("sink", name)))
+	})
+	s.Aggregator.SetFlushMetrics(func(d time.Duration) {
+		s.FlushDuration.Record(context.Background(), d.Seconds())
+	})
+	s.Aggregator.AddWindowObserver(func(snap sink.Snapshot) {
+		s.WindowValues.Record(context.Background(), int64(len(snap.Counts)))
+	})
+
+	if s.QueueDepth, err = s.Meter.Int64ObservableGauge(
+		"com.dash0.homeexercise.queue.depth",
+		otelmetric.WithDescription("Number of events and batches waiting in the ingestion queue"),
+		otelmetric.WithUnit("{entry}"),
+		otelmetric.WithInt64Callback(func(_ context.Context, o otelmetric.Int64Observer) error {
+			o.Observe(int64(s.Aggregator.QueueLen()))
+			return nil
+		}),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.QueueUtilization, err = s.Meter.Float64ObservableGauge(
+		"com.dash0.homeexercise.queue.utilization",
+		otelmetric.WithDescription("Fraction of the ingestion queue capacity in use; at 1 further logs are dropped"),
+		otelmetric.WithUnit("1"),
+		otelmetric.WithFloat64Callback(func(_ context.Context, o otelmetric.Float64Observer) error {
+			o.Observe(s.Aggregator.QueueUtilization())
+			return nil
+		}),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.SinkDeliveries, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.sink.deliveries",
+		otelmetric.WithDescription("Number of snapshot deliveries, by sink and outcome"),
+		otelmetric.WithUnit("{snapshot}"),
+	); err != nil {
+		return nil, err
+	}
+
+	s.Aggregator.SetDeliveryCallback(func(name string, err error) {
+		outcome := "success"
+		if err != nil {
+			outcome = "failure"
+		}
+
+		s.SinkDeliveries.Add(context.Background(), 1, otelmetric.WithAttributes(
+			attribute.String("sink", name), attribute.String("outcome", outcome)))
+	})
+
+	if s.PublishQueueDepth, err = s.Meter.Int64ObservableGauge(
+		"com.dash0.homeexercise.publish.queue.depth",
+		otelmetric.WithDescription("Number of closed snapshots waiting for delivery, by sink"),
+		otelmetric.WithUnit("{snapshot}"),
+		otelmetric.WithInt64Callback(func(_ context.Context, o otelmetric.Int64Observer) error {
+			for _, st := range s.Aggregator.SinkStatuses() {
+				o.Observe(int64(st.QueueLen), otelmetric.WithAttributes(attribute.String("sink", st.Name)))
+			}
+
+			return nil
+		}),
+	); err != nil {
+		return nil, err
+	}
+
+	if s.SinkHealthy, err = s.Meter.Int64ObservableGauge(
+		"com.dash0.homeexercise.sink.healthy",
+		otelmetric.WithDescription("1 while the last delivery to the sink succeeded, 0 after a failed one"),
+		otelmetric.WithInt64Callback(func(_ context.Context, o otelmetric.Int64Observer) error {
+			for _, st := range s.Aggregator.SinkStatuses() {
+				healthy := int64(0)
+				if st.Healthy {
+					healthy = 1
+				}
+
+				o.Observe(healthy, otelmetric.WithAttributes(attribute.String("sink", st.Name)))
+			}
+
+			return nil
+		}),
+	); err != nil {
+		return nil, err
+	}
+
+	s.history = query.NewRing(queryHistory(cfg))
+	s.Aggregator.AddWindowObserver(s.history.Add)
+
+	for _, fn := range s.observers {
+		s.Aggregator.AddWindowObserver(fn)
+	}
+
+	policy, err := subscribe.ParsePolicy(cfg.SubscribePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub = subscribe.NewHub(subscribeBuffer(cfg), policy)
+	s.hub.SetDropCallback(func(p subscribe.Policy) {
+		s.SubscriberDrops.Add(context.Background(), 1, otelmetric.WithAttributes(attribute.String("policy", string(p))))
+	})
+
+	if s.sinkOpts, err = ParseSinkOptions(cfg.SinkOptions, PublishRetryPolicy(cfg)); err != nil {
+		return nil, err
+	}
+
+	if err := s.addSink("subscribers", s.hub); err != nil {
+		return nil, errors.Join(err, s.closeFiles(context.Background()))
+	}
+
+	if cfg.OTLPMetricsEndpoint != "" {
+		if err := s.openMetricsSink(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	if cfg.SnapshotWebhook != "" {
+		if err := s.addSink("webhook", sink.NewWebhook(cfg.SnapshotWebhook)); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	if err := s.openTables(); err != nil {
+		return nil, errors.Join(err, s.closeFiles(context.Background()))
+	}
+
+	for _, e := range s.extraSinks {
+		if err := s.addSink(e.name, e.sink); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	for name := range s.sinkOpts {
+		if !slices.ContainsFunc(s.Aggregator.SinkStatuses(), func(st aggregator.SinkStatus) bool { return st.Name == name }) {
+			return nil, errors.Join(fmt.Errorf("-sinkOptions: no sink named %q", name), s.closeFiles(context.Background()))
+		}
+	}
+
+	if cfg.DeadLetterFile != "" {
+		if s.deadLetter, err = sink.OpenDeadLetter(cfg.DeadLetterFile); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+
+		s.Aggregator.SetDeadLetter(s.deadLetter)
+	}
+
+	if cfg.Rollups != "" {
+		if err := s.openRollups(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	if cfg.AnomalyFile != "" {
+		if err := s.openAnomalies(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	if cfg.AlertRules != "" {
+		if err := s.startAlerts(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	if cfg.StateDir != "" {
+		if err := s.openStateLog(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
+
+	// Last, as the forwarder is only released by Close.
+	if cfg.ForwardEndpoint != "" {
+		if err := s.openForwarder(); err != nil {
+			return nil, errors.Join(err, s.closeFiles(context.Background()))
+		}
+	}
 
 	return s, nil
 }
 
-// Close is a placeholder for future instance-scoped shutdown.
+// Validate checks cfg as a whole, including the settings parsed by the
+// components, without opening any file or starting anything.
+func Validate(cfg cfgpkg.Config) error {
+	errs := []error{cfgpkg.Validate(cfg)}
+
+	if _, err := sink.NewFormatter(cfg.OutputFormat, sink.FormatOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("-outputFormat: %w", err))
+	}
+
+	if specs, err := ParseRollups(cfg.Rollups); err != nil {
+		errs = append(errs, fmt.Errorf("-rollups: %w", err))
+	} else {
+		prev := cfg.Window
+		for _, spec := range specs {
+			if prev <= 0 || spec.Resolution <= prev || spec.Resolution%prev != 0 {
+				errs = append(errs, fmt.Errorf("-rollups: resolution %s must be a whole multiple of %s", spec.Resolution, prev))
+				break
+			}
+
+			prev = spec.Resolution
+		}
+	}
+
+	if cfg.AlertRules != "" {
+		if _, err := alert.ParseRules(cfg.AlertRules); err != nil {
+			errs = append(errs, fmt.Errorf("-alertRules: %w", err))
+		}
+	}
+
+	if _, err := metricsink.ParseHeaders(cfg.OTLPMetricsHeaders); err != nil {
+		errs = append(errs, fmt.Errorf("-otlpMetricsHeaders: %w", err))
+	}
+
+	if _, err := metricsink.ParseHeaders(cfg.ForwardHeaders); err != nil {
+		errs = append(errs, fmt.Errorf("-forwardHeaders: %w", err))
+	}
+
+	if _, err := ParseSinkOptions(cfg.SinkOptions, sink.RetryPolicy{}); err != nil {
+		errs = append(errs, fmt.Errorf("-sinkOptions: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reload applies the reloadable settings of cfg, if they differ from the ones
+// in effect. Other settings only take effect on restart.
+func (s *orchestratorSvc) Reload(ctx context.Context, cfg cfgpkg.Config) error {
+	cur := s.Aggregator.Settings()
+	next := aggregator.Settings{
+		AttributeKey: cfg.AttributeKey,
+		Window:       cfg.Window,
+		MaxQueue:     cfg.MaxQueue,
+		Filter:       aggregator.ValueFilter{Include: ParsePrefixes(cfg.IncludeValues), Exclude: ParsePrefixes(cfg.ExcludeValues)},
+	}
+
+	if next.AttributeKey == cur.AttributeKey && next.Window == cur.Window && next.MaxQueue == cur.MaxQueue &&
+		slices.Equal(next.Filter.Include, cur.Filter.Include) && slices.Equal(next.Filter.Exclude, cur.Filter.Exclude) {
+		return nil
+	}
+
+	_, err := s.Reconfigure(ctx, next)
+
+	return err
+}
+
+// OutputSink returns a sink writing snapshots to w in the configured output
+// format; an empty format means json.
+func OutputSink(cfg cfgpkg.Config, w io.Writer) (sink.Sink, error) {
+	name := cfg.OutputFormat
+	if name == "" {
+		name = "json"
+	}
+
+	tf, err := sink.ParseTimeFormat(cfg.OutputTimeFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := sink.NewFormatter(name, sink.FormatOptions{Pretty: cfg.OutputPretty, TimeFormat: tf})
+	if err != nil {
+		return nil, err
+	}
+
+	return sink.NewWriterSink(w, f), nil
+}
+
+// OutputFileOptions returns the rotation, retention and fsync options for
+// -outputFile.
+func OutputFileOptions(cfg cfgpkg.Config) (rotate.Options, error) {
+	policy, err := wal.ParseFsyncPolicy(cfg.OutputFsync)
+	if err != nil {
+		return rotate.Options{}, err
+	}
+
+	return rotate.Options{
+		Path:          cfg.OutputFile,
+		MaxSize:       int64(cfg.OutputMaxSizeMB) << 20,
+		Interval:      cfg.OutputRotateInterval,
+		MaxBackups:    cfg.OutputMaxBackups,
+		MaxAge:        cfg.OutputMaxAge,
+		Compress:      cfg.OutputCompress,
+		Fsync:         policy,
+		FsyncInterval: cfg.OutputFsyncInterval,
+	}, nil
+}
+
+// TableOptions returns the options of the CSV or Parquet sink writing to dir.
+// CSV timestamps follow -outputTimeFormat.
+func TableOptions(cfg cfgpkg.Config, format tabular.Format, dir string) (tabular.Options, error) {
+	compression, err := tabular.ParseCompression(cfg.ParquetCompression)
+	if err != nil {
+		return tabular.Options{}, err
+	}
+
+	tf, err := sink.ParseTimeFormat(cfg.OutputTimeFormat)
+	if err != nil {
+		return tabular.Options{}, err
+	}
+
+	return tabular.Options{
+		Dir:          dir,
+		Format:       format,
+		MaxRows:      cfg.TableMaxRows,
+		RollInterval: cfg.TableRollInterval,
+		RowGroupSize: cfg.ParquetRowGroupSize,
+		Compression:  compression,
+		TimeFormat:   tf,
+	}, nil
+}
+
+// bucketLabels returns the configured reserved-bucket labels, using the
+// defaults for any left empty.
+func bucketLabels(cfg cfgpkg.Config) sink.BucketLabels {
+	labels := sink.DefaultBucketLabels()
+	if cfg.MissingLabel != "" {
+		labels.Missing = cfg.MissingLabel
+	}
+
+	if cfg.NullLabel != "" {
+		labels.Null = cfg.NullLabel
+	}
+
+	if cfg.UnsupportedLabel != "" {
+		labels.Unsupported = cfg.UnsupportedLabel
+	}
+
+	return labels
+}
+
+// PublishRetryPolicy returns the configured publish retry policy, using the defaults
+// for any setting left at zero.
+func PublishRetryPolicy(cfg cfgpkg.Config) sink.RetryPolicy {
+	p := sink.DefaultRetryPolicy()
+	if cfg.PublishMaxAttempts > 0 {
+		p.MaxAttempts = cfg.PublishMaxAttempts
+	}
+
+	if cfg.PublishInitialBackoff > 0 {
+		p.InitialBackoff = cfg.PublishInitialBackoff
+	}
+
+	if cfg.PublishMaxBackoff > 0 {
+		p.MaxBackoff = cfg.PublishMaxBackoff
+	}
+
+	if cfg.PublishTimeout > 0 {
+		p.Timeout = cfg.PublishTimeout
+	}
+
+	return p
+}
+
+// publishQueueSize returns the configured publish queue size, or the default when unset.
+func publishQueueSize(cfg cfgpkg.Config) int {
+	if cfg.PublishQueue > 0 {
+		return cfg.PublishQueue
+	}
+
+	return aggregator.DefaultPublishQueue
+}
+
+// queryHistory returns the configured query history size, or the default when unset.
+func queryHistory(cfg cfgpkg.Config) int {
+	if cfg.QueryHistory > 0 {
+		return cfg.QueryHistory
+	}
+
+	return defaultQueryHistory
+}
+
+// subscribeBuffer returns the configured per-subscriber buffer, or the default when unset.
+func subscribeBuffer(cfg cfgpkg.Config) int {
+	if cfg.SubscribeBuffer > 0 {
+		return cfg.SubscribeBuffer
+	}
+
+	return defaultSubscribeBuffer
+}
+
+// ParsePrefixes splits a comma-separated list of value prefixes, skipping empty entries.
+func ParsePrefixes(list string) []string {
+	var out []string
+
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// RuntimeConfig returns the aggregation settings in effect.
+func (s *orchestratorSvc) RuntimeConfig() aggregator.Settings { return s.Aggregator.Settings() }
+
+// Reconfigure closes the open window and applies next to the following ones.
+func (s *orchestratorSvc) Reconfigure(ctx context.Context, next aggregator.Settings) (aggregator.Settings, error) {
+	cur := s.Aggregator.Settings()
+
+	// Seasonal slots are one window long; a new window length would
+	// compare unrelated slots.
+	if s.anomalies != nil && s.Cfg.AnomalySeason > 0 && next.Window != cur.Window {
+		return cur, fmt.Errorf("%w: the window cannot change while -anomalySeason is set", aggregator.ErrInvalidSettings)
+	}
+
+	applied, err := s.Aggregator.Reconfigure(ctx, next)
+	if err != nil {
+		return cur, err
+	}
+
+	s.Logger.InfoContext(ctx, "aggregation reconfigured",
+		slog.Uint64("generation", applied.Generation),
+		slog.String("attribute_key", applied.AttributeKey),
+		slog.Duration("window", applied.Window),
+		slog.Int("max_queue", applied.MaxQueue),
+		slog.Any("include_values", applied.Filter.Include),
+		slog.Any("exclude_values", applied.Filter.Exclude),
+	)
+
+	return applied, nil
+}
+
+// Subscriptions returns the hub fanning published snapshots out to streaming subscribers.
+func (s *orchestratorSvc) Subscriptions() *subscribe.Hub { return s.hub }
+
+// CurrentWindow returns a copy of the open window.
+func (s *orchestratorSvc) CurrentWindow(ctx context.Context) (sink.Snapshot, error) {
+	return s.Aggregator.CurrentWindow(ctx)
+}
+
+// Recent returns up to limit closed snapshots, most recent first.
+func (s *orchestratorSvc) Recent(limit int) []sink.Snapshot { return s.history.Recent(limit) }
+
+// RollupSpec is one configured rollup tier.
+type RollupSpec struct {
+	Resolution time.Duration
+	Path       string
+}
+
+// ParseRollups parses a comma-separated list of resolution=path tiers.
+func ParseRollups(spec string) ([]RollupSpec, error) {
+	var out []RollupSpec
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		res, path, ok := strings.Cut(part, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid rollup %q: want resolution=file", part)
+		}
+
+		d, err := time.ParseDuration(res)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rollup %q: %w", part, err)
+		}
+
+		out = append(out, RollupSpec{Resolution: d, Path: path})
+	}
+
+	return out, nil
+}
+
+// openRollups opens a JSON file sink per configured rollup tier.
+func (s *orchestratorSvc) openRollups() error {
+	specs, err := ParseRollups(s.Cfg.Rollups)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		f, err := os.OpenFile(spec.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open rollup output: %w", err)
+		}
+
+		s.rollupOut = append(s.rollupOut, f)
+
+		if err := s.Aggregator.AddRollup(spec.Resolution, sink.NewJSONSink(f)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AnomalyConfig returns the detector configuration; zero settings take the
+// detector defaults.
+func AnomalyConfig(cfg cfgpkg.Config) anomaly.Config {
+	c := anomaly.Config{
+		Alpha:          cfg.AnomalyAlpha,
+		Threshold:      cfg.AnomalyThreshold,
+		Warmup:         cfg.AnomalyWarmup,
+		DisappearAfter: cfg.AnomalyDisappearAfter,
+		MinExpected:    cfg.AnomalyMinExpected,
+	}
+
+	if cfg.AnomalySeason > 0 && cfg.Window > 0 {
+		c.Season = cfg.AnomalySeason
+		c.SeasonSlots = int(cfg.AnomalySeason / cfg.Window)
+	}
+
+	return c
+}
+
+// openAnomalies starts the anomaly detector on closed windows, writing events to the configured file.
+func (s *orchestratorSvc) openAnomalies() error {
+	if s.Cfg.AnomalySeason > 0 && (s.Cfg.Window <= 0 || s.Cfg.AnomalySeason%s.Cfg.Window != 0) {
+		return fmt.Errorf("anomaly season %s must be a whole multiple of the window %s", s.Cfg.AnomalySeason, s.Cfg.Window)
+	}
+
+	f, err := os.OpenFile(s.Cfg.AnomalyFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open anomaly output: %w", err)
+	}
+
+	s.anomalyOut = f
+	s.anomalies = anomaly.NewStream(anomaly.New(AnomalyConfig(s.Cfg)), f, s.Logger, anomalyQueue)
+	s.anomalies.SetEventCallback(func(ev anomaly.Event) {
+		s.Anomalies.Add(context.Background(), 1, otelmetric.WithAttributes(attribute.String("kind", string(ev.Kind))))
+	})
+	s.anomalies.Start()
+	s.Aggregator.AddWindowObserver(s.anomalies.Observe)
+
+	return nil
+}
+
+// addSink adds a sink next to the primary one with its -sinkOptions settings.
+func (s *orchestratorSvc) addSink(name string, out sink.Sink) error {
+	return s.Aggregator.AddSink(name, out, s.sinkOpts[name])
+}
+
+// ParseSinkOptions parses ';'-separated name:key=value,... entries into the
+// delivery options of each named sink. Keys are queue, workers, attempts,
+// backoff, max_backoff and timeout; retry keys override retry, the policy the
+// other sinks use.
+func ParseSinkOptions(spec string, retry sink.RetryPolicy) (map[string]aggregator.SinkOptions, error) {
+	out := make(map[string]aggregator.SinkOptions)
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, settings, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid sink options %q: want name:key=value,...", entry)
+		}
+
+		if name == aggregator.PrimarySink {
+			return nil, fmt.Errorf("invalid sink options %q: the primary sink uses the -publish* flags", entry)
+		}
+
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("duplicate sink options for %q", name)
+		}
+
+		opts := aggregator.SinkOptions{Retry: retry}
+
+		for _, kv := range strings.Split(settings, ",") {
+			if err := setSinkOption(&opts, strings.TrimSpace(kv)); err != nil {
+				return nil, fmt.Errorf("invalid sink options for %q: %w", name, err)
+			}
+		}
+
+		out[name] = opts
+	}
+
+	return out, nil
+}
+
+func setSinkOption(opts *aggregator.SinkOptions, kv string) error {
+	key, value, ok := strings.Cut(kv, "=")
+	if !ok {
+		return fmt.Errorf("%q: want key=value", kv)
+	}
+
+	var err error
+
+	switch key {
+	case "queue":
+		opts.QueueSize, err = parsePositive(value)
+	case "workers":
+		opts.Workers, err = parsePositive(value)
+	case "attempts":
+		opts.Retry.MaxAttempts, err = parsePositive(value)
+	case "backoff":
+		opts.Retry.InitialBackoff, err = time.ParseDuration(value)
+	case "max_backoff":
+		opts.Retry.MaxBackoff, err = time.ParseDuration(value)
+	case "timeout":
+		opts.Retry.Timeout, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown key %q: want queue|workers|attempts|backoff|max_backoff|timeout", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	return nil
+}
+
+func parsePositive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 1 {
+		err = fmt.Errorf("must be at least 1, got %d", n)
+	}
+
+	return n, err
+}
+
+// openMetricsSink exports every primary snapshot as OTLP metrics. It is a
+// separate publish target, so the collector gets its own retries and its
+// failures never hold up the main output.
+func (s *orchestratorSvc) openMetricsSink() error {
+	protocol, err := metricsink.ParseProtocol(s.Cfg.OTLPMetricsProtocol)
+	if err != nil {
+		return err
+	}
+
+	headers, err := metricsink.ParseHeaders(s.Cfg.OTLPMetricsHeaders)
+	if err != nil {
+		return err
+	}
+
+	out, err := metricsink.New(metricsink.Options{
+		Endpoint:    s.Cfg.OTLPMetricsEndpoint,
+		Protocol:    protocol,
+		Headers:     headers,
+		Insecure:    s.Cfg.OTLPMetricsInsecure,
+		ServiceName: "otlp-log-processor-backend",
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.MetricsRejected, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.otlp_metrics.rejected",
+		otelmetric.WithDescription("Number of data points the OTLP metrics collector rejected in a partial success"),
+		otelmetric.WithUnit("{data_point}"),
+	); err != nil {
+		return errors.Join(err, out.Close())
+	}
+
+	// The snapshot counts as delivered; the collector would reject the same
+	// data points again.
+	out.SetPartialSuccessCallback(func(rejected int64, msg string) {
+		s.Logger.Warn("OTLP metrics collector rejected data points", slog.Int64("rejected", rejected), slog.String("message", msg))
+		s.MetricsRejected.Add(context.Background(), rejected)
+	})
+
+	if err := s.addSink("otlp_metrics", out); err != nil {
+		return errors.Join(err, out.Close())
+	}
+
+	s.metricsOut = out
+
+	return nil
+}
+
+// ForwardOptions returns the forwarder settings; the retry backoff is the
+// publish policy's.
+func ForwardOptions(cfg cfgpkg.Config) (forward.Options, error) {
+	protocol, err := metricsink.ParseProtocol(cfg.ForwardProtocol)
+	if err != nil {
+		return forward.Options{}, err
+	}
+
+	headers, err := metricsink.ParseHeaders(cfg.ForwardHeaders)
+	if err != nil {
+		return forward.Options{}, err
+	}
+
+	retry := PublishRetryPolicy(cfg)
+	retry.MaxAttempts = cfg.ForwardMaxAttempts
+
+	if cfg.ForwardTimeout > 0 {
+		retry.Timeout = cfg.ForwardTimeout
+	}
+
+	return forward.Options{
+		Endpoint:     cfg.ForwardEndpoint,
+		Protocol:     protocol,
+		Headers:      headers,
+		Insecure:     cfg.ForwardInsecure,
+		QueueSize:    cfg.ForwardQueue,
+		BatchSize:    cfg.ForwardBatchSize,
+		BatchTimeout: cfg.ForwardBatchTimeout,
+		Retry:        retry,
+	}, nil
+}
+
+// openTables adds the CSV and Parquet sinks that are configured.
+func (s *orchestratorSvc) openTables() error {
+	for _, t := range []struct {
+		format tabular.Format
+		dir    string
+	}{
+		{tabular.FormatCSV, s.Cfg.CSVDir},
+		{tabular.FormatParquet, s.Cfg.ParquetDir},
+	} {
+		if t.dir == "" {
+			continue
+		}
+
+		opts, err := TableOptions(s.Cfg, t.format, t.dir)
+		if err != nil {
+			return err
+		}
+
+		out, err := tabular.NewSink(opts)
+		if err != nil {
+			return err
+		}
+
+		s.tableOut = append(s.tableOut, out)
+
+		if err := s.addSink(string(t.format), out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openForwarder sets up forwarding of received requests to the upstream
+// endpoint; the OTLP server hands them over through Forwarder.
+func (s *orchestratorSvc) openForwarder() error {
+	opts, err := ForwardOptions(s.Cfg)
+	if err != nil {
+		return err
+	}
+
+	fwd, err := forward.New(opts, s.Logger)
+	if err != nil {
+		return err
+	}
+
+	s.forwarder = fwd
+
+	if s.ForwardRecords, err = s.Meter.Int64Counter(
+		"com.dash0.homeexercise.forward.records",
+		otelmetric.WithDescription("Number of log records forwarded upstream or given up on, by outcome"),
+		otelmetric.WithUnit("{log}"),
+	); err != nil {
+		return err
+	}
+
+	fwd.SetResultCallback(func(forwarded, failed int64) {
+		if forwarded > 0 {
+			s.ForwardRecords.Add(context.Background(), forwarded, otelmetric.WithAttributes(attribute.String("outcome", "success")))
+		}
+
+		if failed > 0 {
+			s.ForwardRecords.Add(context.Background(), failed, otelmetric.WithAttributes(attribute.String("outcome", "failure")))
+		}
+	})
+
+	s.ForwardQueueDepth, err = s.Meter.Int64ObservableGauge(
+		"com.dash0.homeexercise.forward.queue.depth",
+		otelmetric.WithDescription("Number of received requests waiting to be forwarded"),
+		otelmetric.WithUnit("{request}"),
+		otelmetric.WithInt64Callback(func(_ context.Context, o otelmetric.Int64Observer) error {
+			o.Observe(int64(fwd.QueueLen()))
+			return nil
+		}),
+	)
+
+	return err
+}
+
+// Forwarder returns the forwarder for received requests, or nil when
+// forwarding is off.
+func (s *orchestratorSvc) Forwarder() *forward.Forwarder { return s.forwarder }
+
+// startAlerts evaluates the configured rules on closed windows and notifies the webhook.
+func (s *orchestratorSvc) startAlerts() error {
+	rules, err := alert.ParseRules(s.Cfg.AlertRules)
+	if err != nil {
+		return err
+	}
+
+	if s.Cfg.AlertWebhook == "" {
+		return errors.New("-alertRules requires -alertWebhook")
+	}
+
+	s.alerts = alert.NewManager(rules, alert.NewWebhook(s.Cfg.AlertWebhook, PublishRetryPolicy(s.Cfg)), s.Logger, alertQueue)
+	s.alerts.SetNotifyCallback(func(a alert.Alert, err error) {
+		s.Alerts.Add(context.Background(), 1, otelmetric.WithAttributes(
+			attribute.String("status", string(a.Status)),
+			attribute.Bool("delivered", err == nil),
+		))
+	})
+	s.alerts.Start()
+	s.Aggregator.AddWindowObserver(s.alerts.Observe)
+
+	return nil
+}
+
+// openStateLog opens the durable window state and hands the recovered window to the aggregator.
+func (s *orchestratorSvc) openStateLog() error {
+	policy, err := wal.ParseFsyncPolicy(s.Cfg.StateFsync)
+	if err != nil {
+		return err
+	}
+
+	l, recovered, err := wal.Open(wal.Options{Dir: s.Cfg.StateDir, Fsync: policy, FsyncInterval: s.Cfg.StateFsyncInterval})
+	if err != nil {
+		return err
+	}
+
+	s.stateLog = l
+	s.Aggregator.SetStateLog(l, recovered)
+
+	if recovered.Total > 0 {
+		s.Logger.Info(
+			"resuming window from durable state",
+			slog.String("state_dir", s.Cfg.StateDir),
+			slog.Int64("window_start", recovered.WindowStart),
+			slog.Uint64("total", recovered.Total),
+		)
+	}
+
+	return nil
+}
+
+// ReplayDeadLetter re-publishes the entries of the dead-letter file at path,
+// each to the sink it failed on, and returns how many were delivered. It stops
+// at the first entry that cannot be delivered. Start is not needed.
+func (s *orchestratorSvc) ReplayDeadLetter(ctx context.Context, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var n int
+
+	err = sink.ReadDeadLetter(f, func(e sink.DeadLetterEntry) error {
+		if err := s.Aggregator.Redeliver(ctx, e.Target, e.Snapshot); err != nil {
+			return err
+		}
+
+		n++
+
+		return nil
+	})
+
+	return n, err
+}
+
+// Close stops the aggregator, waiting for its final flush, and releases durable
+// state. Deliveries still running when ctx is done are cancelled; the files
+// they write to are closed only once the aggregator's goroutines have exited.
 func (s *orchestratorSvc) Close(ctx context.Context) error {
 	ctx, span := s.Tracer.Start(ctx, "orchestrator.Close")
 	defer span.End()
 
 	s.Logger.DebugContext(ctx, "orchestrator.Close: begin")
 
+	var err error
+
 	if s.aggCancel != nil {
 		s.aggCancel()
 
 		if s.Aggregator != nil {
-			s.Aggregator.Stop(ctx)
+			err = s.Aggregator.Stop(ctx)
 		}
 
 		s.aggCancel = nil
 	}
 
+	// Requests still queued for forwarding were counted already; send them
+	// within the caller's deadline.
+	if s.forwarder != nil {
+		err = errors.Join(err, s.forwarder.Close(ctx))
+		s.forwarder = nil
+	}
+
+	err = errors.Join(err, s.closeFiles(ctx))
+
 	s.Logger.DebugContext(ctx, "orchestrator.Close: end")
 
-	return nil
+	return err
+}
+
+// closeFiles drains the alert and anomaly consumers, ends the subscriptions
+// and releases the durable state, dead-letter, OTLP metrics, rollup, CSV,
+// Parquet and anomaly outputs, if open. Alert notifications still pending when
+// ctx is done are abandoned.
+func (s *orchestratorSvc) closeFiles(ctx context.Context) error {
+	var err error
+
+	// End any subscriptions still open; main closes the hub earlier so that
+	// streams do not hold up the gRPC graceful stop.
+	if s.hub != nil {
+		s.hub.Close()
+	}
+
+	if s.stateLog != nil {
+		err = errors.Join(err, s.stateLog.Close())
+		s.stateLog = nil
+	}
+
+	if s.deadLetter != nil {
+		err = errors.Join(err, s.deadLetter.Close())
+		s.deadLetter = nil
+	}
+
+	if s.metricsOut != nil {
+		err = errors.Join(err, s.metricsOut.Close())
+		s.metricsOut = nil
+	}
+
+	// Finish the CSV and Parquet files; Parquet files are unreadable until then.
+	for _, t := range s.tableOut {
+		err = errors.Join(err, t.Close())
+	}
+
+	s.tableOut = nil
+
+	if s.alerts != nil {
+		s.alerts.Close(ctx)
+		s.alerts = nil
+	}
+
+	// Drain the detector before closing its output.
+	if s.anomalies != nil {
+		s.anomalies.Close()
+		s.anomalies = nil
+	}
+
+	if s.anomalyOut != nil {
+		err = errors.Join(err, s.anomalyOut.Close())
+		s.anomalyOut = nil
+	}
+
+	for _, f := range s.rollupOut {
+		err = errors.Join(err, f.Close())
+	}
+
+	s.rollupOut = nil
+
+	return err
 }
 
 // Start starts the service’s internal components (e.g., the aggregator).
@@ -163,13 +1281,14 @@ func (s *orchestratorSvc) Start(ctx context.Context) {
 	s.aggCancel = cancel
 	s.Aggregator.Start(aggCtx)
 	s.Logger.DebugContext(ctx, "orchestrator.Start: started aggregator", slog.Int("queue_len", s.Aggregator.QueueLen()))
-}
 
-// AttributeKey returns the configured attribute key used for aggregation.
-func (s *orchestratorSvc) AttributeKey() string { return s.Cfg.AttributeKey }
+	if s.forwarder != nil {
+		s.forwarder.Start()
+	}
+}
 
 // EnqueueBatch forwards a batch of values to the aggregator if present.
-func (s *orchestratorSvc) EnqueueBatch(values []string) bool {
+func (s *orchestratorSvc) EnqueueBatch(b aggregator.Batch) bool {
 	if s.Aggregator == nil {
 		return false
 	}
@@ -177,9 +1296,9 @@ func (s *orchestratorSvc) EnqueueBatch(values []string) bool {
 	ctx, span := s.Tracer.Start(context.Background(), "orchestrator.EnqueueBatch")
 	defer span.End()
 
-	span.SetAttributes(attribute.Int("batch.size", len(values)))
-	s.Logger.DebugContext(ctx, "orchestrator.EnqueueBatch: begin", slog.Int("batch_size", len(values)))
-	ok := s.Aggregator.EnqueueBatch(values)
+	span.SetAttributes(attribute.Int("batch.size", b.Len()))
+	s.Logger.DebugContext(ctx, "orchestrator.EnqueueBatch: begin", slog.Int("batch_size", b.Len()))
+	ok := s.Aggregator.EnqueueBatch(b)
 	s.Logger.DebugContext(ctx, "orchestrator.EnqueueBatch: end", slog.Bool("enqueued", ok), slog.Int("queue_len", s.Aggregator.QueueLen()))
 
 	return ok
@@ -201,6 +1320,18 @@ func (s *orchestratorSvc) RecordDrop(n uint64) {
 	s.Logger.DebugContext(ctx, "orchestrator.RecordDrop: end")
 }
 
+// ResetCumulative restarts the cumulative count series at the next window boundary.
+func (s *orchestratorSvc) ResetCumulative() {
+	s.Logger.Info("resetting cumulative counts")
+	s.Aggregator.ResetCumulative()
+}
+
+// RecordExportBatch records the number of log records in one accepted Export
+// request.
+func (s *orchestratorSvc) RecordExportBatch(ctx context.Context, n int64) {
+	s.ExportBatchSize.Record(ctx, n)
+}
+
 // MetricType enumerates orchestrator metric counters.
 type MetricType int
 
@@ -210,6 +1341,8 @@ const (
 	MetricLogsDropped
 	MetricFlushes
 	MetricPublishFailed
+	MetricLogsSampledOut
+	MetricLogsThrottled
 )
 
 // IncrMetric increments the selected metric by n (if n > 0).
@@ -229,5 +1362,9 @@ func (s *orchestratorSvc) IncrMetric(ctx context.Context, mt MetricType, n int64
 		s.Flushes.Add(ctx, n)
 	case MetricPublishFailed:
 		s.PublishFailed.Add(ctx, n)
+	case MetricLogsSampledOut:
+		s.LogsSampledOut.Add(ctx, n)
+	case MetricLogsThrottled:
+		s.LogsThrottled.Add(ctx, n)
 	}
 }
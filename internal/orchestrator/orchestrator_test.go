@@ -1,18 +1,39 @@
 package orchestrator
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/proto"
 
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	"dash0.com/otlp-log-processor-backend/internal/alert"
 	cfgpkg "dash0.com/otlp-log-processor-backend/internal/config"
+	"dash0.com/otlp-log-processor-backend/internal/metricsink"
+	"dash0.com/otlp-log-processor-backend/internal/rotate"
 	"dash0.com/otlp-log-processor-backend/internal/sink"
 	"dash0.com/otlp-log-processor-backend/internal/sink/mocks"
+	"dash0.com/otlp-log-processor-backend/internal/subscribe"
+	"dash0.com/otlp-log-processor-backend/internal/tabular"
+	"dash0.com/otlp-log-processor-backend/internal/wal"
 )
 
 func TestNew_ConstructsAggregator(t *testing.T) {
@@ -65,10 +86,10 @@ func TestNew_WithSink_PublishesSnapshot(t *testing.T) {
 	ms := mocks.NewMockSink(ctrl)
 
 	// Expect at least one publish; capture to validate structure
-	var got sink.Snapshot
+	var got atomic.Pointer[sink.Snapshot]
 
 	ms.EXPECT().Publish(gomock.Any(), gomock.AssignableToTypeOf(sink.Snapshot{})).DoAndReturn(
-		func(_ context.Context, s sink.Snapshot) error { got = s; return nil },
+		func(_ context.Context, s sink.Snapshot) error { got.Store(&s); return nil },
 	).MinTimes(1)
 
 	s, err := New(cfg, logger, WithSink(ms))
@@ -83,6 +104,575 @@ func TestNew_WithSink_PublishesSnapshot(t *testing.T) {
 	require.True(t, s.Aggregator.Enqueue("v1"))
 	require.True(t, s.Aggregator.Enqueue("v2"))
 
-	time.Sleep(60 * time.Millisecond)
-	require.GreaterOrEqual(t, got.WindowEnd, got.WindowStart)
+	require.Eventually(t, func() bool { return got.Load() != nil }, time.Second, 5*time.Millisecond)
+	require.GreaterOrEqual(t, got.Load().WindowEnd, got.Load().WindowStart)
+}
+
+func TestNew_InternalMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := cfgpkg.Config{
+		AttributeKey: "k",
+		Window:       20 * time.Millisecond,
+		MaxQueue:     4,
+		OutputFormat: "json",
+	}
+
+	s, err := New(cfg, logger, WithSink(sink.NewJSONSink(io.Discard)), WithMeterProvider(mp))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.RecordExportBatch(ctx, 3)
+	require.True(t, s.EnqueueBatch(aggregator.Batch{Values: []string{"a", "b", "a"}}))
+
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(ctx, &rm))
+
+		out := map[string]metricdata.Aggregation{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				out[m.Name] = m.Data
+			}
+		}
+
+		return out
+	}
+
+	// Queued but not yet drained.
+	metrics := collect()
+	require.EqualValues(t, 1, metrics["com.dash0.homeexercise.queue.depth"].(metricdata.Gauge[int64]).DataPoints[0].Value)
+	require.InDelta(t, 0.25, metrics["com.dash0.homeexercise.queue.utilization"].(metricdata.Gauge[float64]).DataPoints[0].Value, 1e-9)
+
+	batch := metrics["com.dash0.homeexercise.export.batch.size"].(metricdata.Histogram[int64]).DataPoints[0]
+	require.EqualValues(t, 1, batch.Count)
+	require.EqualValues(t, 3, batch.Sum)
+
+	// Deliveries are timed per sink.
+	published := func(metrics map[string]metricdata.Aggregation) []string {
+		h, _ := metrics["com.dash0.homeexercise.publish.duration"].(metricdata.Histogram[float64])
+
+		var sinks []string
+
+		for _, dp := range h.DataPoints {
+			name, _ := dp.Attributes.Value(attribute.Key("sink"))
+			sinks = append(sinks, name.AsString())
+		}
+
+		return sinks
+	}
+
+	s.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return slices.Contains(published(collect()), aggregator.PrimarySink)
+	}, time.Second, 5*time.Millisecond)
+
+	metrics = collect()
+	require.Positive(t, metrics["com.dash0.homeexercise.flush.duration"].(metricdata.Histogram[float64]).DataPoints[0].Count)
+
+	// The first window held both values; later ones may be empty.
+	values := metrics["com.dash0.homeexercise.window.values"].(metricdata.Gauge[int64]).DataPoints[0].Value
+	require.Contains(t, []int64{0, 2}, values)
+
+	cancel()
+	require.NoError(t, s.Close(context.Background()))
+}
+
+func TestNew_StateDir(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := cfgpkg.Config{
+		AttributeKey: "k",
+		Window:       time.Hour,
+		MaxQueue:     4,
+		StateDir:     t.TempDir(),
+		StateFsync:   "sometimes",
+	}
+
+	_, err := New(cfg, logger)
+	require.ErrorContains(t, err, "fsync policy")
+
+	cfg.StateFsync = "always"
+	s, err := New(cfg, logger)
+	require.NoError(t, err)
+	require.NotNil(t, s.stateLog)
+	require.NoError(t, s.Close(context.Background()))
+	require.Nil(t, s.stateLog)
+}
+
+func TestNew_InvalidTemporality(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := New(cfgpkg.Config{AttributeKey: "k", Window: time.Hour, Temporality: "monthly"}, logger)
+	require.ErrorContains(t, err, "temporality")
+}
+
+func TestParseRollups(t *testing.T) {
+	got, err := ParseRollups("1m=a.jsonl, 1h=b.jsonl,")
+	require.NoError(t, err)
+	require.Equal(t, []RollupSpec{{time.Minute, "a.jsonl"}, {time.Hour, "b.jsonl"}}, got)
+
+	for _, bad := range []string{"1m", "1m=", "soon=a.jsonl"} {
+		_, err := ParseRollups(bad)
+		require.Errorf(t, err, "spec %q", bad)
+	}
+}
+
+func TestNew_Rollups(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Second, Rollups: "1m=" + filepath.Join(dir, "1m.jsonl") + ",90s=" + filepath.Join(dir, "90s.jsonl")}
+
+	_, err := New(cfg, logger)
+	require.ErrorContains(t, err, "multiple of 1m0s")
+
+	cfg.Rollups = "1m=" + filepath.Join(dir, "1m.jsonl") + ",1h=" + filepath.Join(dir, "1h.jsonl")
+	s, err := New(cfg, logger)
+	require.NoError(t, err)
+	require.Len(t, s.rollupOut, 2)
+	require.NoError(t, s.Close(context.Background()))
+	require.FileExists(t, filepath.Join(dir, "1h.jsonl"))
+}
+
+func TestNew_Anomalies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "anomalies.jsonl")
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Second, AnomalyFile: path, AnomalySeason: 25 * time.Second}
+
+	_, err := New(cfg, logger)
+	require.ErrorContains(t, err, "anomaly season")
+
+	cfg.AnomalySeason = 24 * time.Hour
+	require.Equal(t, 8640, AnomalyConfig(cfg).SeasonSlots)
+	require.Equal(t, 24*time.Hour, AnomalyConfig(cfg).Season)
+
+	s, err := New(cfg, logger)
+	require.NoError(t, err)
+	require.NotNil(t, s.anomalies)
+	require.NoError(t, s.Close(context.Background()))
+	require.Nil(t, s.anomalies)
+	require.FileExists(t, path)
+}
+
+func TestNew_AlertsNotifyWebhook(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	got := make(chan alert.Payload, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var p alert.Payload
+		if json.NewDecoder(r.Body).Decode(&p) == nil {
+			got <- p
+		}
+	}))
+	defer srv.Close()
+
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Millisecond, MaxQueue: 4, AlertRules: "busy=total >= 1"}
+
+	_, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.ErrorContains(t, err, "-alertWebhook")
+
+	cfg.AlertWebhook = srv.URL
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	select {
+	case p := <-got:
+		require.Len(t, p.Alerts, 1)
+		require.Equal(t, "busy", p.Alerts[0].Rule)
+		require.Equal(t, alert.StatusFiring, p.Alerts[0].Status)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alert delivered")
+	}
+
+	require.NoError(t, s.Close(context.Background()))
+}
+
+func TestNew_OTLPMetricsSink(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	got := make(chan *colmetricspb.ExportMetricsServiceRequest, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var req colmetricspb.ExportMetricsServiceRequest
+
+		body, _ := io.ReadAll(r.Body)
+		if proto.Unmarshal(body, &req) == nil {
+			got <- &req
+		}
+	}))
+	defer srv.Close()
+
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Millisecond, MaxQueue: 4, OTLPMetricsEndpoint: srv.URL, OTLPMetricsProtocol: "http/protobuf"}
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	deadline := time.After(2 * time.Second)
+
+	for {
+		select {
+		case req := <-got:
+			m := req.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()[0]
+			if m.GetName() != metricsink.MetricCount {
+				continue
+			}
+
+			require.Equal(t, "v", m.GetSum().GetDataPoints()[0].GetAttributes()[0].GetValue().GetStringValue())
+			require.NoError(t, s.Close(context.Background()))
+
+			return
+		case <-deadline:
+			t.Fatal("no metrics exported")
+		}
+	}
+}
+
+// discardSink discards snapshots.
+type discardSink struct{}
+
+func (*discardSink) Publish(context.Context, sink.Snapshot) error { return nil }
+
+type countingSink struct{ n atomic.Int64 }
+
+func (c *countingSink) Publish(context.Context, sink.Snapshot) error { c.n.Add(1); return nil }
+
+func TestParseSinkOptions(t *testing.T) {
+	base := sink.DefaultRetryPolicy()
+
+	got, err := ParseSinkOptions("webhook:queue=128,workers=2,attempts=5,timeout=3s; otlp_metrics:backoff=1s,max_backoff=1m;", base)
+	require.NoError(t, err)
+
+	webhook := base
+	webhook.MaxAttempts, webhook.Timeout = 5, 3*time.Second
+	metrics := base
+	metrics.InitialBackoff, metrics.MaxBackoff = time.Second, time.Minute
+
+	require.Equal(t, map[string]aggregator.SinkOptions{
+		"webhook":      {QueueSize: 128, Workers: 2, Retry: webhook},
+		"otlp_metrics": {Retry: metrics},
+	}, got)
+
+	for _, bad := range []string{"webhook", "webhook:queue", "webhook:queue=0", "webhook:color=red", "webhook:timeout=soon", "a:queue=1;a:queue=2", "primary:queue=1"} {
+		_, err := ParseSinkOptions(bad, base)
+		require.Errorf(t, err, "spec %q", bad)
+	}
+}
+
+func TestNew_AdditionalSinks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	posted := make(chan struct{}, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { posted <- struct{}{} }))
+	defer srv.Close()
+
+	extra := &countingSink{}
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Millisecond, MaxQueue: 4, SnapshotWebhook: srv.URL, SinkOptions: "webhook:queue=8;extra:attempts=1"}
+
+	_, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.ErrorContains(t, err, `-sinkOptions: no sink named "extra"`)
+
+	s, err := New(cfg, logger, WithSink(&discardSink{}), WithAdditionalSink("extra", extra))
+	require.NoError(t, err)
+
+	var names []string
+	for _, st := range s.Aggregator.SinkStatuses() {
+		names = append(names, st.Name)
+
+		if st.Name == "webhook" {
+			require.Equal(t, 8, st.QueueCap)
+		}
+	}
+
+	require.Equal(t, []string{aggregator.PrimarySink, "subscribers", "webhook", "extra"}, names)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	select {
+	case <-posted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no snapshot posted")
+	}
+
+	require.NoError(t, s.Close(context.Background()))
+	require.NotZero(t, extra.n.Load())
+}
+
+func TestNew_TableSinks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 10 * time.Millisecond, MaxQueue: 4, CSVDir: filepath.Join(dir, "csv"), ParquetDir: filepath.Join(dir, "parquet")}
+
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	require.Eventually(t, func() bool {
+		names, _ := filepath.Glob(filepath.Join(dir, "csv", "*.csv"))
+		if len(names) == 0 {
+			return false
+		}
+
+		data, _ := os.ReadFile(names[0])
+
+		return strings.Contains(string(data), ",k,v,1,delta,")
+	}, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, s.Close(context.Background()))
+
+	// Finished on close.
+	names, err := filepath.Glob(filepath.Join(dir, "parquet", "*"))
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+	require.Equal(t, ".parquet", filepath.Ext(names[0]))
+}
+
+func TestNew_QueryHistory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(cfgpkg.Config{AttributeKey: "k", Window: 5 * time.Millisecond, MaxQueue: 4, QueryHistory: 2}, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	defer func() { require.NoError(t, s.Close(context.Background())) }()
+
+	_, err = s.CurrentWindow(context.Background())
+	require.NoError(t, err)
+
+	for i := range 3 {
+		require.True(t, s.Aggregator.Enqueue("v"))
+		require.Eventually(t, func() bool { return len(s.Recent(0)) >= min(i+1, 2) }, time.Second, time.Millisecond)
+	}
+
+	require.Len(t, s.Recent(0), 2)
+	require.Len(t, s.Recent(1), 1)
+}
+
+func TestNew_WithWindowObserver(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	got := make(chan sink.Snapshot, 16)
+
+	s, err := New(cfgpkg.Config{AttributeKey: "k", Window: 5 * time.Millisecond, MaxQueue: 4}, logger,
+		WithSink(&discardSink{}), WithWindowObserver(func(snap sink.Snapshot) {
+			if snap.Total > 0 {
+				got <- snap
+			}
+		}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	select {
+	case snap := <-got:
+		require.Equal(t, map[string]uint64{"v": 1}, snap.Counts)
+	case <-time.After(2 * time.Second):
+		t.Fatal("observer not called")
+	}
+
+	require.NoError(t, s.Close(context.Background()))
+}
+
+func TestNew_SubscribersReceiveSnapshots(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: 5 * time.Millisecond, MaxQueue: 4, Tenant: "eu-1", SubscribePolicy: "block"}
+
+	_, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.ErrorContains(t, err, "subscriber policy")
+
+	cfg.SubscribePolicy = ""
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	sub, err := s.Subscriptions().Subscribe(subscribe.Match{Tenant: "eu-1"})
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	require.True(t, s.Aggregator.Enqueue("v"))
+
+	select {
+	case snap := <-sub.C():
+		require.Equal(t, map[string]uint64{"v": 1}, snap.Counts)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no snapshot delivered")
+	}
+
+	require.NoError(t, s.Close(context.Background()))
+	<-sub.Done()
+	require.ErrorIs(t, sub.Err(), subscribe.ErrClosed)
+}
+
+func TestReconfigure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := cfgpkg.Config{
+		AttributeKey:  "k",
+		Window:        time.Hour,
+		MaxQueue:      4,
+		ExcludeValues: "debug-, ,",
+		AnomalyFile:   filepath.Join(t.TempDir(), "anomalies.jsonl"),
+		AnomalySeason: 24 * time.Hour,
+	}
+
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"debug-"}, s.RuntimeConfig().Filter.Exclude)
+
+	s.Start(context.Background())
+	defer func() { require.NoError(t, s.Close(context.Background())) }()
+
+	next := s.RuntimeConfig()
+	next.Window = 30 * time.Minute
+	_, err = s.Reconfigure(context.Background(), next)
+	require.ErrorIs(t, err, aggregator.ErrInvalidSettings)
+
+	next = s.RuntimeConfig()
+	next.AttributeKey = "other"
+	applied, err := s.Reconfigure(context.Background(), next)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, applied.Generation)
+	require.Equal(t, "other", s.RuntimeConfig().AttributeKey)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := cfgpkg.Config{
+		ListenAddr:            "localhost:4317",
+		MaxReceiveMessageSize: 1024,
+		AttributeKey:          "k",
+		Window:                10 * time.Second,
+		OutputFormat:          "json",
+		LogLevel:              "info",
+		Temporality:           "delta",
+		SubscribePolicy:       "drop_oldest",
+		StateFsync:            "interval",
+		OutputFsync:           "never",
+		OTLPMetricsProtocol:   "grpc",
+		ForwardProtocol:       "grpc",
+		SampleRatio:           1,
+		ParquetCompression:    "snappy",
+		AnomalyAlpha:          0.3,
+		AnomalyThreshold:      3,
+		Rollups:               "1m=a.jsonl,1h=b.jsonl",
+	}
+	require.NoError(t, Validate(cfg))
+
+	// Registered by the API package.
+	cfg.OutputFormat = "protobuf"
+	require.NoError(t, Validate(cfg))
+
+	cfg.Rollups = "1m=a.jsonl,90s=b.jsonl"
+	cfg.AlertRules = "total >>> 1"
+	cfg.AlertWebhook = "http://localhost"
+	cfg.Window = 0
+	cfg.OTLPMetricsHeaders = "authorization"
+	cfg.OutputFormat = "yaml"
+	cfg.SinkOptions = "webhook:workers=0"
+
+	err := Validate(cfg)
+	require.ErrorContains(t, err, "-window")
+	require.ErrorContains(t, err, "-rollups")
+	require.ErrorContains(t, err, "-alertRules")
+	require.ErrorContains(t, err, "-otlpMetricsHeaders")
+	require.ErrorContains(t, err, `-outputFormat: unknown output format "yaml"`)
+	require.ErrorContains(t, err, `-sinkOptions: invalid sink options for "webhook": workers: must be at least 1, got 0`)
+}
+
+func TestOutputSink(t *testing.T) {
+	snap := sink.Snapshot{WindowStart: 1710000000000, WindowEnd: 1710000010000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}
+
+	var buf bytes.Buffer
+
+	out, err := OutputSink(cfgpkg.Config{OutputFormat: "log"}, &buf)
+	require.NoError(t, err)
+	require.NoError(t, out.Publish(context.Background(), snap))
+	require.Equal(t, "2024-03-09T16:00:00Z .. 2024-03-09T16:00:10Z  foo  total=1 dropped=0\n  a  1\n", buf.String())
+
+	buf.Reset()
+
+	// An empty format is JSON, as for configs built in code.
+	out, err = OutputSink(cfgpkg.Config{OutputTimeFormat: "rfc3339"}, &buf)
+	require.NoError(t, err)
+	require.NoError(t, out.Publish(context.Background(), snap))
+	require.Contains(t, buf.String(), `"window_start":"2024-03-09T16:00:00Z"`)
+
+	_, err = OutputSink(cfgpkg.Config{OutputTimeFormat: "iso"}, &buf)
+	require.Error(t, err)
+}
+
+func TestOutputFileOptions(t *testing.T) {
+	opts, err := OutputFileOptions(cfgpkg.Config{OutputFile: "out.jsonl", OutputMaxSizeMB: 2, OutputFsync: "interval", OutputFsyncInterval: time.Second})
+	require.NoError(t, err)
+	require.Equal(t, rotate.Options{Path: "out.jsonl", MaxSize: 2 << 20, Fsync: wal.FsyncInterval, FsyncInterval: time.Second}, opts)
+
+	_, err = OutputFileOptions(cfgpkg.Config{OutputFile: "out.jsonl", OutputFsync: "sometimes"})
+	require.Error(t, err)
+}
+
+func TestForwardOptions(t *testing.T) {
+	cfg := cfgpkg.Config{
+		ForwardEndpoint:    "http://collector:4318",
+		ForwardProtocol:    "http/protobuf",
+		ForwardHeaders:     "authorization=token",
+		ForwardMaxAttempts: 4,
+		ForwardTimeout:     time.Second,
+		PublishTimeout:     time.Minute,
+	}
+
+	opts, err := ForwardOptions(cfg)
+	require.NoError(t, err)
+	require.Equal(t, metricsink.ProtocolHTTP, opts.Protocol)
+	require.Equal(t, map[string]string{"authorization": "token"}, opts.Headers)
+	require.Equal(t, 4, opts.Retry.MaxAttempts)
+	require.Equal(t, time.Second, opts.Retry.Timeout)
+
+	cfg.ForwardProtocol = "udp"
+	_, err = ForwardOptions(cfg)
+	require.Error(t, err)
+}
+
+func TestTableOptions(t *testing.T) {
+	opts, err := TableOptions(cfgpkg.Config{TableMaxRows: 10, ParquetCompression: "zstd", OutputTimeFormat: "unix_ms"}, tabular.FormatParquet, "out")
+	require.NoError(t, err)
+	require.Equal(t, tabular.Options{Dir: "out", Format: tabular.FormatParquet, MaxRows: 10, Compression: tabular.CompressionZstd, TimeFormat: sink.TimeUnixMillis}, opts)
+
+	_, err = TableOptions(cfgpkg.Config{ParquetCompression: "lzo"}, tabular.FormatParquet, "out")
+	require.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := cfgpkg.Config{AttributeKey: "k", Window: time.Hour, MaxQueue: 4}
+
+	s, err := New(cfg, logger, WithSink(&discardSink{}))
+	require.NoError(t, err)
+
+	s.Start(context.Background())
+	defer func() { require.NoError(t, s.Close(context.Background())) }()
+
+	// Unchanged reloadable settings do not start a new generation.
+	cfg.Tenant = "ignored until restart"
+	require.NoError(t, s.Reload(context.Background(), cfg))
+	require.EqualValues(t, 1, s.RuntimeConfig().Generation)
+
+	cfg.IncludeValues = "api-"
+	require.NoError(t, s.Reload(context.Background(), cfg))
+	require.EqualValues(t, 2, s.RuntimeConfig().Generation)
+	require.Equal(t, []string{"api-"}, s.RuntimeConfig().Filter.Include)
+}
+
+func TestPublishRetryPolicy_Defaults(t *testing.T) {
+	require.Equal(t, sink.DefaultRetryPolicy(), PublishRetryPolicy(cfgpkg.Config{}))
+
+	p := PublishRetryPolicy(cfgpkg.Config{PublishMaxAttempts: 5, PublishMaxBackoff: time.Minute})
+	require.Equal(t, 5, p.MaxAttempts)
+	require.Equal(t, time.Minute, p.MaxBackoff)
+	require.Equal(t, sink.DefaultRetryPolicy().InitialBackoff, p.InitialBackoff)
 }
@@ -0,0 +1,167 @@
+package otelsetup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter names accepted in OTEL_{TRACES,METRICS,LOGS}_EXPORTER; "stdout" is
+// accepted as an alias of console.
+const (
+	exporterOTLP    = "otlp"
+	exporterConsole = "console"
+	exporterNone    = "none"
+)
+
+// OTLP protocols accepted in OTEL_EXPORTER_OTLP_[<SIGNAL>_]PROTOCOL.
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http/protobuf"
+)
+
+// Signals as they appear in the environment variable names.
+const (
+	signalTraces  = "TRACES"
+	signalMetrics = "METRICS"
+	signalLogs    = "LOGS"
+)
+
+// exporterFor returns the exporter selected for signal by
+// OTEL_<SIGNAL>_EXPORTER. Unset, it is otlp when an OTLP endpoint is set for
+// the signal and none otherwise.
+func exporterFor(signal string) (string, error) {
+	name := "OTEL_" + signal + "_EXPORTER"
+
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv(name))); v {
+	case "":
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT") != "" {
+			return exporterOTLP, nil
+		}
+
+		return exporterNone, nil
+	case "stdout":
+		return exporterConsole, nil
+	case exporterOTLP, exporterConsole, exporterNone:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%s: unsupported exporter %q: want otlp|console|none", name, v)
+	}
+}
+
+// protocolFor returns the OTLP protocol of signal, by default http/protobuf
+// as the specification asks.
+func protocolFor(signal string) (string, error) {
+	name := "OTEL_EXPORTER_OTLP_" + signal + "_PROTOCOL"
+
+	v := os.Getenv(name)
+	if v == "" {
+		name = "OTEL_EXPORTER_OTLP_PROTOCOL"
+		v = os.Getenv(name)
+	}
+
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case "":
+		return protocolHTTP, nil
+	case protocolGRPC, protocolHTTP:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%s: unsupported protocol %q: want grpc|http/protobuf", name, v)
+	}
+}
+
+// newSpanExporter returns the span exporter selected by the environment, or
+// nil for none. The OTLP exporters read their endpoint, headers, TLS and
+// timeout settings from the environment themselves.
+func newSpanExporter(ctx context.Context, o options) (sdktrace.SpanExporter, error) {
+	exporter, err := exporterFor(signalTraces)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case exporterConsole:
+		return stdouttrace.New(stdouttrace.WithWriter(o.console))
+	case exporterOTLP:
+		protocol, err := protocolFor(signalTraces)
+		if err != nil {
+			return nil, err
+		}
+
+		if protocol == protocolGRPC {
+			return otlptracegrpc.New(ctx)
+		}
+
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, nil
+	}
+}
+
+// newMetricExporter returns the metric exporter selected by the environment,
+// or nil for none.
+func newMetricExporter(ctx context.Context, o options) (sdkmetric.Exporter, error) {
+	exporter, err := exporterFor(signalMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case exporterConsole:
+		return stdoutmetric.New(stdoutmetric.WithWriter(o.console))
+	case exporterOTLP:
+		protocol, err := protocolFor(signalMetrics)
+		if err != nil {
+			return nil, err
+		}
+
+		if protocol == protocolGRPC {
+			return otlpmetricgrpc.New(ctx)
+		}
+
+		return otlpmetrichttp.New(ctx)
+	default:
+		return nil, nil
+	}
+}
+
+// newLogExporter returns the log exporter selected by the environment, or
+// nil for none.
+func newLogExporter(ctx context.Context, o options) (sdklog.Exporter, error) {
+	exporter, err := exporterFor(signalLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case exporterConsole:
+		return stdoutlog.New(stdoutlog.WithWriter(o.console))
+	case exporterOTLP:
+		protocol, err := protocolFor(signalLogs)
+		if err != nil {
+			return nil, err
+		}
+
+		if protocol == protocolGRPC {
+			return otlploggrpc.New(ctx)
+		}
+
+		return otlploghttp.New(ctx)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,48 @@
+package otelsetup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterFor(t *testing.T) {
+	exporter, err := exporterFor(signalTraces)
+	require.NoError(t, err)
+	require.Equal(t, exporterNone, exporter)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4318")
+
+	exporter, err = exporterFor(signalTraces)
+	require.NoError(t, err)
+	require.Equal(t, exporterOTLP, exporter)
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "stdout")
+
+	exporter, err = exporterFor(signalTraces)
+	require.NoError(t, err)
+	require.Equal(t, exporterConsole, exporter)
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp,console")
+
+	_, err = exporterFor(signalTraces)
+	require.Error(t, err)
+}
+
+func TestProtocolFor(t *testing.T) {
+	protocol, err := protocolFor(signalLogs)
+	require.NoError(t, err)
+	require.Equal(t, protocolHTTP, protocol)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+
+	protocol, err = protocolFor(signalLogs)
+	require.NoError(t, err)
+	require.Equal(t, protocolGRPC, protocol)
+
+	// The signal's own variable wins.
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "http/json")
+
+	_, err = protocolFor(signalLogs)
+	require.ErrorContains(t, err, "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL")
+}
@@ -0,0 +1,92 @@
+package otelsetup
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+const (
+	serviceName      = "otlp-log-processor-backend"
+	serviceNamespace = "dash0-exercise"
+)
+
+// newResource describes this process: the service, the SDK, host, OS,
+// container and process, overridden by OTEL_RESOURCE_ATTRIBUTES and
+// OTEL_SERVICE_NAME. The process command line is left out since it may hold
+// secrets. A detector failing only leaves its attributes out.
+func newResource(ctx context.Context) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceNamespace(serviceNamespace),
+			semconv.ServiceVersion(Version()),
+		),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithContainer(),
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithFromEnv(),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		otel.Handle(err)
+		err = nil
+	}
+
+	return res, err
+}
+
+// Version returns the version the binary was built as: the module version
+// when built from a tagged module, otherwise "devel" with the VCS revision
+// stamped by the go tool, if any.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	return versionOf(info)
+}
+
+func versionOf(info *debug.BuildInfo) string {
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	var (
+		revision string
+		modified bool
+	)
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return "devel"
+	}
+
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+
+	v := "devel+" + revision
+	if modified {
+		v += "-dirty"
+	}
+
+	return v
+}
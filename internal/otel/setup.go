@@ -1,32 +1,58 @@
+// Package otelsetup bootstraps the OpenTelemetry pipeline of the process.
+//
+// Exporters are picked per signal by the standard environment variables:
+// OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER and OTEL_LOGS_EXPORTER take
+// otlp, console or none, and OTEL_EXPORTER_OTLP_[<SIGNAL>_]PROTOCOL takes grpc
+// or http/protobuf. Without them, a signal is only exported if an OTLP
+// endpoint is set. Console output is written to stderr as one JSON object per
+// line, apart from the snapshots on stdout. The application logs reach the
+// log exporter only through the bridge, see package logging. Sampling
+// (OTEL_TRACES_SAMPLER), batching and the metric export interval follow the
+// environment as the SDK defines.
 package otelsetup
 
 import (
 	"context"
 	"errors"
-	"time"
+	"io"
+	"os"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
-	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 )
 
-var res = resource.NewWithAttributes(
-	semconv.SchemaURL,
-	semconv.ServiceNameKey.String("otlp-log-processor-backend"),
-	semconv.ServiceNamespaceKey.String("dash0-exercise"),
-	semconv.ServiceVersionKey.String("1.0.0"),
-)
+// Option customizes Setup.
+type Option func(*options)
+
+type options struct {
+	metricReaders []sdkmetric.Reader
+	console       io.Writer
+}
+
+// WithMetricReader installs an additional metric reader next to the
+// configured exporter, e.g. a Prometheus exporter.
+func WithMetricReader(r sdkmetric.Reader) Option {
+	return func(o *options) { o.metricReaders = append(o.metricReaders, r) }
+}
+
+// WithConsoleWriter sets where the console exporters write; by default
+// os.Stderr.
+func WithConsoleWriter(w io.Writer) Option {
+	return func(o *options) { o.console = w }
+}
 
 // Setup bootstraps the OpenTelemetry pipeline and returns a shutdown func.
-func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+func Setup(ctx context.Context, opts ...Option) (shutdown func(context.Context) error, err error) {
+	o := options{console: os.Stderr}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var shutdownFuncs []func(context.Context) error
 
 	shutdown = func(ctx context.Context) error {
@@ -48,8 +74,14 @@ func Setup(ctx context.Context) (shutdown func(context.Context) error, err error
 	prop := newPropagator()
 	otel.SetTextMapPropagator(prop)
 
+	res, err := newResource(ctx)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+
 	// Traces
-	tracerProvider, err := newTraceProvider()
+	tracerProvider, err := newTraceProvider(ctx, res, o)
 	if err != nil {
 		handleErr(err)
 		return
@@ -59,7 +91,7 @@ func Setup(ctx context.Context) (shutdown func(context.Context) error, err error
 	otel.SetTracerProvider(tracerProvider)
 
 	// Metrics
-	meterProvider, err := newMeterProvider()
+	meterProvider, err := newMeterProvider(ctx, res, o)
 	if err != nil {
 		handleErr(err)
 		return
@@ -69,7 +101,7 @@ func Setup(ctx context.Context) (shutdown func(context.Context) error, err error
 	otel.SetMeterProvider(meterProvider)
 
 	// Logs
-	loggerProvider, err := newLoggerProvider()
+	loggerProvider, err := newLoggerProvider(ctx, res, o)
 	if err != nil {
 		handleErr(err)
 		return
@@ -88,45 +120,50 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-func newTraceProvider() (*sdktrace.TracerProvider, error) {
-	traceExporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+// newTraceProvider leaves the sampler to OTEL_TRACES_SAMPLER, parent-based
+// always-on by default.
+func newTraceProvider(ctx context.Context, res *resource.Resource, o options) (*sdktrace.TracerProvider, error) {
+	exporter, err := newSpanExporter(ctx, o)
 	if err != nil {
 		return nil, err
 	}
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(traceExporter, sdktrace.WithBatchTimeout(time.Second)),
-	)
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
 
-	return tp, nil
+	return sdktrace.NewTracerProvider(opts...), nil
 }
 
-func newMeterProvider() (*sdkmetric.MeterProvider, error) {
-	metricExporter, err := stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+func newMeterProvider(ctx context.Context, res *resource.Resource, o options) (*sdkmetric.MeterProvider, error) {
+	exporter, err := newMetricExporter(ctx, o)
 	if err != nil {
 		return nil, err
 	}
 
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(10*time.Second))),
-	)
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	}
+
+	for _, r := range o.metricReaders {
+		opts = append(opts, sdkmetric.WithReader(r))
+	}
 
-	return mp, nil
+	return sdkmetric.NewMeterProvider(opts...), nil
 }
 
-func newLoggerProvider() (*sdklog.LoggerProvider, error) {
-	logExporter, err := stdoutlog.New(stdoutlog.WithPrettyPrint())
+func newLoggerProvider(ctx context.Context, res *resource.Resource, o options) (*sdklog.LoggerProvider, error) {
+	exporter, err := newLogExporter(ctx, o)
 	if err != nil {
 		return nil, err
 	}
 
-	lp := sdklog.NewLoggerProvider(
-		sdklog.WithResource(res),
-		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
-	)
+	opts := []sdklog.LoggerProviderOption{sdklog.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)))
+	}
 
-	return lp, nil
+	return sdklog.NewLoggerProvider(opts...), nil
 }
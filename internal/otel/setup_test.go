@@ -1,10 +1,17 @@
 package otelsetup
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
 )
 
 func TestSetupAndShutdown(t *testing.T) {
@@ -13,3 +20,79 @@ func TestSetupAndShutdown(t *testing.T) {
 	require.NotNil(t, shutdown)
 	require.NoError(t, shutdown(context.Background()))
 }
+
+func TestSetup_WithMetricReader(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment.name=test")
+
+	reader := sdkmetric.NewManualReader()
+
+	shutdown, err := Setup(context.Background(), WithMetricReader(reader))
+	require.NoError(t, err)
+
+	counter, err := otel.Meter("test").Int64Counter("test.counter")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 2)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Equal(t, "test.counter", rm.ScopeMetrics[0].Metrics[0].Name)
+
+	// Service identity, detected attributes and the environment.
+	version, ok := rm.Resource.Set().Value(semconv.ServiceVersionKey)
+	require.True(t, ok)
+	require.Equal(t, Version(), version.AsString())
+	require.True(t, rm.Resource.Set().HasValue(semconv.ProcessPIDKey))
+
+	env, ok := rm.Resource.Set().Value("deployment.environment.name")
+	require.True(t, ok)
+	require.Equal(t, "test", env.AsString())
+
+	require.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetup_ConsoleLogs(t *testing.T) {
+	t.Setenv("OTEL_LOGS_EXPORTER", "console")
+
+	var buf bytes.Buffer
+
+	shutdown, err := Setup(context.Background(), WithConsoleWriter(&buf))
+	require.NoError(t, err)
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("hello"))
+	global.GetLoggerProvider().Logger("test").Emit(context.Background(), rec)
+
+	require.NoError(t, shutdown(context.Background()))
+	require.Contains(t, buf.String(), `"Value":"hello"`)
+	require.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestSetup_NoneAndSampler(t *testing.T) {
+	t.Setenv("OTEL_LOGS_EXPORTER", "none")
+	t.Setenv("OTEL_TRACES_EXPORTER", "console")
+	t.Setenv("OTEL_TRACES_SAMPLER", "always_off")
+
+	var buf bytes.Buffer
+
+	shutdown, err := Setup(context.Background(), WithConsoleWriter(&buf))
+	require.NoError(t, err)
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("hello"))
+	global.GetLoggerProvider().Logger("test").Emit(context.Background(), rec)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "span")
+	require.False(t, span.SpanContext().IsSampled())
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+	require.Empty(t, buf.String())
+}
+
+func TestSetup_InvalidExporter(t *testing.T) {
+	t.Setenv("OTEL_METRICS_EXPORTER", "prometheus")
+
+	_, err := Setup(context.Background())
+	require.ErrorContains(t, err, `OTEL_METRICS_EXPORTER: unsupported exporter "prometheus"`)
+}
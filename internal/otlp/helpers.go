@@ -1,62 +1,277 @@
 package otlp
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
-	"strings"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
 
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 )
 
+// Outcome classifies how a key resolved against a log record.
+type Outcome uint8
+
+const (
+	// Found means the key resolved to a supported, non-empty value.
+	Found Outcome = iota
+	// Missing means the key is absent at every level.
+	Missing
+	// Null means the key is present but its value is nil, unset or an empty string.
+	Null
+	// Unsupported means the key is present but its value type cannot be rendered,
+	// e.g. a value kind added to OTLP after this build.
+	Unsupported
+)
+
+// String returns the lower-case name of the outcome.
+func (o Outcome) String() string {
+	switch o {
+	case Found:
+		return "found"
+	case Missing:
+		return "missing"
+	case Null:
+		return "null"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return fmt.Sprintf("outcome(%d)", uint8(o))
+	}
+}
+
 // ExtractAttrs finds the attribute value by precedence: logAttrs > scopeAttrs > resourceAttrs.
-// Returns the canonical string representation and true if the key was found.
+// Returns the canonical string representation and true if the key was found with a supported value.
 func ExtractAttrs(key string, logAttrs, scopeAttrs, resourceAttrs []*commonpb.KeyValue) (string, bool) {
+	v, o := resolveAttrs(key, logAttrs, scopeAttrs, resourceAttrs)
+
+	return v, o == Found
+}
+
+// resolveAttrs applies the same precedence as ExtractAttrs. The most specific
+// level that carries the key decides the outcome, so a null log attribute
+// shadows a scope or resource value rather than falling through to it.
+func resolveAttrs(key string, logAttrs, scopeAttrs, resourceAttrs []*commonpb.KeyValue) (string, Outcome) {
 	if v, ok := findInKVs(key, logAttrs); ok {
-		return v, true
+		return renderValue(v)
 	}
 
 	if v, ok := findInKVs(key, scopeAttrs); ok {
-		return v, true
+		return renderValue(v)
 	}
 
 	if v, ok := findInKVs(key, resourceAttrs); ok {
-		return v, true
+		return renderValue(v)
 	}
 
-	return "", false
+	return "", Missing
 }
 
-func findInKVs(key string, kvs []*commonpb.KeyValue) (string, bool) {
+// findInKVs returns the value stored under key and whether the key is present.
+// A present key may still carry a nil value.
+func findInKVs(key string, kvs []*commonpb.KeyValue) (*commonpb.AnyValue, bool) {
 	for _, kv := range kvs {
 		if kv.GetKey() == key {
-			if kv.GetValue() == nil {
-				return "", false
-			}
-
-			return anyToString(kv.GetValue()), true
+			return kv.GetValue(), true
 		}
 	}
 
-	return "", false
+	return nil, false
 }
 
+// renderValue converts a present attribute value to its canonical string,
+// classifying nil, unset and empty string values as Null.
+func renderValue(v *commonpb.AnyValue) (string, Outcome) {
+	switch x := v.GetValue().(type) {
+	case nil:
+		return "", Null
+	case *commonpb.AnyValue_StringValue:
+		if x.StringValue == "" {
+			return "", Null
+		}
+
+		return x.StringValue, Found
+	case *commonpb.AnyValue_BoolValue,
+		*commonpb.AnyValue_IntValue,
+		*commonpb.AnyValue_DoubleValue,
+		*commonpb.AnyValue_BytesValue,
+		*commonpb.AnyValue_ArrayValue,
+		*commonpb.AnyValue_KvlistValue:
+		return anyToString(v), Found
+	default:
+		return "", Unsupported
+	}
+}
+
+// anyToString renders a value as its canonical group key. Scalars keep their
+// plain form (strings are not quoted); arrays and kvlists use a compact
+// JSON-like encoding with kvlist entries sorted by key, so equal structures
+// always produce the same key regardless of the order they were sent in.
+//
+// Keys do not carry the value type, by design: the string "true" and the bool
+// true share a group, as do the string `["a"]` and the array ["a"]. This keeps
+// string keys readable and matches how the same attribute sent by differently
+// typed SDKs is meant to be counted.
 func anyToString(v *commonpb.AnyValue) string {
 	switch x := v.Value.(type) {
 	case *commonpb.AnyValue_StringValue:
 		return x.StringValue
 	case *commonpb.AnyValue_BoolValue:
-		if x.BoolValue {
-			return "true"
-		}
-
-		return "false"
+		return strconv.FormatBool(x.BoolValue)
 	case *commonpb.AnyValue_IntValue:
-		return fmt.Sprintf("%d", x.IntValue)
+		return strconv.FormatInt(x.IntValue, 10)
 	case *commonpb.AnyValue_DoubleValue:
-		return fmt.Sprintf("%g", x.DoubleValue)
+		return string(appendFloat(nil, x.DoubleValue))
 	case *commonpb.AnyValue_BytesValue:
 		return base64.StdEncoding.EncodeToString(x.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		return string(appendCanonical(make([]byte, 0, 64), v))
 	default:
 		return "<unknown>"
 	}
 }
+
+// appendCanonical appends the JSON-like encoding of v. Nested strings and
+// bytes are quoted, non-finite doubles are quoted strings, and nil or unset
+// values encode as null.
+func appendCanonical(buf []byte, v *commonpb.AnyValue) []byte {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return appendQuoted(buf, x.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.AppendBool(buf, x.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.AppendInt(buf, x.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(x.DoubleValue) || math.IsInf(x.DoubleValue, 0) {
+			return appendQuoted(buf, string(appendFloat(nil, x.DoubleValue)))
+		}
+
+		return appendFloat(buf, x.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		return appendQuoted(buf, base64.StdEncoding.EncodeToString(x.BytesValue))
+	case *commonpb.AnyValue_ArrayValue:
+		buf = append(buf, '[')
+		for i, e := range x.ArrayValue.GetValues() {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+
+			buf = appendCanonical(buf, e)
+		}
+
+		return append(buf, ']')
+	case *commonpb.AnyValue_KvlistValue:
+		return appendKvlist(buf, x.KvlistValue.GetValues())
+	default:
+		return append(buf, "null"...)
+	}
+}
+
+func appendKvlist(buf []byte, kvs []*commonpb.KeyValue) []byte {
+	type entry struct {
+		key string
+		val []byte
+	}
+
+	entries := make([]entry, len(kvs))
+	for i, kv := range kvs {
+		entries[i] = entry{key: kv.GetKey(), val: appendCanonical(nil, kv.GetValue())}
+	}
+
+	// Duplicate keys are invalid OTLP but still need a stable order.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+
+		return bytes.Compare(entries[i].val, entries[j].val) < 0
+	})
+
+	buf = append(buf, '{')
+	for i, e := range entries {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		buf = appendQuoted(buf, e.key)
+		buf = append(buf, ':')
+		buf = append(buf, e.val...)
+	}
+
+	return append(buf, '}')
+}
+
+// appendFloat formats f the way JSON (ECMAScript) does: the shortest
+// representation that round-trips, in plain notation for 1e-6 <= |f| < 1e21
+// and exponent notation otherwise. Non-finite values render as NaN, +Inf, -Inf.
+func appendFloat(buf []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(buf, "NaN"...)
+	case math.IsInf(f, 1):
+		return append(buf, "+Inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-Inf"...)
+	}
+
+	abs := math.Abs(f)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		buf = strconv.AppendFloat(buf, f, 'e', -1, 64)
+		// Normalize e-07 to e-7 to match the ECMAScript form.
+		if n := len(buf); n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+
+		return buf
+	}
+
+	return strconv.AppendFloat(buf, f, 'f', -1, 64)
+}
+
+// appendQuoted appends s as a JSON string literal without HTML escaping.
+// Invalid UTF-8 is replaced with U+FFFD so the output is always valid JSON.
+func appendQuoted(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	buf = append(buf, '"')
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+
+			i++
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = utf8.AppendRune(buf, utf8.RuneError)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+
+		i += size
+	}
+
+	return append(buf, '"')
+}
@@ -0,0 +1,108 @@
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Run with: go test -fuzz=FuzzCanonical_Structured ./internal/otlp
+func FuzzCanonical_Structured(f *testing.F) {
+	f.Add("bar", int64(42), 3.14, true, []byte{0xDE, 0xAD})
+	f.Add("", int64(-1), math.Inf(-1), false, []byte{})
+	f.Add("quote\"back\\slash\nnl\x01", int64(math.MaxInt64), 1e-7, true, []byte(nil))
+	f.Add("ünïcode ✓", int64(math.MinInt64), math.NaN(), false, []byte("x"))
+
+	f.Fuzz(func(t *testing.T, s string, i int64, d float64, b bool, raw []byte) {
+		if !utf8.ValidString(s) {
+			// Proto string fields must hold valid UTF-8, so such input never reaches ExtractAttrs.
+			t.Skip()
+		}
+
+		leaves := []*commonpb.KeyValue{
+			{Key: "s", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}},
+			{Key: "i", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}},
+			{Key: "d", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: d}}},
+			{Key: "b", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: b}}},
+			{Key: "raw", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: raw}}},
+			{Key: s, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+				Values: []*commonpb.AnyValue{{Value: &commonpb.AnyValue_StringValue{StringValue: s}}, {}},
+			}}}},
+		}
+		reversed := make([]*commonpb.KeyValue, len(leaves))
+		for n, kv := range leaves {
+			reversed[len(leaves)-1-n] = kv
+		}
+
+		v := &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: leaves}}}
+		got := anyToString(v)
+
+		// Valid JSON, so downstream consumers can parse structured group keys.
+		if !json.Valid([]byte(got)) {
+			t.Fatalf("not valid JSON: %q", got)
+		}
+
+		// Stable across a protobuf wire round trip.
+		wire, err := proto.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+
+		decoded := &commonpb.AnyValue{}
+		if err := proto.Unmarshal(wire, decoded); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+
+		if again := anyToString(decoded); again != got {
+			t.Fatalf("unstable after round trip:\n%q\n%q", got, again)
+		}
+
+		// Independent of kvlist entry order.
+		rv := &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: reversed}}}
+		if other := anyToString(rv); other != got {
+			t.Fatalf("depends on key order:\n%q\n%q", got, other)
+		}
+
+		// Leaf values survive decoding of the canonical form, unless s collides
+		// with one of the fixed keys above.
+		var m map[string]any
+		if err := json.Unmarshal([]byte(got), &m); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		switch s {
+		case "s", "i", "d", "b", "raw":
+		default:
+			if m["s"] != s {
+				t.Fatalf("string leaf mismatch: %q != %q", m["s"], s)
+			}
+		}
+	})
+}
+
+func FuzzCanonical_Double(f *testing.F) {
+	for _, d := range []float64{0, -0.0, 1, 3.14, 1e-6, 1e-7, 1e20, 1e21, math.MaxFloat64, math.SmallestNonzeroFloat64} {
+		f.Add(d)
+	}
+
+	f.Fuzz(func(t *testing.T, d float64) {
+		got := anyToString(&commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: d}})
+		if math.IsNaN(d) || math.IsInf(d, 0) {
+			return
+		}
+
+		back, err := strconv.ParseFloat(got, 64)
+		if err != nil {
+			t.Fatalf("parse %q: %v", got, err)
+		}
+
+		if back != d {
+			t.Fatalf("round trip of %v gave %q -> %v", d, got, back)
+		}
+	})
+}
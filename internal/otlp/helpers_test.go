@@ -1,6 +1,7 @@
 package otlp
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -55,6 +56,42 @@ func TestExtractAttrs_Missing(t *testing.T) {
 	require.Equal(t, "", got)
 }
 
+func TestResolveAttrs_Outcomes(t *testing.T) {
+	key := "foo"
+	nullKV := &commonpb.KeyValue{Key: key}
+	emptyKV := &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{}}
+	arrayKV := &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{}}}}
+	kvlistKV := &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{}}}}
+
+	tests := []struct {
+		name     string
+		logAttrs []*commonpb.KeyValue
+		resAttrs []*commonpb.KeyValue
+		want     string
+		outcome  Outcome
+	}{
+		{name: "missing", outcome: Missing},
+		{name: "nil_value", logAttrs: []*commonpb.KeyValue{nullKV}, outcome: Null},
+		{name: "unset_value", logAttrs: []*commonpb.KeyValue{emptyKV}, outcome: Null},
+		{name: "empty_string", logAttrs: []*commonpb.KeyValue{kvStr(key, "")}, outcome: Null},
+		{name: "array", logAttrs: []*commonpb.KeyValue{arrayKV}, want: "[]", outcome: Found},
+		{name: "kvlist", logAttrs: []*commonpb.KeyValue{kvlistKV}, want: "{}", outcome: Found},
+		{name: "literal_unknown_is_a_value", logAttrs: []*commonpb.KeyValue{kvStr(key, "unknown")}, want: "unknown", outcome: Found},
+		{name: "null_shadows_resource", logAttrs: []*commonpb.KeyValue{nullKV}, resAttrs: []*commonpb.KeyValue{kvStr(key, "res")}, outcome: Null},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, outcome := resolveAttrs(key, tt.logAttrs, nil, tt.resAttrs)
+			require.Equal(t, tt.outcome, outcome)
+			require.Equal(t, tt.want, got)
+
+			_, ok := ExtractAttrs(key, tt.logAttrs, nil, tt.resAttrs)
+			require.Equal(t, tt.outcome == Found, ok)
+		})
+	}
+}
+
 func TestExtractAttrs_IntAndStringify(t *testing.T) {
 	key := "foo"
 	logAttrs := []*commonpb.KeyValue{kvInt("foo", 42)}
@@ -100,14 +137,58 @@ func TestAnyToString_Types(t *testing.T) {
 			want: "3q0=",
 		},
 		{
-			name: "array_fallback",
+			name: "double_integral",
+			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1e8}},
+			want: "100000000",
+		},
+		{
+			name: "double_small_exponent",
+			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5e-7}},
+			want: "1.5e-7",
+		},
+		{
+			name: "double_large_exponent",
+			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 2e21}},
+			want: "2e+21",
+		},
+		{
+			name: "double_nan",
+			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: math.NaN()}},
+			want: "NaN",
+		},
+		{
+			name: "array_empty",
 			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{}}},
-			want: "<unknown>",
+			want: "[]",
+		},
+		{
+			name: "array_mixed",
+			val: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: []*commonpb.AnyValue{
+				{Value: &commonpb.AnyValue_StringValue{StringValue: "a\"b"}},
+				{Value: &commonpb.AnyValue_IntValue{IntValue: -1}},
+				{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.5}},
+				{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: math.Inf(1)}},
+				{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}},
+				{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte{0xDE, 0xAD}}},
+				{},
+				nil,
+			}}}},
+			want: `["a\"b",-1,0.5,"+Inf",true,"3q0=",null,null]`,
+		},
+		{
+			name: "object_sorted_keys",
+			val: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{
+				kvStr("b", "2"),
+				kvInt("a", 1),
+				{Key: "c", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{kvStr("z", "<&>"), kvStr("y", "")}}}}},
+			}}}},
+			want: `{"a":1,"b":"2","c":{"y":"","z":"<&>"}}`,
 		},
 		{
-			name: "object_fallback",
-			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{kvStr("a", "b")}}}},
-			want: "<unknown>",
+			// Keys are untyped: a string spelling an array shares its group.
+			name: "string_spelling_array",
+			val:  &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: `["a"]`}},
+			want: `["a"]`,
 		},
 	}
 
@@ -3,22 +3,62 @@ package otlp
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	oteltrace "go.opentelemetry.io/otel/trace"
 	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
 	"dash0.com/otlp-log-processor-backend/internal/orchestrator"
 )
 
+// throttleRetryDelay is the delay clients are asked to wait when the forward
+// queue is full.
+const throttleRetryDelay = time.Second
+
+// Forwarder passes counted requests on upstream; Forward reports false when
+// it has no room, see forward.Forwarder.
+type Forwarder interface {
+	Forward(req *collogspb.ExportLogsServiceRequest) bool
+}
+
 type logsServiceServer struct {
 	orchestratorSvc orchestrator.Orchestrator
+	forwarder       Forwarder
+	sampler         Sampler
 	collogspb.UnimplementedLogsServiceServer
 }
 
+// ServerOption configures the LogsServiceServer.
+type ServerOption func(*logsServiceServer)
+
+// WithForwarder forwards every request, after sampling, as it is counted. When
+// the forwarder is full the request is refused with RESOURCE_EXHAUSTED and a
+// retry delay before anything is counted, so the client's retry is not counted
+// twice.
+func WithForwarder(f Forwarder) ServerOption {
+	return func(l *logsServiceServer) { l.forwarder = f }
+}
+
+// WithSampleRatio counts, and forwards, only the given fraction of the log
+// records; see Sampler.
+func WithSampleRatio(ratio float64) ServerOption {
+	return func(l *logsServiceServer) { l.sampler = NewSampler(ratio) }
+}
+
 // NewServer returns a LogsServiceServer backed by the provided Orchestrator.
-func NewServer(svc orchestrator.Orchestrator) collogspb.LogsServiceServer {
-	return &logsServiceServer{orchestratorSvc: svc}
+func NewServer(svc orchestrator.Orchestrator, opts ...ServerOption) collogspb.LogsServiceServer {
+	l := &logsServiceServer{orchestratorSvc: svc, sampler: NewSampler(1)}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
 }
 
 func (l *logsServiceServer) Export(ctx context.Context, request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
@@ -27,50 +67,62 @@ func (l *logsServiceServer) Export(ctx context.Context, request *collogspb.Expor
 
 	slog.DebugContext(ctx, "Received ExportLogsServiceRequest")
 
+	request, sampledOut := l.sampler.Sample(request)
+
+	if l.forwarder != nil && !l.forwarder.Forward(request) {
+		return nil, l.throttle(ctx, request, sampledOut)
+	}
+
 	var rejected uint64
 
-	var receivedCount int64
+	receivedCount := sampledOut
 
 	var processedCount int64
 
 	var droppedCount int64
 
-	// Collect attribute values for this request and enqueue as a single batch.
-	var batch []string
+	// Collect attribute values for this request and enqueue as a single batch,
+	// tagged with the generation of the key they were resolved under.
+	settings := l.orchestratorSvc.RuntimeConfig()
+	key := settings.AttributeKey
+	batch := aggregator.Batch{Generation: settings.Generation}
 
 	for _, rl := range request.GetResourceLogs() {
-		// Safe even if Resource is nil; GetAttributes() returns nil in that case.
-		resAttrs := rl.GetResource().GetAttributes()
-
 		for _, sl := range rl.GetScopeLogs() {
-			scopeAttrs := sl.GetScope().GetAttributes()
-
 			for _, rec := range sl.GetLogRecords() {
 				receivedCount++
 
-				val, ok := ExtractAttrs(l.orchestratorSvc.AttributeKey(), rec.GetAttributes(), scopeAttrs, resAttrs)
-				if !ok {
-					val = "unknown"
+				// Safe even if Resource or Scope is nil; the getters return zero values in that case.
+				val, outcome := ExtractValue(key, rl, sl, rec)
+				switch outcome {
+				case Found:
+					batch.Values = append(batch.Values, val)
+				case Missing:
+					batch.Missing++
+				case Null:
+					batch.Null++
+				case Unsupported:
+					batch.Unsupported++
 				}
-
-				batch = append(batch, val)
 			}
 		}
 	}
 
 	// Enqueue non-blocking as a single batch; on failure, record drop and rejected for all.
 	if l.orchestratorSvc.EnqueueBatch(batch) {
-		processedCount += int64(len(batch))
+		processedCount += int64(batch.Len())
 	} else {
-		rejected += uint64(len(batch))
-		droppedCount += int64(len(batch))
-		l.orchestratorSvc.RecordDrop(uint64(len(batch)))
+		rejected += uint64(batch.Len())
+		droppedCount += int64(batch.Len())
+		l.orchestratorSvc.RecordDrop(uint64(batch.Len()))
 	}
 
 	// Update metrics once per request.
 	l.orchestratorSvc.IncrMetric(ctx, orchestrator.MetricLogsReceived, receivedCount)
 	l.orchestratorSvc.IncrMetric(ctx, orchestrator.MetricLogsProcessed, processedCount)
 	l.orchestratorSvc.IncrMetric(ctx, orchestrator.MetricLogsDropped, droppedCount)
+	l.orchestratorSvc.IncrMetric(ctx, orchestrator.MetricLogsSampledOut, sampledOut)
+	l.orchestratorSvc.RecordExportBatch(ctx, receivedCount)
 
 	resp := &collogspb.ExportLogsServiceResponse{}
 	if rejected > 0 {
@@ -81,8 +133,12 @@ func (l *logsServiceServer) Export(ctx context.Context, request *collogspb.Expor
 		attribute.Int64("logs.received", receivedCount),
 		attribute.Int64("logs.processed", processedCount),
 		attribute.Int64("logs.dropped", droppedCount),
+		attribute.Int64("logs.sampled_out", sampledOut),
 		attribute.Int64("logs.rejected", int64(rejected)),
-		attribute.Int("batch.size", len(batch)),
+		attribute.Int("batch.size", batch.Len()),
+		attribute.Int64("logs.missing", int64(batch.Missing)),
+		attribute.Int64("logs.null", int64(batch.Null)),
+		attribute.Int64("logs.unsupported", int64(batch.Unsupported)),
 	)
 	slog.DebugContext(
 		ctx,
@@ -91,8 +147,30 @@ func (l *logsServiceServer) Export(ctx context.Context, request *collogspb.Expor
 		slog.Int64("processed", processedCount),
 		slog.Int64("dropped", droppedCount),
 		slog.Uint64("rejected", rejected),
-		slog.Int("batch_size", len(batch)),
+		slog.Int("batch_size", batch.Len()),
 	)
 
 	return resp, nil
 }
+
+// throttle records a request refused because the forwarder is full and
+// returns the RESOURCE_EXHAUSTED status telling the client when to retry.
+func (l *logsServiceServer) throttle(ctx context.Context, request *collogspb.ExportLogsServiceRequest, sampledOut int64) error {
+	var n int64
+	for _, rl := range request.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			n += int64(len(sl.GetLogRecords()))
+		}
+	}
+
+	l.orchestratorSvc.IncrMetric(ctx, orchestrator.MetricLogsThrottled, n+sampledOut)
+	oteltrace.SpanFromContext(ctx).SetAttributes(attribute.Int64("logs.throttled", n+sampledOut))
+	slog.DebugContext(ctx, "Forward queue full; refusing ExportLogsServiceRequest", slog.Int64("records", n+sampledOut))
+
+	st := status.New(codes.ResourceExhausted, "forward queue full")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(throttleRetryDelay)}); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
@@ -15,6 +15,9 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	cfgpkg "dash0.com/otlp-log-processor-backend/internal/config"
 	"dash0.com/otlp-log-processor-backend/internal/orchestrator"
@@ -99,15 +102,22 @@ func buildPrecedenceRequest(t *testing.T, key string) *collogspb.ExportLogsServi
 	recScope2 := &otellogs.LogRecord{}                                                       // picks scopev
 	recRes := &otellogs.LogRecord{}                                                          // in scope2 -> resv
 	recUnknown := &otellogs.LogRecord{Attributes: []*commonpb.KeyValue{kvStr("other", "x")}} // unknown
+	recMissing := &otellogs.LogRecord{}                                                      // in unkeyed resource -> missing
 
 	scope1.LogRecords = []*otellogs.LogRecord{recLog, recScope, recScope2}
 	scope2.LogRecords = []*otellogs.LogRecord{recRes, recUnknown}
+	scope3 := &otellogs.ScopeLogs{LogRecords: []*otellogs.LogRecord{recMissing}}
 
 	return &collogspb.ExportLogsServiceRequest{
-		ResourceLogs: []*otellogs.ResourceLogs{{
-			Resource:  res,
-			ScopeLogs: []*otellogs.ScopeLogs{scope1, scope2},
-		}},
+		ResourceLogs: []*otellogs.ResourceLogs{
+			{
+				Resource:  res,
+				ScopeLogs: []*otellogs.ScopeLogs{scope1, scope2},
+			},
+			{
+				ScopeLogs: []*otellogs.ScopeLogs{scope3},
+			},
+		},
 	}
 }
 
@@ -169,4 +179,32 @@ func TestExport_AttributePrecedence_AggregatesCounts(t *testing.T) {
 	// Resource-level attribute covers records in scope without key; both records in scope2 fall back to resource.
 	require.EqualValues(t, 2, counts["resv"])
 	require.NotContains(t, counts, "unknown")
+	require.EqualValues(t, 1, captured.Missing)
+	require.Zero(t, captured.Null)
+	require.Zero(t, captured.Unsupported)
+	require.EqualValues(t, 6, captured.Total)
+}
+
+type fullForwarder struct{ calls int }
+
+func (f *fullForwarder) Forward(*collogspb.ExportLogsServiceRequest) bool {
+	f.calls++
+	return false
+}
+
+func TestExport_ForwarderFull_ResourceExhausted(t *testing.T) {
+	svc := makeSvc(t, 10)
+	fwd := &fullForwarder{}
+	srv := NewServer(svc, WithForwarder(fwd))
+
+	_, err := srv.Export(context.Background(), reqWithN(3))
+	require.Equal(t, 1, fwd.calls)
+
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	ri, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, throttleRetryDelay, ri.GetRetryDelay().AsDuration())
 }
@@ -0,0 +1,73 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// Sampler keeps a fraction of the log records of a request. Records with a
+// trace ID are kept or dropped with their whole trace, the way an OpenTelemetry
+// TraceIdRatioBased sampler decides; other records are kept at random.
+type Sampler struct {
+	ratio float64
+	bound uint64
+}
+
+// NewSampler returns a sampler keeping ratio of the records; ratios of 1 or
+// more keep everything.
+func NewSampler(ratio float64) Sampler {
+	return Sampler{ratio: ratio, bound: uint64(min(max(ratio, 0), 1) * (1 << 63))}
+}
+
+// keepAll reports whether the sampler keeps every record.
+func (s Sampler) keepAll() bool { return s.ratio >= 1 }
+
+func (s Sampler) keep(rec *logspb.LogRecord) bool {
+	if id := rec.GetTraceId(); len(id) == 16 {
+		return binary.BigEndian.Uint64(id[8:])>>1 < s.bound
+	}
+
+	return rand.Float64() < s.ratio
+}
+
+// Sample returns a request holding only the kept records, and the number of
+// records dropped. req itself is not modified; it is returned as is when every
+// record is kept. Resources and scopes left without records are omitted.
+func (s Sampler) Sample(req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceRequest, int64) {
+	if s.keepAll() {
+		return req, 0
+	}
+
+	out := &collogspb.ExportLogsServiceRequest{}
+
+	var dropped int64
+
+	for _, rl := range req.GetResourceLogs() {
+		var scopes []*logspb.ScopeLogs
+
+		for _, sl := range rl.GetScopeLogs() {
+			var recs []*logspb.LogRecord
+
+			for _, rec := range sl.GetLogRecords() {
+				if s.keep(rec) {
+					recs = append(recs, rec)
+				} else {
+					dropped++
+				}
+			}
+
+			if len(recs) > 0 {
+				scopes = append(scopes, &logspb.ScopeLogs{Scope: sl.GetScope(), LogRecords: recs, SchemaUrl: sl.GetSchemaUrl()})
+			}
+		}
+
+		if len(scopes) > 0 {
+			out.ResourceLogs = append(out.ResourceLogs, &logspb.ResourceLogs{Resource: rl.GetResource(), ScopeLogs: scopes, SchemaUrl: rl.GetSchemaUrl()})
+		}
+	}
+
+	return out, dropped
+}
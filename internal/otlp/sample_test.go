@@ -0,0 +1,48 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	otellogs "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+func traceID(n uint64) []byte {
+	id := make([]byte, 16)
+	binary.BigEndian.PutUint64(id[8:], n)
+
+	return id
+}
+
+func TestSampler_KeepAllReturnsRequest(t *testing.T) {
+	req := reqWithN(3)
+
+	out, dropped := NewSampler(1).Sample(req)
+	require.Same(t, req, out)
+	require.Zero(t, dropped)
+}
+
+func TestSampler_ByTraceID(t *testing.T) {
+	low := &otellogs.LogRecord{TraceId: traceID(0)}
+	high := &otellogs.LogRecord{TraceId: traceID(^uint64(0))}
+	lowAgain := &otellogs.LogRecord{TraceId: traceID(0), EventName: "again"}
+
+	req := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*otellogs.ResourceLogs{
+		{ScopeLogs: []*otellogs.ScopeLogs{{LogRecords: []*otellogs.LogRecord{low, high}}}},
+		{ScopeLogs: []*otellogs.ScopeLogs{{LogRecords: []*otellogs.LogRecord{high}}}},
+		{ScopeLogs: []*otellogs.ScopeLogs{{LogRecords: []*otellogs.LogRecord{lowAgain}}}},
+	}}
+
+	out, dropped := NewSampler(0.5).Sample(req)
+	require.EqualValues(t, 2, dropped)
+
+	// Records of one trace share a decision; the emptied resource is omitted.
+	require.Len(t, out.GetResourceLogs(), 2)
+	require.Equal(t, []*otellogs.LogRecord{low}, out.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords())
+	require.Equal(t, []*otellogs.LogRecord{lowAgain}, out.GetResourceLogs()[1].GetScopeLogs()[0].GetLogRecords())
+
+	// The request itself is left alone.
+	require.Len(t, req.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords(), 2)
+}
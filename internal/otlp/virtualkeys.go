@@ -0,0 +1,87 @@
+package otlp
+
+import (
+	"strconv"
+	"strings"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// VirtualKeyPrefix marks reserved key names that resolve to OTLP record fields
+// rather than attributes. Attributes whose key starts with this prefix cannot be
+// targeted directly.
+const VirtualKeyPrefix = "@"
+
+// Reserved virtual keys understood by ExtractValue.
+const (
+	KeySeverityText      = "@severity_text"
+	KeySeverityNumber    = "@severity_number"
+	KeyEventName         = "@event_name"
+	KeyScopeName         = "@scope.name"
+	KeyScopeVersion      = "@scope.version"
+	KeyScopeSchemaURL    = "@scope.schema_url"
+	KeyResourceSchemaURL = "@resource.schema_url"
+	KeyTracePresent      = "@trace_present"
+)
+
+// IsVirtualKey reports whether key uses the reserved virtual key prefix.
+func IsVirtualKey(key string) bool { return strings.HasPrefix(key, VirtualKeyPrefix) }
+
+// ExtractValue resolves key for a single log record. Virtual keys are read from
+// the record, its scope or its resource; all other keys are looked up as
+// attributes with the same precedence as ExtractAttrs. Returns the canonical
+// string and Found, or an empty string and the reason no value was produced.
+func ExtractValue(key string, rl *logspb.ResourceLogs, sl *logspb.ScopeLogs, rec *logspb.LogRecord) (string, Outcome) {
+	if !IsVirtualKey(key) {
+		return resolveAttrs(key, rec.GetAttributes(), sl.GetScope().GetAttributes(), rl.GetResource().GetAttributes())
+	}
+
+	if v, ok := extractVirtual(key, rl, sl, rec); ok {
+		return v, Found
+	}
+
+	return "", Missing
+}
+
+func extractVirtual(key string, rl *logspb.ResourceLogs, sl *logspb.ScopeLogs, rec *logspb.LogRecord) (string, bool) {
+	switch key {
+	case KeySeverityText:
+		return nonEmpty(rec.GetSeverityText())
+	case KeySeverityNumber:
+		if n := rec.GetSeverityNumber(); n != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+			return strconv.Itoa(int(n)), true
+		}
+
+		return "", false
+	case KeyEventName:
+		return nonEmpty(rec.GetEventName())
+	case KeyScopeName:
+		return nonEmpty(sl.GetScope().GetName())
+	case KeyScopeVersion:
+		return nonEmpty(sl.GetScope().GetVersion())
+	case KeyScopeSchemaURL:
+		return nonEmpty(sl.GetSchemaUrl())
+	case KeyResourceSchemaURL:
+		return nonEmpty(rl.GetSchemaUrl())
+	case KeyTracePresent:
+		return strconv.FormatBool(validTraceID(rec.GetTraceId())), true
+	default:
+		return "", false
+	}
+}
+
+// nonEmpty treats the proto3 zero value as absent, since unset and empty
+// string fields are indistinguishable on the wire.
+func nonEmpty(s string) (string, bool) { return s, s != "" }
+
+// validTraceID reports whether id is a non-zero trace id; an all-zero id is
+// invalid per the OTLP spec and treated as no trace context.
+func validTraceID(id []byte) bool {
+	for _, b := range id {
+		if b != 0 {
+			return true
+		}
+	}
+
+	return false
+}
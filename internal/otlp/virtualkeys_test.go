@@ -0,0 +1,81 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func TestExtractValue_VirtualKeys(t *testing.T) {
+	rl := &logspb.ResourceLogs{
+		Resource:  &resourcepb.Resource{Attributes: []*commonpb.KeyValue{kvStr("foo", "res")}},
+		SchemaUrl: "https://opentelemetry.io/schemas/1.27.0",
+	}
+	sl := &logspb.ScopeLogs{
+		Scope:     &commonpb.InstrumentationScope{Name: "checkout", Version: "1.2.3"},
+		SchemaUrl: "https://opentelemetry.io/schemas/1.26.0",
+	}
+	rec := &logspb.LogRecord{
+		SeverityText:   "WARN",
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+		EventName:      "payment.failed",
+		TraceId:        []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		Attributes:     []*commonpb.KeyValue{kvStr("@severity_text", "shadowed")},
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{KeySeverityText, "WARN"},
+		{KeySeverityNumber, "13"},
+		{KeyEventName, "payment.failed"},
+		{KeyScopeName, "checkout"},
+		{KeyScopeVersion, "1.2.3"},
+		{KeyScopeSchemaURL, "https://opentelemetry.io/schemas/1.26.0"},
+		{KeyResourceSchemaURL, "https://opentelemetry.io/schemas/1.27.0"},
+		{KeyTracePresent, "true"},
+		{"foo", "res"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, outcome := ExtractValue(tt.key, rl, sl, rec)
+			require.Equal(t, Found, outcome)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractValue_VirtualKeysAbsent(t *testing.T) {
+	rl := &logspb.ResourceLogs{}
+	sl := &logspb.ScopeLogs{}
+	rec := &logspb.LogRecord{TraceId: make([]byte, 16)}
+
+	for _, key := range []string{
+		KeySeverityText,
+		KeySeverityNumber,
+		KeyEventName,
+		KeyScopeName,
+		KeyScopeVersion,
+		KeyScopeSchemaURL,
+		KeyResourceSchemaURL,
+		"@no_such_field",
+	} {
+		_, outcome := ExtractValue(key, rl, sl, rec)
+		require.Equalf(t, Missing, outcome, "key %q", key)
+	}
+
+	// An all-zero trace id is not trace context.
+	got, outcome := ExtractValue(KeyTracePresent, rl, sl, rec)
+	require.Equal(t, Found, outcome)
+	require.Equal(t, "false", got)
+
+	// Nil scope/resource are safe.
+	got, outcome = ExtractValue(KeyTracePresent, nil, nil, &logspb.LogRecord{})
+	require.Equal(t, Found, outcome)
+	require.Equal(t, "false", got)
+}
@@ -0,0 +1,49 @@
+// Package prom serves the processor's own metrics and its per-value counts in
+// the Prometheus exposition format.
+package prom
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Exporter gathers a Prometheus registry fed by an OpenTelemetry metric reader,
+// for the self-metrics, and by a ValueCounter, for the aggregated counts.
+type Exporter struct {
+	reg    *prometheus.Registry
+	reader sdkmetric.Reader
+	values *ValueCounter
+}
+
+// New returns an exporter exposing at most maxValues value series.
+func New(maxValues int) (*Exporter, error) {
+	reg := prometheus.NewRegistry()
+
+	reader, err := otelprom.New(otelprom.WithRegisterer(reg))
+	if err != nil {
+		return nil, err
+	}
+
+	values := NewValueCounter(maxValues)
+	if err := reg.Register(values); err != nil {
+		return nil, err
+	}
+
+	return &Exporter{reg: reg, reader: reader, values: values}, nil
+}
+
+// Reader must be installed on the meter provider for the self-metrics to be
+// exposed.
+func (e *Exporter) Reader() sdkmetric.Reader { return e.reader }
+
+// Values returns the counter to register as an aggregator window observer.
+func (e *Exporter) Values() *ValueCounter { return e.values }
+
+// Handler serves the registry for scraping.
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.reg, promhttp.HandlerOpts{})
+}
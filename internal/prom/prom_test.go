@@ -0,0 +1,104 @@
+package prom
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestValueCounter_Accumulates(t *testing.T) {
+	c := NewValueCounter(10)
+
+	c.Observe(sink.Snapshot{AttributeKey: "foo", Counts: map[string]uint64{"a": 2}, Missing: 1, Labels: sink.DefaultBucketLabels()})
+	c.Observe(sink.Snapshot{AttributeKey: "foo", Counts: map[string]uint64{"a": 3, "b": 1}})
+	c.Observe(sink.Snapshot{AttributeKey: "foo"})
+
+	require.InDelta(t, 5, recorded(t, c, "foo", "a"), 0)
+	require.InDelta(t, 1, recorded(t, c, "foo", "__missing__"), 0)
+	require.Equal(t, 3+2, testutil.CollectAndCount(c))
+}
+
+func TestValueCounter_Overflow(t *testing.T) {
+	e, err := New(2)
+	require.NoError(t, err)
+
+	c := e.Values()
+
+	c.Observe(sink.Snapshot{AttributeKey: "foo", Counts: map[string]uint64{"a": 1, "b": 1}})
+	c.Observe(sink.Snapshot{AttributeKey: "foo", Counts: map[string]uint64{"a": 1, "c": 4, "d": 5}})
+	// Key changes count towards the same limit.
+	c.Observe(sink.Snapshot{AttributeKey: "bar", Counts: map[string]uint64{"a": 1}})
+
+	require.InDelta(t, 2, recorded(t, c, "foo", "a"), 0)
+	require.InDelta(t, 9, recorded(t, c, "foo", OverflowValue), 0)
+	require.InDelta(t, 1, recorded(t, c, "bar", OverflowValue), 0)
+
+	out := scrape(t, e)
+	require.Contains(t, out, "otlp_log_processor_value_series 2")
+	require.Contains(t, out, "otlp_log_processor_value_series_limit 2")
+}
+
+func TestExporter_ServesSelfMetrics(t *testing.T) {
+	e, err := New(0)
+	require.NoError(t, err)
+
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(e.Reader()))
+	defer func() { require.NoError(t, mp.Shutdown(context.Background())) }()
+
+	counter, err := mp.Meter("test").Int64Counter("com.dash0.homeexercise.logs.received")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	e.Values().Observe(sink.Snapshot{AttributeKey: "foo", Counts: map[string]uint64{"alpha": 7}})
+
+	out := scrape(t, e)
+	require.Contains(t, out, "com_dash0_homeexercise_logs_received_total")
+	require.Contains(t, out, `otlp_log_processor_records_total{attribute_key="foo",value="alpha"} 7`)
+	require.Contains(t, out, "otlp_log_processor_value_series_limit 1000")
+}
+
+// recorded returns the records counter of key and value, or -1 if there is none.
+func recorded(t *testing.T, c *ValueCounter, key, value string) float64 {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric, 64)
+	c.Collect(ch)
+	close(ch)
+
+	for m := range ch {
+		var pb dto.Metric
+		require.NoError(t, m.Write(&pb))
+
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		if pb.GetCounter() != nil && labels["attribute_key"] == key && labels["value"] == value {
+			return pb.GetCounter().GetValue()
+		}
+	}
+
+	return -1
+}
+
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
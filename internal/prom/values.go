@@ -0,0 +1,108 @@
+package prom
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// OverflowValue labels the records of values that arrived after the series
+// limit was reached.
+const OverflowValue = "__overflow__"
+
+// DefaultMaxValues is the series limit used when none is configured.
+const DefaultMaxValues = 1000
+
+type series struct {
+	key   string
+	value string
+}
+
+// ValueCounter accumulates closed delta windows into one Prometheus counter
+// per attribute key and value. At most max series are created; records of
+// further values are counted under OverflowValue, so the sum over all values
+// stays equal to the processed total.
+type ValueCounter struct {
+	max int
+
+	mu      sync.Mutex
+	counts  map[series]uint64
+	exposed int
+
+	recordsDesc *prometheus.Desc
+	seriesDesc  *prometheus.Desc
+	limitDesc   *prometheus.Desc
+}
+
+// NewValueCounter returns a counter creating at most max series; values
+// below 1 mean DefaultMaxValues.
+func NewValueCounter(max int) *ValueCounter {
+	if max < 1 {
+		max = DefaultMaxValues
+	}
+
+	return &ValueCounter{
+		max:    max,
+		counts: make(map[series]uint64),
+		recordsDesc: prometheus.NewDesc("otlp_log_processor_records_total",
+			"Log records aggregated per attribute value, including the reserved buckets.",
+			[]string{"attribute_key", "value"}, nil),
+		seriesDesc: prometheus.NewDesc("otlp_log_processor_value_series",
+			"Attribute value series currently exposed, excluding overflow series.", nil, nil),
+		limitDesc: prometheus.NewDesc("otlp_log_processor_value_series_limit",
+			"Maximum number of attribute value series before values are counted as "+OverflowValue+".", nil, nil),
+	}
+}
+
+// Observe adds the counts of a closed delta window; it is meant to be
+// registered as an aggregator window observer.
+func (c *ValueCounter) Observe(snap sink.Snapshot) {
+	counts := snap.LabeledCounts()
+	if len(counts) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for v, n := range counts {
+		s := series{key: snap.AttributeKey, value: v}
+		if _, ok := c.counts[s]; !ok {
+			if c.exposed >= c.max {
+				s.value = OverflowValue
+			} else {
+				c.exposed++
+			}
+		}
+
+		c.counts[s] += n
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ValueCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.recordsDesc
+	ch <- c.seriesDesc
+	ch <- c.limitDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ValueCounter) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	counts := make(map[series]uint64, len(c.counts))
+	for s, n := range c.counts {
+		counts[s] = n
+	}
+
+	exposed := c.exposed
+	c.mu.Unlock()
+
+	for s, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.recordsDesc, prometheus.CounterValue, float64(n), s.key, s.value)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.seriesDesc, prometheus.GaugeValue, float64(exposed))
+	ch <- prometheus.MustNewConstMetric(c.limitDesc, prometheus.GaugeValue, float64(c.max))
+}
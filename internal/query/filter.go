@@ -0,0 +1,54 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Filter narrows a snapshot's counts to values with Prefix and then to the
+// TopN largest. Reserved buckets and totals are left untouched.
+type Filter struct {
+	Prefix string
+	TopN   int
+}
+
+// Apply returns s with filtered counts; s itself is not modified.
+func (f Filter) Apply(s sink.Snapshot) sink.Snapshot {
+	if f.Prefix == "" && (f.TopN <= 0 || f.TopN >= len(s.Counts)) {
+		return s
+	}
+
+	type kv struct {
+		value string
+		count uint64
+	}
+
+	kept := make([]kv, 0, len(s.Counts))
+	for v, n := range s.Counts {
+		if strings.HasPrefix(v, f.Prefix) {
+			kept = append(kept, kv{v, n})
+		}
+	}
+
+	if f.TopN > 0 && f.TopN < len(kept) {
+		sort.Slice(kept, func(i, j int) bool {
+			if kept[i].count != kept[j].count {
+				return kept[i].count > kept[j].count
+			}
+
+			return kept[i].value < kept[j].value
+		})
+		kept = kept[:f.TopN]
+	}
+
+	counts := make(map[string]uint64, len(kept))
+	for _, e := range kept {
+		counts[e.value] = e.count
+	}
+
+	s.Counts = counts
+
+	return s
+}
@@ -0,0 +1,30 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestFilter_Apply(t *testing.T) {
+	s := sink.Snapshot{
+		Counts:  map[string]uint64{"svc-a": 5, "svc-b": 9, "svc-c": 5, "db": 20},
+		Missing: 7,
+		Total:   46,
+	}
+
+	require.Equal(t, s.Counts, Filter{}.Apply(s).Counts)
+	require.Equal(t, map[string]uint64{"svc-a": 5, "svc-b": 9, "svc-c": 5}, Filter{Prefix: "svc-"}.Apply(s).Counts)
+	require.Equal(t, map[string]uint64{"db": 20, "svc-b": 9}, Filter{TopN: 2}.Apply(s).Counts)
+
+	// Ties break by value so results are stable.
+	got := Filter{Prefix: "svc-", TopN: 2}.Apply(s)
+	require.Equal(t, map[string]uint64{"svc-b": 9, "svc-a": 5}, got.Counts)
+	require.EqualValues(t, 7, got.Missing)
+	require.EqualValues(t, 46, got.Total)
+
+	// The input is untouched.
+	require.Len(t, s.Counts, 4)
+}
@@ -0,0 +1,54 @@
+// Package query serves the open window and recently closed snapshots over gRPC
+// and JSON/HTTP.
+package query
+
+import (
+	"sync"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Ring keeps the last closed snapshots in memory. It is safe for concurrent use.
+type Ring struct {
+	mu    sync.Mutex
+	buf   []sink.Snapshot
+	next  int
+	count int
+}
+
+// NewRing returns a ring holding up to size snapshots.
+func NewRing(size int) *Ring { return &Ring{buf: make([]sink.Snapshot, max(size, 1))} }
+
+// Add stores a closed window, evicting the oldest when full. Empty windows are
+// skipped so idle periods do not push out useful history.
+func (r *Ring) Add(s sink.Snapshot) {
+	if s.Total == 0 && s.Dropped == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	r.count = min(r.count+1, len(r.buf))
+}
+
+// Recent returns up to limit snapshots, most recent first; limit <= 0 returns all.
+// The snapshots share their counts with the ring and must not be modified.
+func (r *Ring) Recent(limit int) []sink.Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.count
+	if limit > 0 {
+		n = min(n, limit)
+	}
+
+	out := make([]sink.Snapshot, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.buf[(r.next-i+len(r.buf))%len(r.buf)])
+	}
+
+	return out
+}
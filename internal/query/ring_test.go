@@ -0,0 +1,33 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func TestRing_KeepsMostRecent(t *testing.T) {
+	r := NewRing(3)
+	require.Empty(t, r.Recent(0))
+
+	for i := int64(1); i <= 5; i++ {
+		r.Add(sink.Snapshot{WindowStart: i, Total: 1})
+	}
+
+	r.Add(sink.Snapshot{WindowStart: 6}) // empty windows are skipped
+
+	starts := func(snaps []sink.Snapshot) []int64 {
+		out := make([]int64, 0, len(snaps))
+		for _, s := range snaps {
+			out = append(out, s.WindowStart)
+		}
+
+		return out
+	}
+
+	require.Equal(t, []int64{5, 4, 3}, starts(r.Recent(0)))
+	require.Equal(t, []int64{5, 4}, starts(r.Recent(2)))
+	require.Equal(t, []int64{5, 4, 3}, starts(r.Recent(10)))
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Source provides the data served by the query API.
+type Source interface {
+	CurrentWindow(ctx context.Context) (sink.Snapshot, error)
+	Recent(limit int) []sink.Snapshot
+}
+
+// Server implements the QueryService over gRPC and JSON/HTTP.
+type Server struct {
+	processorv1.UnimplementedQueryServiceServer
+
+	src Source
+}
+
+// NewServer returns a query server reading from src.
+func NewServer(src Source) *Server { return &Server{src: src} }
+
+func filterFrom(f *processorv1.Filter) Filter {
+	return Filter{Prefix: f.GetPrefix(), TopN: int(f.GetTopN())}
+}
+
+// GetCurrentWindow returns the open window.
+func (s *Server) GetCurrentWindow(ctx context.Context, req *processorv1.GetCurrentWindowRequest) (*processorv1.GetCurrentWindowResponse, error) {
+	snap, err := s.src.CurrentWindow(ctx)
+	switch {
+	case errors.Is(err, aggregator.ErrStopped):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.FromContextError(err).Err()
+	}
+
+	return &processorv1.GetCurrentWindowResponse{Window: filterFrom(req.GetFilter()).Apply(snap).Proto()}, nil
+}
+
+// ListSnapshots returns recently closed windows, most recent first.
+func (s *Server) ListSnapshots(_ context.Context, req *processorv1.ListSnapshotsRequest) (*processorv1.ListSnapshotsResponse, error) {
+	f := filterFrom(req.GetFilter())
+	recent := s.src.Recent(int(req.GetLimit()))
+
+	resp := &processorv1.ListSnapshotsResponse{Snapshots: make([]*processorv1.Snapshot, 0, len(recent))}
+	for _, snap := range recent {
+		resp.Snapshots = append(resp.Snapshots, f.Apply(snap).Proto())
+	}
+
+	return resp, nil
+}
+
+var jsonOpts = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// Handler serves the same queries as JSON:
+//
+//	GET /v1/query/window?prefix=&top_n=
+//	GET /v1/query/snapshots?limit=&prefix=&top_n=
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/query/window", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.GetCurrentWindow(r.Context(), &processorv1.GetCurrentWindowRequest{Filter: f})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("GET /v1/query/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := parseUint(r, "limit")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.ListSnapshots(r.Context(), &processorv1.ListSnapshotsRequest{Limit: limit, Filter: f})
+		writeJSON(w, resp, err)
+	})
+
+	return mux
+}
+
+func parseFilter(r *http.Request) (*processorv1.Filter, error) {
+	top, err := parseUint(r, "top_n")
+	if err != nil {
+		return nil, err
+	}
+
+	return &processorv1.Filter{Prefix: r.URL.Query().Get("prefix"), TopN: top}, nil
+}
+
+func parseUint(r *http.Request, name string) (uint32, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid " + name + ": " + v)
+	}
+
+	return uint32(n), nil
+}
+
+func writeJSON(w http.ResponseWriter, msg proto.Message, err error) {
+	if err != nil {
+		code := http.StatusInternalServerError
+		if status.Code(err) == codes.Unavailable {
+			code = http.StatusServiceUnavailable
+		}
+
+		http.Error(w, status.Convert(err).Message(), code)
+
+		return
+	}
+
+	body, err := jsonOpts.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"dash0.com/otlp-log-processor-backend/internal/aggregator"
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+type fakeSource struct {
+	open sink.Snapshot
+	err  error
+	ring *Ring
+}
+
+func (f *fakeSource) CurrentWindow(context.Context) (sink.Snapshot, error) { return f.open, f.err }
+
+func (f *fakeSource) Recent(limit int) []sink.Snapshot { return f.ring.Recent(limit) }
+
+func newSource() *fakeSource {
+	ring := NewRing(4)
+	ring.Add(sink.Snapshot{WindowStart: 0, WindowEnd: 10, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1})
+	ring.Add(sink.Snapshot{WindowStart: 10, WindowEnd: 20, AttributeKey: "foo", Counts: map[string]uint64{"a": 2, "b": 3}, Total: 5})
+
+	return &fakeSource{
+		open: sink.Snapshot{WindowStart: 20, WindowEnd: 25, AttributeKey: "foo", Counts: map[string]uint64{"api-1": 4, "api-2": 7, "web": 9}, Total: 20},
+		ring: ring,
+	}
+}
+
+func dial(t *testing.T, srv *Server) processorv1.QueryServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	processorv1.RegisterQueryServiceServer(gs, srv)
+
+	go func() { _ = gs.Serve(lis) }()
+
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return processorv1.NewQueryServiceClient(conn)
+}
+
+func TestServer_GRPC(t *testing.T) {
+	client := dial(t, NewServer(newSource()))
+	ctx := context.Background()
+
+	cur, err := client.GetCurrentWindow(ctx, &processorv1.GetCurrentWindowRequest{Filter: &processorv1.Filter{Prefix: "api-", TopN: 1}})
+	require.NoError(t, err)
+	require.EqualValues(t, 20, cur.GetWindow().GetWindowStart())
+	require.EqualValues(t, 20, cur.GetWindow().GetTotal())
+	require.Len(t, cur.GetWindow().GetCounts(), 1)
+	require.Equal(t, "api-2", cur.GetWindow().GetCounts()[0].GetValue())
+
+	list, err := client.ListSnapshots(ctx, &processorv1.ListSnapshotsRequest{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, list.GetSnapshots(), 1)
+	require.EqualValues(t, 10, list.GetSnapshots()[0].GetWindowStart())
+	require.Equal(t, "b", list.GetSnapshots()[0].GetCounts()[0].GetValue())
+}
+
+func TestServer_StoppedAggregatorIsUnavailable(t *testing.T) {
+	src := newSource()
+	src.err = aggregator.ErrStopped
+
+	_, err := dial(t, NewServer(src)).GetCurrentWindow(context.Background(), &processorv1.GetCurrentWindowRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	rec := httptest.NewRecorder()
+	NewServer(src).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/query/window", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestServer_HTTP(t *testing.T) {
+	ts := httptest.NewServer(NewServer(newSource()).Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, map[string]any) {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		var out map[string]any
+		if resp.StatusCode == http.StatusOK {
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			require.NoError(t, json.Unmarshal(body, &out))
+		}
+
+		return resp.StatusCode, out
+	}
+
+	code, body := get("/v1/query/window?top_n=2")
+	require.Equal(t, http.StatusOK, code)
+
+	window := body["window"].(map[string]any)
+	require.Equal(t, "foo", window["attribute_key"])
+	require.Equal(t, []any{
+		map[string]any{"value": "web", "count": "9"},
+		map[string]any{"value": "api-2", "count": "7"},
+	}, window["counts"])
+
+	code, body = get("/v1/query/snapshots?limit=5&prefix=a")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["snapshots"], 2)
+
+	code, _ = get("/v1/query/snapshots?limit=-1")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/v1/query/window?top_n=x")
+	require.Equal(t, http.StatusBadRequest, code)
+}
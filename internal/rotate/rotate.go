@@ -0,0 +1,361 @@
+// Package rotate provides a file writer that rotates by size and age, prunes
+// and compresses rotated files, and can be reopened after an external
+// rotation.
+//
+// A file path/snapshots.jsonl is rotated to path/snapshots-<UTC time>.jsonl,
+// gzipped to path/snapshots-<UTC time>.jsonl.gz with Compress. Rotated files
+// are pruned by count and age in the background after each rotation.
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/wal"
+)
+
+// stampLayout is the rotation time embedded in rotated file names; it sorts
+// lexically in time order.
+const stampLayout = "20060102T150405.000Z"
+
+// Options configure a Writer. Zero limits are disabled.
+type Options struct {
+	Path string
+	// MaxSize rotates before a write that would grow the file beyond it, in bytes.
+	MaxSize int64
+	// Interval rotates a file once it has been written to for this long.
+	Interval time.Duration
+	// MaxBackups and MaxAge bound the rotated files that are kept.
+	MaxBackups int
+	MaxAge     time.Duration
+	// Compress gzips rotated files.
+	Compress bool
+	// Fsync decides when writes are synced; "" means wal.FsyncNever.
+	Fsync         wal.FsyncPolicy
+	FsyncInterval time.Duration
+}
+
+// Writer is an io.WriteCloser appending to Options.Path. Each Write goes to a
+// single file, so writers that emit one record per call never see a record
+// split across files.
+type Writer struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	opened   time.Time
+	lastSync time.Time
+
+	// mill compresses and prunes rotated files, one pass at a time.
+	millMu sync.Mutex
+	millWG sync.WaitGroup
+}
+
+// Open opens or creates opts.Path for appending.
+func Open(opts Options) (*Writer, error) {
+	if opts.Path == "" {
+		return nil, errors.New("rotate: empty path")
+	}
+
+	if opts.Fsync == "" {
+		opts.Fsync = wal.FsyncNever
+	}
+
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = time.Second
+	}
+
+	w := &Writer{opts: opts, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.opts.Path), 0o755); err != nil {
+		return fmt.Errorf("create output dir: %w", err)
+	}
+
+	f, err := os.OpenFile(w.opts.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	w.f, w.size = f, info.Size()
+	w.opened, w.lastSync = w.now(), w.now()
+
+	return nil
+}
+
+// Write appends p, rotating first if p would exceed MaxSize or the file is
+// older than Interval. A single write larger than MaxSize still goes to one
+// file.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if w.due(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+
+	if err != nil {
+		return n, err
+	}
+
+	switch w.opts.Fsync {
+	case wal.FsyncAlways:
+		return n, w.sync()
+	case wal.FsyncInterval:
+		if w.now().Sub(w.lastSync) >= w.opts.FsyncInterval {
+			return n, w.sync()
+		}
+	case wal.FsyncNever:
+	}
+
+	return n, nil
+}
+
+func (w *Writer) due(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+
+	return (w.opts.MaxSize > 0 && w.size+n > w.opts.MaxSize) ||
+		(w.opts.Interval > 0 && w.now().Sub(w.opened) >= w.opts.Interval)
+}
+
+func (w *Writer) sync() error {
+	w.lastSync = w.now()
+	return w.f.Sync()
+}
+
+// Rotate closes the current file, renames it with the rotation time and
+// opens a new one.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	rotated := w.rotatedName(w.now())
+
+	// The open handle follows the rename, so the old file stays writable
+	// until the new one is open.
+	renamed := true
+	if err := os.Rename(w.opts.Path, rotated); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotate output: %w", err)
+		}
+
+		renamed = false
+	}
+
+	old := w.f
+
+	if err := w.open(); err != nil {
+		// Keep appending to the old file, under its own name again, and try
+		// once more on the next due write.
+		if renamed {
+			err = errors.Join(err, os.Rename(rotated, w.opts.Path))
+		}
+
+		return err
+	}
+
+	err := w.closeFile(old)
+
+	w.millWG.Add(1)
+
+	go func() {
+		defer w.millWG.Done()
+		w.mill()
+	}()
+
+	return err
+}
+
+// rotatedName returns a free name for a file rotated at t, moving t forward
+// by a millisecond while a name is taken.
+func (w *Writer) rotatedName(t time.Time) string {
+	ext := filepath.Ext(w.opts.Path)
+	base := strings.TrimSuffix(w.opts.Path, ext) + "-"
+
+	for {
+		name := base + t.UTC().Format(stampLayout) + ext
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(name + ".gz"); errors.Is(err, os.ErrNotExist) {
+				return name
+			}
+		}
+
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// Reopen reopens Path without renaming it, for use after an external tool
+// such as logrotate moved the file away. If Path cannot be opened, writes keep
+// going to the old file.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	old := w.f
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	return w.closeFile(old)
+}
+
+// closeFile syncs f, unless the policy never syncs, and closes it.
+func (w *Writer) closeFile(f *os.File) error {
+	var err error
+	if w.opts.Fsync != wal.FsyncNever {
+		err = f.Sync()
+	}
+
+	return errors.Join(err, f.Close())
+}
+
+// Close closes the file and waits for background compression and pruning.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+
+	var err error
+	if w.f != nil {
+		err = w.closeFile(w.f)
+		w.f = nil
+	}
+
+	w.mu.Unlock()
+
+	w.millWG.Wait()
+
+	return err
+}
+
+// backup is a rotated file.
+type backup struct {
+	path string
+	at   time.Time
+}
+
+// backups lists the rotated files of Path, newest first.
+func (w *Writer) backups() ([]backup, error) {
+	dir := filepath.Dir(w.opts.Path)
+	ext := filepath.Ext(w.opts.Path)
+	prefix := strings.TrimSuffix(filepath.Base(w.opts.Path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []backup
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		if at, err := time.Parse(stampLayout, stamp); err == nil {
+			out = append(out, backup{path: filepath.Join(dir, name), at: at})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].at.After(out[j].at) })
+
+	return out, nil
+}
+
+// mill compresses uncompressed rotated files and removes those beyond
+// MaxBackups or older than MaxAge. Errors only cost disk space, so they are
+// not reported.
+func (w *Writer) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	backups, err := w.backups()
+	if err != nil {
+		return
+	}
+
+	cutoff := w.now().Add(-w.opts.MaxAge)
+
+	for i, b := range backups {
+		if (w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups) || (w.opts.MaxAge > 0 && b.at.Before(cutoff)) {
+			_ = os.Remove(b.path)
+			continue
+		}
+
+		if w.opts.Compress && !strings.HasSuffix(b.path, ".gz") {
+			_ = compress(b.path)
+		}
+	}
+}
+
+// compress replaces path with path.gz.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), dst.Sync(), dst.Close())
+
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,179 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/wal"
+)
+
+// clock is a manually advanced time source.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func open(t *testing.T, opts Options) (*Writer, *clock) {
+	t.Helper()
+
+	c := &clock{t: time.Date(2024, 3, 9, 16, 0, 0, 0, time.UTC)}
+
+	w, err := Open(opts)
+	require.NoError(t, err)
+
+	w.now = c.now
+	w.opened, w.lastSync = c.t, c.t
+
+	return w, c
+}
+
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func TestWriter_RotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := open(t, Options{Path: filepath.Join(dir, "out.jsonl"), MaxSize: 10})
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddddddddddddd\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+
+	// Records are never split; an oversized one gets a file of its own.
+	got := files(t, dir)
+	require.Len(t, got, 3)
+	require.Equal(t, "out.jsonl", got[2])
+	require.Equal(t, "aaaa\nbbbb\n", read(t, filepath.Join(dir, got[0])))
+	require.Equal(t, "cccc\n", read(t, filepath.Join(dir, got[1])))
+	require.Equal(t, "dddddddddddddd\n", read(t, filepath.Join(dir, "out.jsonl")))
+}
+
+func TestWriter_RotatesByTimeAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	w, c := open(t, Options{Path: filepath.Join(dir, "out.jsonl"), Interval: time.Hour, Compress: true, Fsync: wal.FsyncAlways})
+
+	_, err := w.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	c.t = c.t.Add(time.Hour)
+	_, err = w.Write([]byte("second\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []string{"out-20240309T170000.000Z.jsonl.gz", "out.jsonl"}, files(t, dir))
+
+	f, err := os.Open(filepath.Join(dir, "out-20240309T170000.000Z.jsonl.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(b))
+	require.Equal(t, "second\n", read(t, filepath.Join(dir, "out.jsonl")))
+}
+
+func TestWriter_PrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	w, c := open(t, Options{Path: filepath.Join(dir, "out.jsonl"), MaxBackups: 2, MaxAge: 3 * time.Hour})
+
+	for range 4 {
+		_, err := w.Write([]byte("x\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.Rotate())
+		w.millWG.Wait()
+
+		c.t = c.t.Add(time.Hour)
+	}
+
+	require.Equal(t, []string{"out-20240309T180000.000Z.jsonl", "out-20240309T190000.000Z.jsonl", "out.jsonl"}, files(t, dir))
+
+	// Age applies as well: at 23:00 the 19:00 file is older than 3h.
+	c.t = c.t.Add(3 * time.Hour)
+	_, err := w.Write([]byte("x\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []string{"out-20240309T230000.000Z.jsonl", "out.jsonl"}, files(t, dir))
+}
+
+func TestWriter_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.jsonl")
+	w, _ := open(t, Options{Path: path})
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// An external tool moves the file away, then asks for a reopen.
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, w.Reopen())
+
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, "before\n", read(t, path+".1"))
+	require.Equal(t, "after\n", read(t, path))
+
+	_, err = w.Write([]byte("closed\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestWriter_ReopenFailureKeepsWriting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.jsonl")
+	w, _ := open(t, Options{Path: path})
+
+	// The file is moved away and its name taken by a directory, so the reopen
+	// fails; writes keep going to the moved file.
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.Mkdir(path, 0o755))
+	require.Error(t, w.Reopen())
+
+	_, err := w.Write([]byte("kept\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, w.Reopen())
+
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, "kept\n", read(t, path+".1"))
+	require.Equal(t, "after\n", read(t, path))
+}
@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+)
+
+// DeadLetter appends snapshots that could not be delivered to a JSONL file,
+// one DeadLetterEntry per line with the snapshot as a processor.v1.Snapshot in
+// the protobuf JSON mapping. Each write is synced, since dead letters are rare
+// and would otherwise be lost for good.
+type DeadLetter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// DeadLetterEntry is one line of a dead-letter file: the snapshot and the
+// delivery target it failed on, empty for the primary output.
+type DeadLetterEntry struct {
+	Target   string
+	Snapshot Snapshot
+}
+
+// OpenDeadLetter opens (or creates) the dead-letter file at path for appending.
+func OpenDeadLetter(path string) (*DeadLetter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open dead-letter file: %w", err)
+	}
+
+	return &DeadLetter{f: f}, nil
+}
+
+// Publish appends the snapshot as failed on the primary output.
+func (d *DeadLetter) Publish(ctx context.Context, snap Snapshot) error {
+	return d.PublishTarget(ctx, "", snap)
+}
+
+// PublishTarget appends the snapshot with the target it failed on and syncs
+// the file.
+func (d *DeadLetter) PublishTarget(_ context.Context, target string, snap Snapshot) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(snap.Proto())
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(struct {
+		Target   string          `json:"target,omitempty"`
+		Snapshot json.RawMessage `json:"snapshot"`
+	}{Target: target, Snapshot: s})
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return d.f.Sync()
+}
+
+// Close closes the underlying file.
+func (d *DeadLetter) Close() error { return d.f.Close() }
+
+// ReadDeadLetter decodes the entries in r and calls fn for each one in order,
+// stopping at the first error. Snapshots in the JSONSink shape, as written by
+// earlier releases, are read too; bare ones, written before entries recorded
+// their target, as failed on the primary output.
+func ReadDeadLetter(r io.Reader, fn func(DeadLetterEntry) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return fmt.Errorf("dead-letter entry %d: %w", n, err)
+		}
+
+		e, err := decodeDeadLetter(raw)
+		if err != nil {
+			return fmt.Errorf("dead-letter entry %d: %w", n, err)
+		}
+
+		if err := fn(e); err != nil {
+			return fmt.Errorf("dead-letter entry %d: %w", n, err)
+		}
+	}
+}
+
+func decodeDeadLetter(raw json.RawMessage) (DeadLetterEntry, error) {
+	var v struct {
+		Target   string          `json:"target"`
+		Snapshot json.RawMessage `json:"snapshot"`
+	}
+
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return DeadLetterEntry{}, err
+	}
+
+	if v.Snapshot == nil {
+		v.Snapshot = raw
+	}
+
+	e := DeadLetterEntry{Target: v.Target}
+
+	var msg processorv1.Snapshot
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(v.Snapshot, &msg); err == nil {
+		e.Snapshot = FromProto(&msg)
+		return e, nil
+	}
+
+	// The JSONSink shape differs in counts, a map rather than a list.
+	return e, json.Unmarshal(v.Snapshot, &e.Snapshot)
+}
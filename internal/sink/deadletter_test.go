@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetter_AppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+
+	d, err := OpenDeadLetter(path)
+	require.NoError(t, err)
+
+	first := Snapshot{WindowStart: 1000, WindowEnd: 2000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}
+	second := Snapshot{WindowStart: 2000, WindowEnd: 3000, AttributeKey: "foo", Counts: map[string]uint64{"b": 2}, Missing: 1, Total: 3}
+
+	require.NoError(t, d.Publish(context.Background(), first))
+	require.NoError(t, d.PublishTarget(context.Background(), "sink/webhook", second))
+	require.NoError(t, d.Close())
+
+	// Reopening appends rather than truncating.
+	d, err = OpenDeadLetter(path)
+	require.NoError(t, err)
+	require.NoError(t, d.Publish(context.Background(), first))
+	require.NoError(t, d.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var got []DeadLetterEntry
+
+	require.NoError(t, ReadDeadLetter(f, func(e DeadLetterEntry) error { got = append(got, e); return nil }))
+	require.Len(t, got, 3)
+	require.Empty(t, got[0].Target)
+	require.Equal(t, first.WindowStart, got[0].Snapshot.WindowStart)
+	require.Equal(t, "sink/webhook", got[1].Target)
+	require.Equal(t, second.WindowEnd, got[1].Snapshot.WindowEnd)
+	require.Equal(t, second.Counts, got[1].Snapshot.Counts)
+	require.EqualValues(t, 1, got[1].Snapshot.Missing)
+
+	// Entries hold the schema's message in the protobuf JSON mapping.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"target":"sink/webhook"`)
+	require.Regexp(t, `"counts":\[\{"value":\s*"b",\s*"count":\s*"2"\}\]`, string(data))
+	require.Regexp(t, `"schema_version":\s*1`, string(data))
+}
+
+func TestReadDeadLetter_JSONSinkShape(t *testing.T) {
+	var got []DeadLetterEntry
+
+	in := `{"window_start":1,"window_end":2,"counts":{"a":1}}` + "\n" +
+		`{"target":"rollup/1m0s","snapshot":{"schema_version":1,"window_start":2,"window_end":3,"counts":{"b":2}}}`
+
+	err := ReadDeadLetter(strings.NewReader(in), func(e DeadLetterEntry) error {
+		got = append(got, e)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Empty(t, got[0].Target)
+	require.EqualValues(t, 2, got[0].Snapshot.WindowEnd)
+	require.Equal(t, map[string]uint64{"a": 1}, got[0].Snapshot.Counts)
+	require.Equal(t, "rollup/1m0s", got[1].Target)
+	require.Equal(t, map[string]uint64{"b": 2}, got[1].Snapshot.Counts)
+}
+
+func TestReadDeadLetter_Errors(t *testing.T) {
+	err := ReadDeadLetter(strings.NewReader(`{"window_start":1}`+"\n"+`{not json`), func(DeadLetterEntry) error { return nil })
+	require.ErrorContains(t, err, "entry 2")
+
+	err = ReadDeadLetter(strings.NewReader(`{"window_start":1}`), func(DeadLetterEntry) error { return errors.New("sink down") })
+	require.ErrorContains(t, err, "sink down")
+}
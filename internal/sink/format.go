@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TimeFormat selects how window timestamps are rendered.
+type TimeFormat string
+
+const (
+	// TimeUnixMillis keeps timestamps as milliseconds since the epoch.
+	TimeUnixMillis  TimeFormat = "unix_ms"
+	TimeRFC3339     TimeFormat = "rfc3339"
+	TimeRFC3339Nano TimeFormat = "rfc3339nano"
+)
+
+// ParseTimeFormat parses unix_ms|rfc3339|rfc3339nano; "" is returned as is
+// and means the formatter's default.
+func ParseTimeFormat(s string) (TimeFormat, error) {
+	switch tf := TimeFormat(s); tf {
+	case "", TimeUnixMillis, TimeRFC3339, TimeRFC3339Nano:
+		return tf, nil
+	default:
+		return "", fmt.Errorf("invalid time format %q: want unix_ms|rfc3339|rfc3339nano", s)
+	}
+}
+
+// Render formats a millisecond timestamp in UTC.
+func (tf TimeFormat) Render(ms int64) string {
+	switch tf {
+	case TimeRFC3339:
+		return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+	case TimeRFC3339Nano:
+		return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatInt(ms, 10)
+	}
+}
+
+// FormatOptions are the encoding options shared by all formatters; each
+// formatter applies those that make sense for it.
+type FormatOptions struct {
+	// Pretty spreads a snapshot over several indented lines where supported.
+	Pretty bool
+	// TimeFormat renders the window timestamps; "" means the formatter's default.
+	TimeFormat TimeFormat
+}
+
+// Formatter encodes one snapshot, including its trailing newline.
+type Formatter interface {
+	Format(snap Snapshot) ([]byte, error)
+}
+
+// FormatterFactory builds a formatter for the given options.
+type FormatterFactory func(FormatOptions) Formatter
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]FormatterFactory{}
+)
+
+// RegisterFormatter makes a formatter available under name, e.g. to
+// -outputFormat. Registering a name twice replaces the earlier factory.
+func RegisterFormatter(name string, f FormatterFactory) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	formatters[name] = f
+}
+
+// Formats returns the registered formatter names, sorted.
+func Formats() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// NewFormatter returns the formatter registered under name.
+func NewFormatter(name string, opts FormatOptions) (Formatter, error) {
+	formattersMu.RLock()
+	f, ok := formatters[name]
+	formattersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q: want one of %v", name, Formats())
+	}
+
+	return f(opts), nil
+}
+
+// WriterSink writes each snapshot, encoded by a Formatter, to an io.Writer.
+// Publishes are serialized so that concurrent publishers never interleave.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  Formatter
+}
+
+// NewWriterSink returns a sink writing snapshots formatted by f to w.
+func NewWriterSink(w io.Writer, f Formatter) *WriterSink { return &WriterSink{w: w, f: f} }
+
+// Publish formats snap and writes it in a single call.
+func (s *WriterSink) Publish(_ context.Context, snap Snapshot) error {
+	b, err := s.f.Format(snap)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(b)
+
+	return err
+}
@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func formatSnapshot() Snapshot {
+	return Snapshot{
+		WindowStart:  1710000000000,
+		WindowEnd:    1710000010000,
+		Temporality:  TemporalityDelta,
+		AttributeKey: "foo",
+		Counts:       map[string]uint64{"payment": 120, "beta": 3},
+		Missing:      7,
+		Labels:       DefaultBucketLabels(),
+		Total:        130,
+		Dropped:      2,
+	}
+}
+
+func TestNewFormatter_Registry(t *testing.T) {
+	require.Subset(t, Formats(), []string{"json", "log"})
+
+	_, err := NewFormatter("xml", FormatOptions{})
+	require.ErrorContains(t, err, `unknown output format "xml"`)
+
+	RegisterFormatter("test-upper", func(FormatOptions) Formatter { return upperFormatter{} })
+	defer func() {
+		formattersMu.Lock()
+		delete(formatters, "test-upper")
+		formattersMu.Unlock()
+	}()
+
+	f, err := NewFormatter("test-upper", FormatOptions{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewWriterSink(&buf, f).Publish(context.Background(), formatSnapshot()))
+	require.Equal(t, "FOO\n", buf.String())
+}
+
+type upperFormatter struct{}
+
+func (upperFormatter) Format(s Snapshot) ([]byte, error) {
+	return []byte(strings.ToUpper(s.AttributeKey) + "\n"), nil
+}
+
+func TestJSONFormatter_Options(t *testing.T) {
+	b, err := NewJSONFormatter(FormatOptions{TimeFormat: TimeRFC3339}).Format(formatSnapshot())
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(b), "\n"))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Equal(t, "2024-03-09T16:00:00Z", got["window_start"])
+	require.Equal(t, "2024-03-09T16:00:10Z", got["window_end"])
+	require.NotContains(t, got, "start_time")
+	require.EqualValues(t, 130, got["total"])
+	require.EqualValues(t, SchemaVersion, got["schema_version"])
+
+	b, err = NewJSONFormatter(FormatOptions{Pretty: true}).Format(formatSnapshot())
+	require.NoError(t, err)
+	require.Contains(t, string(b), "\n  \"window_start\": 1710000000000,\n")
+	require.True(t, strings.HasSuffix(string(b), "}\n"))
+}
+
+// TestJSONFormatter_Shape pins the JSON contract of schema version 1. Fields
+// may be added; renaming or removing one needs a new schema version.
+func TestJSONFormatter_Shape(t *testing.T) {
+	snap := formatSnapshot()
+	snap.Generation = 2
+	snap.Tenant = "eu-1"
+
+	b, err := NewJSONFormatter(FormatOptions{}).Format(snap)
+	require.NoError(t, err)
+	require.Equal(t, `{"schema_version":1,"window_start":1710000000000,"window_end":1710000010000,"temporality":"delta",`+
+		`"generation":2,"attribute_key":"foo","tenant":"eu-1","counts":{"beta":3,"payment":120},"missing":7,"null":0,"unsupported":0,`+
+		`"labels":{"missing":"__missing__","null":"__null__","unsupported":"__unsupported__"},"total":130,"dropped":2}`+"\n", string(b))
+
+	// Snapshots written before versioning still decode.
+	var old Snapshot
+	require.NoError(t, json.Unmarshal([]byte(`{"window_start":1,"window_end":2,"attribute_key":"foo","counts":{"a":1},"total":1}`), &old))
+	require.Equal(t, Snapshot{WindowStart: 1, WindowEnd: 2, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}, old)
+}
+
+func TestTextFormatter(t *testing.T) {
+	f, err := NewFormatter("log", FormatOptions{})
+	require.NoError(t, err)
+
+	b, err := f.Format(formatSnapshot())
+	require.NoError(t, err)
+	require.Equal(t,
+		"2024-03-09T16:00:00Z .. 2024-03-09T16:00:10Z  foo  total=130 dropped=2\n"+
+			"  __missing__    7\n"+
+			"  beta           3\n"+
+			"  payment      120\n",
+		string(b))
+
+	snap := formatSnapshot()
+	snap.Counts, snap.Missing = nil, 0
+	snap.Temporality = TemporalityCumulative
+	snap.StartTime = 1700000000000
+	snap.Tenant = "eu-1"
+
+	b, err = NewTextFormatter(FormatOptions{TimeFormat: TimeUnixMillis}).Format(snap)
+	require.NoError(t, err)
+	require.Equal(t, "1710000000000 .. 1710000010000  foo  total=130 dropped=2 cumulative_since=1700000000000 tenant=eu-1\n", string(b))
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	tf, err := ParseTimeFormat("rfc3339nano")
+	require.NoError(t, err)
+	require.Equal(t, TimeRFC3339Nano, tf)
+
+	_, err = ParseTimeFormat("iso")
+	require.Error(t, err)
+}
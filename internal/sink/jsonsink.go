@@ -1,26 +1,77 @@
 package sink
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"os"
 )
 
-// JSONSink writes snapshots as single-line JSON to an io.Writer.
-type JSONSink struct {
-	w io.Writer
+func init() {
+	RegisterFormatter("json", func(o FormatOptions) Formatter { return NewJSONFormatter(o) })
 }
 
+// JSONSink writes snapshots as single-line JSON to an io.Writer.
+type JSONSink = WriterSink
+
 // NewJSONSink creates a JSON sink writing to the provided writer.
-func NewJSONSink(w io.Writer) *JSONSink { return &JSONSink{w: w} }
+func NewJSONSink(w io.Writer) *JSONSink { return NewWriterSink(w, JSONFormatter{}) }
 
 // NewStdoutJSON returns a JSON sink that writes to os.Stdout.
-func NewStdoutJSON() *JSONSink { return &JSONSink{w: os.Stdout} }
+func NewStdoutJSON() *JSONSink { return NewJSONSink(os.Stdout) }
+
+// JSONFormatter encodes a snapshot as one JSON object per line, or indented
+// with FormatOptions.Pretty, led by its schema_version. Timestamps stay
+// milliseconds unless another TimeFormat is set, in which case they become
+// strings.
+type JSONFormatter struct {
+	opts FormatOptions
+}
+
+// NewJSONFormatter returns a JSON formatter with the given options.
+func NewJSONFormatter(opts FormatOptions) JSONFormatter { return JSONFormatter{opts: opts} }
+
+// versioned puts schema_version ahead of the snapshot's fields.
+type versioned struct {
+	SchemaVersion int `json:"schema_version"`
+	Snapshot
+}
+
+// Format implements Formatter.
+func (f JSONFormatter) Format(snap Snapshot) ([]byte, error) {
+	vs := versioned{SchemaVersion: SchemaVersion, Snapshot: snap}
+
+	var v any = vs
+
+	if tf := f.opts.TimeFormat; tf != "" && tf != TimeUnixMillis {
+		// The outer fields shadow the embedded millisecond ones.
+		ts := struct {
+			versioned
+			WindowStart string `json:"window_start"`
+			WindowEnd   string `json:"window_end"`
+			StartTime   string `json:"start_time,omitempty"`
+		}{versioned: vs, WindowStart: tf.Render(snap.WindowStart), WindowEnd: tf.Render(snap.WindowEnd)}
+
+		if snap.StartTime != 0 {
+			ts.StartTime = tf.Render(snap.StartTime)
+		}
+
+		v = ts
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+
+	if f.opts.Pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		return nil, err
+	}
 
-// Publish marshals the snapshot as JSON and writes it with a trailing newline.
-func (s *JSONSink) Publish(_ context.Context, snap Snapshot) error {
-	enc := json.NewEncoder(s.w)
-	// Keep compact output; callers can wrap the writer if they want pretty printing.
-	return enc.Encode(snap)
+	return append(b, '\n'), nil
 }
@@ -23,8 +23,12 @@ func TestJSONSink_Publish_EncodesSnapshot(t *testing.T) {
 			"baz":     2,
 			"unknown": 3,
 		},
-		Total:   6,
-		Dropped: 1,
+		Missing:     4,
+		Null:        1,
+		Unsupported: 2,
+		Labels:      DefaultBucketLabels(),
+		Total:       13,
+		Dropped:     1,
 	}
 
 	require.NoError(t, s.Publish(context.Background(), snap))
@@ -47,4 +51,33 @@ func TestJSONSink_Publish_EncodesSnapshot(t *testing.T) {
 	require.EqualValues(t, 1, got.Counts["bar"])
 	require.EqualValues(t, 2, got.Counts["baz"])
 	require.EqualValues(t, 3, got.Counts["unknown"])
+	require.EqualValues(t, 4, got.Missing)
+	require.EqualValues(t, 1, got.Null)
+	require.EqualValues(t, 2, got.Unsupported)
+	require.Equal(t, snap.Labels, got.Labels)
+}
+
+func TestSnapshot_LabeledCounts(t *testing.T) {
+	snap := Snapshot{
+		Counts:  map[string]uint64{"bar": 1, "unknown": 2, "__missing__": 4},
+		Missing: 3,
+		Null:    1,
+		Labels:  DefaultBucketLabels(),
+	}
+
+	// A genuine value spelled like a label is escaped rather than merged.
+	require.Equal(t, map[string]uint64{"bar": 1, "unknown": 2, "___missing__": 4, "__missing__": 3, "__null__": 1}, snap.LabeledCounts())
+	// The snapshot's own counts are left untouched.
+	require.EqualValues(t, 4, snap.Counts["__missing__"])
+}
+
+func TestBucketLabels_Validate(t *testing.T) {
+	require.NoError(t, DefaultBucketLabels().Validate())
+	require.NoError(t, BucketLabels{Missing: "__none", Null: "__nil", Unsupported: "__?"}.Validate())
+
+	err := BucketLabels{Missing: "unknown", Null: "___null", Unsupported: "__none"}.Validate()
+	require.ErrorContains(t, err, `missing label "unknown"`)
+	require.ErrorContains(t, err, `null label "___null"`)
+
+	require.ErrorContains(t, BucketLabels{Missing: "__x", Null: "__x", Unsupported: "__y"}.Validate(), "already used by the missing bucket")
 }
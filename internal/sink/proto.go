@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+)
+
+func init() {
+	RegisterFormatter("protobuf", func(FormatOptions) Formatter { return DelimitedFormatter{} })
+}
+
+// Proto returns the snapshot as the generated processor.v1.Snapshot, ordering
+// counts by count descending, then by value, and stamping SchemaVersion.
+func (s Snapshot) Proto() *processorv1.Snapshot {
+	counts := make([]*processorv1.ValueCount, 0, len(s.Counts))
+	for v, n := range s.Counts {
+		counts = append(counts, &processorv1.ValueCount{Value: v, Count: n})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+
+		return counts[i].Value < counts[j].Value
+	})
+
+	return &processorv1.Snapshot{
+		WindowStart:  s.WindowStart,
+		WindowEnd:    s.WindowEnd,
+		Temporality:  string(s.Temporality),
+		Generation:   s.Generation,
+		StartTime:    s.StartTime,
+		AttributeKey: s.AttributeKey,
+		Tenant:       s.Tenant,
+		Counts:       counts,
+		Missing:      s.Missing,
+		Null:         s.Null,
+		Unsupported:  s.Unsupported,
+		Labels: &processorv1.BucketLabels{
+			Missing:     s.Labels.Missing,
+			Null:        s.Labels.Null,
+			Unsupported: s.Labels.Unsupported,
+		},
+		Total:         s.Total,
+		Dropped:       s.Dropped,
+		SchemaVersion: SchemaVersion,
+	}
+}
+
+// FromProto converts a generated snapshot back to the in-memory one.
+func FromProto(x *processorv1.Snapshot) Snapshot {
+	counts := make(map[string]uint64, len(x.GetCounts()))
+	for _, c := range x.GetCounts() {
+		counts[c.GetValue()] += c.GetCount()
+	}
+
+	return Snapshot{
+		WindowStart:  x.GetWindowStart(),
+		WindowEnd:    x.GetWindowEnd(),
+		Temporality:  Temporality(x.GetTemporality()),
+		Generation:   x.GetGeneration(),
+		StartTime:    x.GetStartTime(),
+		AttributeKey: x.GetAttributeKey(),
+		Tenant:       x.GetTenant(),
+		Counts:       counts,
+		Missing:      x.GetMissing(),
+		Null:         x.GetNull(),
+		Unsupported:  x.GetUnsupported(),
+		Labels: BucketLabels{
+			Missing:     x.GetLabels().GetMissing(),
+			Null:        x.GetLabels().GetNull(),
+			Unsupported: x.GetLabels().GetUnsupported(),
+		},
+		Total:   x.GetTotal(),
+		Dropped: x.GetDropped(),
+	}
+}
+
+// DelimitedFormatter encodes a snapshot as a processor.v1.Snapshot message
+// prefixed with its size as a varint, the framing of protodelim and of Java's
+// writeDelimitedTo; processorv1.DelimitedReader reads it back. The format
+// options have no effect.
+type DelimitedFormatter struct{}
+
+// Format implements Formatter.
+func (DelimitedFormatter) Format(snap Snapshot) ([]byte, error) {
+	msg := snap.Proto()
+
+	b := protowire.AppendVarint(nil, uint64(proto.Size(msg)))
+
+	return proto.MarshalOptions{Deterministic: true}.MarshalAppend(b, msg)
+}
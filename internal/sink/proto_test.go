@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+)
+
+func TestSnapshot_ProtoRoundTrip(t *testing.T) {
+	in := Snapshot{
+		WindowStart:  1000,
+		WindowEnd:    2000,
+		Temporality:  TemporalityCumulative,
+		Generation:   3,
+		StartTime:    500,
+		AttributeKey: "foo",
+		Tenant:       "eu-1",
+		Counts:       map[string]uint64{"b": 2, "a": 2, "c": 9},
+		Missing:      1,
+		Null:         2,
+		Unsupported:  3,
+		Labels:       DefaultBucketLabels(),
+		Total:        19,
+		Dropped:      4,
+	}
+
+	pb := in.Proto()
+
+	var order []string
+	for _, c := range pb.GetCounts() {
+		order = append(order, c.GetValue())
+	}
+
+	require.Equal(t, []string{"c", "a", "b"}, order)
+	require.Equal(t, in, FromProto(pb))
+	require.EqualValues(t, SchemaVersion, pb.GetSchemaVersion())
+}
+
+// TestSnapshot_JSONMatchesProto guards that the JSON outputs keep the field
+// names of the schema, so that both describe the same contract.
+func TestSnapshot_JSONMatchesProto(t *testing.T) {
+	snap := Snapshot{Temporality: TemporalityCumulative, Generation: 1, StartTime: 1, Tenant: "t", Labels: DefaultBucketLabels()}
+
+	b, err := JSONFormatter{}.Format(snap)
+	require.NoError(t, err)
+
+	var got map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(b, &got))
+
+	fields := (&processorv1.Snapshot{}).ProtoReflect().Descriptor().Fields()
+	require.Len(t, got, fields.Len())
+
+	for i := range fields.Len() {
+		require.Contains(t, got, string(fields.Get(i).Name()))
+	}
+
+	var labels map[string]string
+	require.NoError(t, json.Unmarshal(got["labels"], &labels))
+
+	labelFields := (&processorv1.BucketLabels{}).ProtoReflect().Descriptor().Fields()
+	require.Len(t, labels, labelFields.Len())
+
+	for i := range labelFields.Len() {
+		require.Contains(t, labels, string(labelFields.Get(i).Name()))
+	}
+}
+
+func TestDelimited(t *testing.T) {
+	f, err := NewFormatter("protobuf", FormatOptions{Pretty: true})
+	require.NoError(t, err)
+
+	first := Snapshot{WindowStart: 1000, WindowEnd: 2000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Labels: DefaultBucketLabels(), Total: 1}
+	second := first
+	second.WindowStart, second.WindowEnd = 2000, 3000
+
+	var buf bytes.Buffer
+
+	for _, snap := range []Snapshot{first, second} {
+		b, err := f.Format(snap)
+		require.NoError(t, err)
+
+		buf.Write(b)
+	}
+
+	data := buf.Bytes()
+	r := processorv1.NewDelimitedReader(bytes.NewReader(data))
+
+	for _, want := range []Snapshot{first, second} {
+		got, err := r.Next()
+		require.NoError(t, err)
+		require.EqualValues(t, SchemaVersion, got.GetSchemaVersion())
+		require.Equal(t, want, FromProto(got))
+	}
+
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+
+	// A cut-off write leaves the earlier snapshots readable.
+	r = processorv1.NewDelimitedReader(bytes.NewReader(data[:len(data)-1]))
+	_, err = r.Next()
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
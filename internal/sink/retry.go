@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how a failed publish is retried with exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first; values below 1 mean 1.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Timeout bounds each attempt via its context; zero means no per-attempt timeout.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second, Multiplier: 2, Timeout: 10 * time.Second}
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry).
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d = time.Duration(float64(d) * mult)
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return d
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that PublishWithRetry gives up on it immediately,
+// e.g. when the receiver rejected the data as malformed.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// PublishWithRetry publishes snap to s, retrying failures according to p, see
+// Retry.
+func PublishWithRetry(ctx context.Context, s Sink, snap Snapshot, p RetryPolicy, onRetry func(retry int, err error)) error {
+	return Retry(ctx, p, func(ctx context.Context) error { return s.Publish(ctx, snap) }, onRetry)
+}
+
+// Retry calls fn until it succeeds, retrying failures according to p; each
+// attempt gets a context bounded by p.Timeout. Errors marked with Permanent
+// are not retried. onRetry, if set, is called before each retry with the
+// retry number and the error that caused it. Returns the last error once
+// attempts are exhausted or ctx is done.
+func Retry(ctx context.Context, p RetryPolicy, fn func(ctx context.Context) error, onRetry func(retry int, err error)) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = attemptOnce(ctx, fn, p.Timeout); err == nil {
+			return nil
+		}
+
+		if attempt >= attempts || IsPermanent(err) {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+
+		t := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+func attemptOnce(ctx context.Context, fn func(ctx context.Context) error, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return fn(ctx)
+}
@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakySink struct {
+	failures int
+	calls    int
+}
+
+func (f *flakySink) Publish(context.Context, Snapshot) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("boom")
+	}
+
+	return nil
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+
+	require.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 800*time.Millisecond, p.Backoff(4))
+	require.Equal(t, time.Second, p.Backoff(5))
+	require.Equal(t, time.Second, p.Backoff(100))
+}
+
+func TestPublishWithRetry_SucceedsAfterFailures(t *testing.T) {
+	s := &flakySink{failures: 2}
+	p := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	var retries []int
+
+	err := PublishWithRetry(context.Background(), s, Snapshot{}, p, func(retry int, _ error) { retries = append(retries, retry) })
+	require.NoError(t, err)
+	require.Equal(t, 3, s.calls)
+	require.Equal(t, []int{1, 2}, retries)
+}
+
+func TestPublishWithRetry_GivesUp(t *testing.T) {
+	s := &flakySink{failures: 10}
+	p := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+	require.EqualError(t, PublishWithRetry(context.Background(), s, Snapshot{}, p, nil), "boom")
+	require.Equal(t, 2, s.calls)
+
+	// Zero attempts still makes one.
+	s = &flakySink{failures: 10}
+	require.Error(t, PublishWithRetry(context.Background(), s, Snapshot{}, RetryPolicy{}, nil))
+	require.Equal(t, 1, s.calls)
+}
+
+func TestPublishWithRetry_StopsOnContextDone(t *testing.T) {
+	s := &flakySink{failures: 10}
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.Error(t, PublishWithRetry(ctx, s, Snapshot{}, p, nil))
+	require.Equal(t, 1, s.calls)
+}
+
+type hangingSink struct{ calls int }
+
+func (h *hangingSink) Publish(ctx context.Context, _ Snapshot) error {
+	h.calls++
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestPublishWithRetry_TimesOutEachAttempt(t *testing.T) {
+	s := &hangingSink{}
+	p := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Timeout: 5 * time.Millisecond}
+
+	err := PublishWithRetry(context.Background(), s, Snapshot{}, p, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 2, s.calls)
+}
+
+type rejectingSink struct{ calls int }
+
+func (r *rejectingSink) Publish(context.Context, Snapshot) error {
+	r.calls++
+	return Permanent(errors.New("malformed"))
+}
+
+func TestPublishWithRetry_StopsOnPermanentError(t *testing.T) {
+	s := &rejectingSink{}
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	err := PublishWithRetry(context.Background(), s, Snapshot{}, p, nil)
+	require.EqualError(t, err, "malformed")
+	require.True(t, IsPermanent(err))
+	require.Equal(t, 1, s.calls)
+
+	require.NoError(t, Permanent(nil))
+	require.False(t, IsPermanent(errors.New("boom")))
+}
@@ -1,18 +1,149 @@
 package sink
 
-import "context"
-
 //go:generate mockgen -source=sink.go -destination=./mocks/mock_sink.go -package=mocks
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Temporality tells whether a snapshot's counts cover only its window or
+// everything since StartTime, following OTLP aggregation temporality.
+type Temporality string
+
+const (
+	TemporalityDelta      Temporality = "delta"
+	TemporalityCumulative Temporality = "cumulative"
+)
+
+// ParseTemporalities parses delta|cumulative|both into the views to emit, in
+// emission order.
+func ParseTemporalities(s string) ([]Temporality, error) {
+	switch s {
+	case "", string(TemporalityDelta):
+		return []Temporality{TemporalityDelta}, nil
+	case string(TemporalityCumulative):
+		return []Temporality{TemporalityCumulative}, nil
+	case "both":
+		return []Temporality{TemporalityDelta, TemporalityCumulative}, nil
+	default:
+		return nil, fmt.Errorf("invalid temporality %q: want delta|cumulative|both", s)
+	}
+}
+
+// SchemaVersion is the version of the snapshot schema defined by
+// proto/processor/v1/snapshot.proto, stamped as schema_version on every
+// snapshot an output encodes.
+const SchemaVersion = 1
+
 // Snapshot describes the data emitted at the end of a window.
+//
+// Records whose attribute could not be resolved to a value are not part of
+// Counts; they are tallied in the reserved Missing, Null and Unsupported
+// buckets so they can never collide with a genuine attribute value.
+//
+// For cumulative snapshots the counters cover StartTime to WindowEnd rather
+// than the window alone. Tenant is the optional label of the processor
+// instance that produced the snapshot. Generation identifies the runtime
+// configuration the window was aggregated under.
 type Snapshot struct {
+	WindowStart  int64             `json:"window_start"`
+	WindowEnd    int64             `json:"window_end"`
+	Temporality  Temporality       `json:"temporality,omitempty"`
+	Generation   uint64            `json:"generation,omitempty"`
+	StartTime    int64             `json:"start_time,omitempty"`
 	AttributeKey string            `json:"attribute_key"`
+	Tenant       string            `json:"tenant,omitempty"`
 	Counts       map[string]uint64 `json:"counts"`
-	Unknown 	uint64            	`json:"unknown"`
+	Missing      uint64            `json:"missing"`
+	Null         uint64            `json:"null"`
+	Unsupported  uint64            `json:"unsupported"`
+	Labels       BucketLabels      `json:"labels"`
 	Total        uint64            `json:"total"`
 	Dropped      uint64            `json:"dropped"`
 }
 
+// ReservedPrefix starts every reserved-bucket label. Outputs that flatten the
+// buckets into one value list escape attribute values starting with it, see
+// EscapeValue, so a label never names a genuine value.
+const ReservedPrefix = "__"
+
+// BucketLabels names the reserved buckets for outputs that present them
+// alongside regular attribute values.
+type BucketLabels struct {
+	Missing     string `json:"missing"`
+	Null        string `json:"null"`
+	Unsupported string `json:"unsupported"`
+}
+
+// DefaultBucketLabels returns the labels used when none are configured.
+func DefaultBucketLabels() BucketLabels {
+	return BucketLabels{Missing: "__missing__", Null: "__null__", Unsupported: "__unsupported__"}
+}
+
+// Validate checks that every label starts with ReservedPrefix, but not with
+// the extra underscore of an escaped value, and that the labels differ.
+func (l BucketLabels) Validate() error {
+	var errs []error
+
+	seen := make(map[string]string, 3)
+
+	for _, b := range []struct{ name, label string }{
+		{"missing", l.Missing},
+		{"null", l.Null},
+		{"unsupported", l.Unsupported},
+	} {
+		if !strings.HasPrefix(b.label, ReservedPrefix) || strings.HasPrefix(b.label, "_"+ReservedPrefix) {
+			errs = append(errs, fmt.Errorf("%s label %q: must start with %q followed by another character than '_'", b.name, b.label, ReservedPrefix))
+		}
+
+		if other, ok := seen[b.label]; ok {
+			errs = append(errs, fmt.Errorf("%s label %q: already used by the %s bucket", b.name, b.label, other))
+		}
+
+		seen[b.label] = b.name
+	}
+
+	return errors.Join(errs...)
+}
+
+// EscapeValue returns the attribute value v as listed by outputs that flatten
+// the reserved buckets into the values: a value starting with ReservedPrefix
+// gets one more underscore, so "__missing__" is listed as "___missing__".
+func EscapeValue(v string) string {
+	if strings.HasPrefix(v, ReservedPrefix) {
+		return "_" + v
+	}
+
+	return v
+}
+
+// LabeledCounts returns Counts, escaped by EscapeValue, together with the
+// non-empty reserved buckets under their labels. With valid labels every
+// bucket is its own entry and never adds to an attribute value.
+func (s Snapshot) LabeledCounts() map[string]uint64 {
+	out := make(map[string]uint64, len(s.Counts)+3)
+	for k, v := range s.Counts {
+		out[EscapeValue(k)] = v
+	}
+
+	for _, b := range []struct {
+		label string
+		n     uint64
+	}{
+		{s.Labels.Missing, s.Missing},
+		{s.Labels.Null, s.Null},
+		{s.Labels.Unsupported, s.Unsupported},
+	} {
+		if b.n > 0 {
+			out[b.label] = b.n
+		}
+	}
+
+	return out
+}
 
 // Sink publishes per-window snapshots. A JSON stdout implementation can be added later.
 type Sink interface {
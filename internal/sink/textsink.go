@@ -0,0 +1,71 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+func init() {
+	RegisterFormatter("log", func(o FormatOptions) Formatter { return NewTextFormatter(o) })
+}
+
+// TextFormatter renders a snapshot for humans: a header line with the window
+// bounds and totals, then one line per value, sorted by value, with the
+// values and counts aligned. Timestamps default to RFC3339.
+//
+//	2024-03-09T16:00:00Z .. 2024-03-09T16:00:10Z  foo  total=6 dropped=0
+//	  __missing__  1
+//	  alpha        3
+//	  beta         2
+type TextFormatter struct {
+	tf TimeFormat
+}
+
+// NewTextFormatter returns a text formatter; Pretty has no effect.
+func NewTextFormatter(opts FormatOptions) TextFormatter {
+	tf := opts.TimeFormat
+	if tf == "" {
+		tf = TimeRFC3339
+	}
+
+	return TextFormatter{tf: tf}
+}
+
+// Format implements Formatter.
+func (f TextFormatter) Format(snap Snapshot) ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "%s .. %s  %s  total=%d dropped=%d",
+		f.tf.Render(snap.WindowStart), f.tf.Render(snap.WindowEnd), snap.AttributeKey, snap.Total, snap.Dropped)
+
+	if snap.Temporality == TemporalityCumulative {
+		fmt.Fprintf(&b, " cumulative_since=%s", f.tf.Render(snap.StartTime))
+	}
+
+	if snap.Tenant != "" {
+		fmt.Fprintf(&b, " tenant=%s", snap.Tenant)
+	}
+
+	b.WriteByte('\n')
+
+	counts := snap.LabeledCounts()
+
+	values := make([]string, 0, len(counts))
+	valueWidth, countWidth := 0, 0
+
+	for v, n := range counts {
+		values = append(values, v)
+		valueWidth = max(valueWidth, len(v))
+		countWidth = max(countWidth, len(strconv.FormatUint(n, 10)))
+	}
+
+	sort.Strings(values)
+
+	for _, v := range values {
+		fmt.Fprintf(&b, "  %-*s  %*d\n", valueWidth, v, countWidth, counts[v])
+	}
+
+	return b.Bytes(), nil
+}
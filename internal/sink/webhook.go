@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Poster posts JSON bodies to an HTTP endpoint; the snapshot and alert
+// webhooks share it. Network errors, 429 and 5xx responses are returned for
+// the caller to retry; other non-2xx responses are Permanent.
+type Poster struct {
+	url    string
+	client *http.Client
+}
+
+// NewPoster returns a poster to url. Attempts are bounded by the context,
+// e.g. the retry policy's per-attempt timeout.
+func NewPoster(url string) *Poster {
+	return &Poster{url: url, client: &http.Client{}}
+}
+
+// Post sends body in a single attempt.
+func (p *Poster) Post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	err = fmt.Errorf("webhook responded %d", resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+
+	return Permanent(err)
+}
+
+// Webhook posts each snapshot as a JSON object to an HTTP endpoint through a
+// Poster, leaving retries to the caller.
+type Webhook struct {
+	p *Poster
+	f JSONFormatter
+}
+
+// NewWebhook returns a sink posting snapshots to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{p: NewPoster(url)}
+}
+
+// Publish posts snap.
+func (w *Webhook) Publish(ctx context.Context, snap Snapshot) error {
+	body, err := w.f.Format(snap)
+	if err != nil {
+		return Permanent(fmt.Errorf("encode snapshot: %w", err))
+	}
+
+	return w.p.Post(ctx, body)
+}
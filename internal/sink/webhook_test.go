@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook_Publish(t *testing.T) {
+	status := http.StatusOK
+
+	var got Snapshot
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &got))
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	snap := Snapshot{WindowStart: 1000, WindowEnd: 2000, AttributeKey: "foo", Counts: map[string]uint64{"a": 1}, Total: 1}
+	wh := NewWebhook(srv.URL)
+
+	require.NoError(t, wh.Publish(context.Background(), snap))
+	require.Equal(t, snap, got)
+
+	// Overload and server errors are retried; other rejections are not.
+	status = http.StatusServiceUnavailable
+	err := wh.Publish(context.Background(), snap)
+	require.Error(t, err)
+	require.False(t, IsPermanent(err))
+
+	status = http.StatusBadRequest
+	err = wh.Publish(context.Background(), snap)
+	require.ErrorContains(t, err, "webhook responded 400")
+	require.True(t, IsPermanent(err))
+}
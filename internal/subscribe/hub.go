@@ -0,0 +1,203 @@
+// Package subscribe fans published snapshots out to streaming subscribers.
+package subscribe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"dash0.com/otlp-log-processor-backend/internal/query"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Policy decides what happens when a subscriber's buffer is full.
+type Policy string
+
+const (
+	// PolicyDropOldest discards the oldest buffered snapshot to make room.
+	PolicyDropOldest Policy = "drop_oldest"
+	// PolicyDisconnect ends the subscription with ErrSlowSubscriber.
+	PolicyDisconnect Policy = "disconnect"
+)
+
+// ParsePolicy parses drop_oldest|disconnect; "" means drop_oldest.
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case "", PolicyDropOldest:
+		return PolicyDropOldest, nil
+	case PolicyDisconnect:
+		return PolicyDisconnect, nil
+	default:
+		return "", fmt.Errorf("invalid subscriber policy %q: want drop_oldest|disconnect", s)
+	}
+}
+
+var (
+	// ErrSlowSubscriber ends a subscription that fell behind under PolicyDisconnect.
+	ErrSlowSubscriber = errors.New("subscriber too slow")
+	// ErrClosed ends every subscription when the hub closes.
+	ErrClosed = errors.New("subscriptions closed")
+)
+
+// Match selects the snapshots a subscriber receives. Empty fields match any.
+type Match struct {
+	AttributeKey string
+	Tenant       string
+	Filter       query.Filter
+}
+
+func (m Match) matches(s sink.Snapshot) bool {
+	return (m.AttributeKey == "" || m.AttributeKey == s.AttributeKey) &&
+		(m.Tenant == "" || m.Tenant == s.Tenant)
+}
+
+// Hub is a Sink that hands every published snapshot to the matching
+// subscribers. Publish never blocks on a subscriber: each has a bounded buffer
+// handled according to the hub's Policy.
+type Hub struct {
+	buffer int
+	policy Policy
+	onDrop func(Policy)
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns a hub buffering up to buffer snapshots per subscriber.
+func NewHub(buffer int, policy Policy) *Hub {
+	return &Hub{buffer: max(buffer, 1), policy: policy, subs: make(map[*Subscription]struct{})}
+}
+
+// SetDropCallback installs an optional callback invoked whenever a snapshot is
+// dropped or a subscriber disconnected, e.g. for metrics. Must be called
+// before the hub is used.
+func (h *Hub) SetDropCallback(fn func(Policy)) { h.onDrop = fn }
+
+// Subscription is one subscriber's view of the hub.
+type Subscription struct {
+	match   Match
+	ch      chan sink.Snapshot
+	done    chan struct{}
+	err     error
+	dropped atomic.Uint64
+}
+
+// C delivers the matching snapshots, filtered by the subscription's Filter.
+func (s *Subscription) C() <-chan sink.Snapshot { return s.ch }
+
+// Done is closed when the hub ends the subscription; Err tells why. Snapshots
+// still buffered in C may be read afterwards.
+func (s *Subscription) Done() <-chan struct{} { return s.done }
+
+// Err returns ErrSlowSubscriber or ErrClosed once Done is closed.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Dropped returns the number of snapshots discarded because the buffer was full.
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+// Subscribe registers a subscriber. It fails with ErrClosed once the hub is closed.
+func (h *Hub) Subscribe(m Match) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	s := &Subscription{match: m, ch: make(chan sink.Snapshot, h.buffer), done: make(chan struct{})}
+	h.subs[s] = struct{}{}
+
+	return s, nil
+}
+
+// Unsubscribe removes s; it is safe to call more than once.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, s)
+}
+
+// Len returns the number of active subscribers.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
+
+// Publish hands snap to every matching subscriber. It never fails, so the
+// aggregator never retries or dead-letters on behalf of a subscriber.
+func (h *Hub) Publish(_ context.Context, snap sink.Snapshot) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		if !s.match.matches(snap) {
+			continue
+		}
+
+		h.offer(s, s.match.Filter.Apply(snap))
+	}
+
+	return nil
+}
+
+// offer buffers snap for s. Publishes are serialized by h.mu, so once the
+// oldest entry is discarded the send cannot fail.
+func (h *Hub) offer(s *Subscription, snap sink.Snapshot) {
+	select {
+	case s.ch <- snap:
+		return
+	default:
+	}
+
+	if h.onDrop != nil {
+		h.onDrop(h.policy)
+	}
+
+	if h.policy == PolicyDisconnect {
+		h.end(s, ErrSlowSubscriber)
+		return
+	}
+
+	select {
+	case <-s.ch:
+		s.dropped.Add(1)
+	default:
+	}
+
+	s.ch <- snap
+}
+
+// end closes the subscription with err; h.mu must be held.
+func (h *Hub) end(s *Subscription, err error) {
+	s.err = err
+	close(s.done)
+	delete(h.subs, s)
+}
+
+// Close ends every subscription with ErrClosed and rejects new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.closed = true
+	for s := range h.subs {
+		h.end(s, ErrClosed)
+	}
+}
@@ -0,0 +1,101 @@
+package subscribe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/query"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func snap(start int64, key, tenant string, counts map[string]uint64) sink.Snapshot {
+	return sink.Snapshot{WindowStart: start, AttributeKey: key, Tenant: tenant, Counts: counts}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, PolicyDropOldest, p)
+
+	p, err = ParsePolicy("disconnect")
+	require.NoError(t, err)
+	require.Equal(t, PolicyDisconnect, p)
+
+	_, err = ParsePolicy("block")
+	require.Error(t, err)
+}
+
+func TestHub_MatchesAndFilters(t *testing.T) {
+	h := NewHub(4, PolicyDropOldest)
+
+	byKey, err := h.Subscribe(Match{AttributeKey: "foo", Filter: query.Filter{Prefix: "api-"}})
+	require.NoError(t, err)
+
+	byTenant, err := h.Subscribe(Match{Tenant: "eu-1"})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Publish(context.Background(), snap(1, "foo", "us-1", map[string]uint64{"api-1": 1, "web": 2})))
+	require.NoError(t, h.Publish(context.Background(), snap(2, "bar", "eu-1", map[string]uint64{"x": 1})))
+
+	got := <-byKey.C()
+	require.EqualValues(t, 1, got.WindowStart)
+	require.Equal(t, map[string]uint64{"api-1": 1}, got.Counts)
+	require.Empty(t, byKey.C())
+
+	got = <-byTenant.C()
+	require.EqualValues(t, 2, got.WindowStart)
+	require.Empty(t, byTenant.C())
+}
+
+func TestHub_DropOldest(t *testing.T) {
+	var drops int
+
+	h := NewHub(2, PolicyDropOldest)
+	h.SetDropCallback(func(Policy) { drops++ })
+
+	s, err := h.Subscribe(Match{})
+	require.NoError(t, err)
+
+	for i := range int64(5) {
+		require.NoError(t, h.Publish(context.Background(), snap(i, "foo", "", nil)))
+	}
+
+	require.EqualValues(t, 3, s.Dropped())
+	require.Equal(t, 3, drops)
+	require.EqualValues(t, 3, (<-s.C()).WindowStart)
+	require.EqualValues(t, 4, (<-s.C()).WindowStart)
+	require.NoError(t, s.Err())
+}
+
+func TestHub_Disconnect(t *testing.T) {
+	h := NewHub(1, PolicyDisconnect)
+
+	s, err := h.Subscribe(Match{})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Publish(context.Background(), snap(1, "foo", "", nil)))
+	require.NoError(t, h.Publish(context.Background(), snap(2, "foo", "", nil)))
+
+	<-s.Done()
+	require.ErrorIs(t, s.Err(), ErrSlowSubscriber)
+	require.Zero(t, h.Len())
+	require.EqualValues(t, 1, (<-s.C()).WindowStart)
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub(1, PolicyDropOldest)
+
+	s, err := h.Subscribe(Match{})
+	require.NoError(t, err)
+
+	h.Close()
+	h.Close()
+
+	<-s.Done()
+	require.ErrorIs(t, s.Err(), ErrClosed)
+
+	_, err = h.Subscribe(Match{})
+	require.ErrorIs(t, err, ErrClosed)
+}
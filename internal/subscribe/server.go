@@ -0,0 +1,68 @@
+package subscribe
+
+import (
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+	"dash0.com/otlp-log-processor-backend/internal/query"
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// Server implements the SubscriptionService on top of a Hub.
+type Server struct {
+	processorv1.UnimplementedSubscriptionServiceServer
+
+	hub *Hub
+}
+
+// NewServer returns a subscription server streaming from hub.
+func NewServer(hub *Hub) *Server { return &Server{hub: hub} }
+
+// Subscribe streams matching snapshots until the client goes away or the hub
+// ends the subscription.
+func (s *Server) Subscribe(req *processorv1.SubscribeRequest, stream grpc.ServerStreamingServer[processorv1.SubscribeResponse]) error {
+	sub, err := s.hub.Subscribe(Match{
+		AttributeKey: req.GetAttributeKey(),
+		Tenant:       req.GetTenant(),
+		Filter:       query.Filter{Prefix: req.GetFilter().GetPrefix(), TopN: int(req.GetFilter().GetTopN())},
+	})
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer s.hub.Unsubscribe(sub)
+
+	send := func(snap sink.Snapshot) error {
+		return stream.Send(&processorv1.SubscribeResponse{Snapshot: snap.Proto(), Dropped: sub.Dropped()})
+	}
+
+	for {
+		select {
+		case snap := <-sub.C():
+			if err := send(snap); err != nil {
+				return err
+			}
+		case <-sub.Done():
+			if errors.Is(sub.Err(), ErrSlowSubscriber) {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+
+			// On shutdown, deliver what is already buffered before ending the stream.
+			for {
+				select {
+				case snap := <-sub.C():
+					if err := send(snap); err != nil {
+						return err
+					}
+				default:
+					return status.Error(codes.Unavailable, sub.Err().Error())
+				}
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
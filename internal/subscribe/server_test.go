@@ -0,0 +1,95 @@
+package subscribe
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	processorv1 "dash0.com/otlp-log-processor-backend/internal/api/processor/v1"
+)
+
+func dial(t *testing.T, hub *Hub) processorv1.SubscriptionServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	processorv1.RegisterSubscriptionServiceServer(gs, NewServer(hub))
+
+	go func() { _ = gs.Serve(lis) }()
+
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return processorv1.NewSubscriptionServiceClient(conn)
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	hub := NewHub(4, PolicyDropOldest)
+	client := dial(t, hub)
+
+	stream, err := client.Subscribe(context.Background(), &processorv1.SubscribeRequest{
+		AttributeKey: "foo",
+		Filter:       &processorv1.Filter{TopN: 1},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, hub.Publish(context.Background(), snap(1, "bar", "", map[string]uint64{"a": 1})))
+	require.NoError(t, hub.Publish(context.Background(), snap(2, "foo", "", map[string]uint64{"a": 1, "b": 5})))
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, resp.GetSnapshot().GetWindowStart())
+	require.Len(t, resp.GetSnapshot().GetCounts(), 1)
+	require.Equal(t, "b", resp.GetSnapshot().GetCounts()[0].GetValue())
+
+	// Buffered snapshots are still sent when the hub closes.
+	require.NoError(t, hub.Publish(context.Background(), snap(3, "foo", "", nil)))
+	hub.Close()
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	require.EqualValues(t, 3, resp.GetSnapshot().GetWindowStart())
+
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestServer_SlowSubscriberDisconnected(t *testing.T) {
+	hub := NewHub(1, PolicyDisconnect)
+	client := dial(t, hub)
+
+	stream, err := client.Subscribe(context.Background(), &processorv1.SubscribeRequest{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, time.Millisecond)
+
+	// The server drains the buffer concurrently, so keep publishing until it falls behind.
+	require.Eventually(t, func() bool {
+		_ = hub.Publish(context.Background(), snap(1, "foo", "", nil))
+		_ = hub.Publish(context.Background(), snap(2, "foo", "", nil))
+
+		return hub.Len() == 0
+	}, time.Second, time.Millisecond)
+
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -0,0 +1,52 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// csvHeader names the columns of the long format.
+var csvHeader = []string{"window_start", "window_end", "key", "value", "count", "temporality", "start_time"}
+
+// csvWriter writes a header line, then one line per row. Every write is
+// flushed, so a file can be read while it is still open.
+type csvWriter struct {
+	w  *csv.Writer
+	tf sink.TimeFormat
+}
+
+func newCSVWriter(w io.Writer, tf sink.TimeFormat) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w), tf: tf}
+
+	if err := c.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+
+	c.w.Flush()
+
+	return c, c.w.Error()
+}
+
+func (c *csvWriter) write(rows []Row) error {
+	for _, r := range rows {
+		rec := []string{
+			c.tf.Render(r.WindowStart), c.tf.Render(r.WindowEnd), r.Key, r.Value, strconv.FormatUint(r.Count, 10),
+			string(r.Temporality), c.tf.Render(r.StartTime),
+		}
+		if err := c.w.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
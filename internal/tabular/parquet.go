@@ -0,0 +1,391 @@
+package tabular
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultRowGroupSize is the number of rows per Parquet row group.
+const DefaultRowGroupSize = 10000
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// Compression is the codec of Parquet data pages.
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionSnappy Compression = "snappy"
+	CompressionGzip   Compression = "gzip"
+	CompressionZstd   Compression = "zstd"
+)
+
+// ParseCompression parses none|snappy|gzip|zstd; "" means snappy.
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case "":
+		return CompressionSnappy, nil
+	case CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid compression %q: want none|snappy|gzip|zstd", s)
+	}
+}
+
+// Parquet enum values from parquet.thrift.
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionRequired = 0
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData = 0
+)
+
+// codecID returns the CompressionCodec value of c.
+func (c Compression) codecID() int32 {
+	switch c {
+	case CompressionSnappy:
+		return 1
+	case CompressionGzip:
+		return 2
+	case CompressionZstd:
+		return 6
+	default:
+		return 0
+	}
+}
+
+// column is one leaf of the flat, all-required schema.
+type column struct {
+	name      string
+	physical  int32
+	timestamp bool
+	int64Of   func(Row) int64
+	stringOf  func(Row) string
+}
+
+// columns is the long format: one row per window and value.
+var columns = []column{
+	{name: "window_start", physical: typeInt64, timestamp: true, int64Of: func(r Row) int64 { return r.WindowStart }},
+	{name: "window_end", physical: typeInt64, timestamp: true, int64Of: func(r Row) int64 { return r.WindowEnd }},
+	{name: "key", physical: typeByteArray, stringOf: func(r Row) string { return r.Key }},
+	{name: "value", physical: typeByteArray, stringOf: func(r Row) string { return r.Value }},
+	{name: "count", physical: typeInt64, int64Of: func(r Row) int64 { return int64(r.Count) }},
+	{name: "temporality", physical: typeByteArray, stringOf: func(r Row) string { return string(r.Temporality) }},
+	{name: "start_time", physical: typeInt64, timestamp: true, int64Of: func(r Row) int64 { return r.StartTime }},
+}
+
+type chunkMeta struct {
+	offset                   int64
+	uncompressed, compressed int64
+	min, max                 []byte
+}
+
+type rowGroup struct {
+	rows   int64
+	chunks []chunkMeta
+}
+
+// parquetWriter writes rows as a Parquet file: every RowGroupSize rows become
+// a row group holding one PLAIN encoded data page per column, and close
+// writes the footer. Nothing is readable until then.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	codec     Compression
+	groupSize int
+	zstd      *zstd.Encoder
+
+	pending []Row
+	groups  []rowGroup
+	rows    int64
+}
+
+func newParquetWriter(w io.Writer, codec Compression, groupSize int) (*parquetWriter, error) {
+	if groupSize <= 0 {
+		groupSize = DefaultRowGroupSize
+	}
+
+	p := &parquetWriter{w: w, codec: codec, groupSize: groupSize}
+
+	if codec == CompressionZstd {
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		p.zstd = enc
+	}
+
+	if err := p.emit([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *parquetWriter) emit(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+
+	return err
+}
+
+// write buffers rows and writes every row group that is full.
+func (p *parquetWriter) write(rows []Row) error {
+	p.pending = append(p.pending, rows...)
+
+	for len(p.pending) >= p.groupSize {
+		if err := p.flushGroup(p.pending[:p.groupSize]); err != nil {
+			return err
+		}
+
+		p.pending = p.pending[p.groupSize:]
+	}
+
+	return nil
+}
+
+// close writes the buffered rows as a last row group, then the footer.
+func (p *parquetWriter) close() error {
+	if p.zstd != nil {
+		defer p.zstd.Close()
+	}
+
+	if len(p.pending) > 0 {
+		if err := p.flushGroup(p.pending); err != nil {
+			return err
+		}
+
+		p.pending = nil
+	}
+
+	footer := p.footer()
+	if err := p.emit(footer); err != nil {
+		return err
+	}
+
+	return p.emit(append(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))), parquetMagic...))
+}
+
+func (p *parquetWriter) flushGroup(rows []Row) error {
+	g := rowGroup{rows: int64(len(rows))}
+
+	for _, col := range columns {
+		values, lo, hi := encodePlain(col, rows)
+
+		page, err := p.compress(values)
+		if err != nil {
+			return err
+		}
+
+		h := newCompact()
+		h.i32Field(1, pageData)
+		h.i32Field(2, int32(len(values)))
+		h.i32Field(3, int32(len(page)))
+		h.structField(5, func() {
+			h.i32Field(1, int32(len(rows)))
+			h.i32Field(2, encodingPlain)
+			h.i32Field(3, encodingRLE)
+			h.i32Field(4, encodingRLE)
+		})
+		h.end()
+
+		chunk := chunkMeta{
+			offset:       p.offset,
+			uncompressed: int64(len(h.bytes()) + len(values)),
+			compressed:   int64(len(h.bytes()) + len(page)),
+			min:          lo,
+			max:          hi,
+		}
+
+		if err := p.emit(h.bytes()); err != nil {
+			return err
+		}
+
+		if err := p.emit(page); err != nil {
+			return err
+		}
+
+		g.chunks = append(g.chunks, chunk)
+	}
+
+	p.groups = append(p.groups, g)
+	p.rows += g.rows
+
+	return nil
+}
+
+// encodePlain returns the PLAIN encoding of the column's values along with
+// their minimum and maximum, encoded the same way without length prefix.
+func encodePlain(col column, rows []Row) (values, lo, hi []byte) {
+	var b bytes.Buffer
+
+	if col.physical == typeInt64 {
+		var minV, maxV int64
+
+		for i, r := range rows {
+			v := col.int64Of(r)
+			if i == 0 || v < minV {
+				minV = v
+			}
+
+			if i == 0 || v > maxV {
+				maxV = v
+			}
+
+			b.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+		}
+
+		return b.Bytes(), binary.LittleEndian.AppendUint64(nil, uint64(minV)), binary.LittleEndian.AppendUint64(nil, uint64(maxV))
+	}
+
+	var minV, maxV string
+
+	for i, r := range rows {
+		v := col.stringOf(r)
+		if i == 0 || v < minV {
+			minV = v
+		}
+
+		if i == 0 || v > maxV {
+			maxV = v
+		}
+
+		b.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+		b.WriteString(v)
+	}
+
+	return b.Bytes(), []byte(minV), []byte(maxV)
+}
+
+func (p *parquetWriter) compress(data []byte) ([]byte, error) {
+	switch p.codec {
+	case CompressionSnappy:
+		return s2.EncodeSnappy(nil, data), nil
+	case CompressionGzip:
+		var b bytes.Buffer
+
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		return b.Bytes(), nil
+	case CompressionZstd:
+		return p.zstd.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
+
+// footer encodes the FileMetaData.
+func (p *parquetWriter) footer() []byte {
+	c := newCompact()
+	c.i32Field(1, 1)
+
+	c.listField(2, tStruct, len(columns)+1)
+	c.structBody(func() {
+		c.binaryField(4, []byte("schema"))
+		c.i32Field(5, int32(len(columns)))
+	})
+
+	for _, col := range columns {
+		c.structBody(func() {
+			c.i32Field(1, col.physical)
+			c.i32Field(3, repetitionRequired)
+			c.binaryField(4, []byte(col.name))
+
+			switch {
+			case col.timestamp:
+				c.i32Field(6, convertedTimestampMillis)
+				c.structField(10, func() {
+					c.structField(8, func() {
+						c.boolField(1, true)
+						c.structField(2, func() { c.structField(1, func() {}) })
+					})
+				})
+			case col.physical == typeByteArray:
+				c.i32Field(6, convertedUTF8)
+				c.structField(10, func() { c.structField(1, func() {}) })
+			}
+		})
+	}
+
+	c.i64Field(3, p.rows)
+
+	c.listField(4, tStruct, len(p.groups))
+
+	for _, g := range p.groups {
+		c.structBody(func() { p.encodeGroup(c, g) })
+	}
+
+	c.binaryField(6, []byte("otlp-log-processor-backend"))
+
+	// Type defined orders, so readers trust the min and max statistics.
+	c.listField(7, tStruct, len(columns))
+
+	for range columns {
+		c.structBody(func() { c.structField(1, func() {}) })
+	}
+
+	c.end()
+
+	return c.bytes()
+}
+
+func (p *parquetWriter) encodeGroup(c *compact, g rowGroup) {
+	var uncompressed, compressed int64
+
+	c.listField(1, tStruct, len(g.chunks))
+
+	for i, ch := range g.chunks {
+		col := columns[i]
+		uncompressed += ch.uncompressed
+		compressed += ch.compressed
+
+		c.structBody(func() {
+			c.i64Field(2, ch.offset)
+			c.structField(3, func() {
+				c.i32Field(1, col.physical)
+				c.listField(2, tI32, 1)
+				c.varint(encodingPlain)
+				c.listField(3, tBinary, 1)
+				c.binary([]byte(col.name))
+				c.i32Field(4, p.codec.codecID())
+				c.i64Field(5, g.rows)
+				c.i64Field(6, ch.uncompressed)
+				c.i64Field(7, ch.compressed)
+				c.i64Field(9, ch.offset)
+				c.structField(12, func() {
+					c.i64Field(3, 0)
+					c.binaryField(5, ch.max)
+					c.binaryField(6, ch.min)
+				})
+			})
+		})
+	}
+
+	c.i64Field(2, uncompressed)
+	c.i64Field(3, g.rows)
+	c.i64Field(5, g.chunks[0].offset)
+	c.i64Field(6, compressed)
+}
@@ -0,0 +1,277 @@
+package tabular
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// decoder reads the Thrift compact protocol into generic values: structs as
+// map[int16]any, lists as []any, integers as int64, binaries as []byte.
+type decoder struct{ r *bytes.Reader }
+
+func (d *decoder) varint(t *testing.T) int64 {
+	v, err := binary.ReadVarint(d.r)
+	require.NoError(t, err)
+
+	return v
+}
+
+func (d *decoder) uvarint(t *testing.T) uint64 {
+	v, err := binary.ReadUvarint(d.r)
+	require.NoError(t, err)
+
+	return v
+}
+
+func (d *decoder) value(t *testing.T, typ byte) any {
+	switch typ {
+	case tBoolTrue:
+		return true
+	case tBoolFalse:
+		return false
+	case tI32, tI64:
+		return d.varint(t)
+	case tBinary:
+		b := make([]byte, d.uvarint(t))
+		_, err := io.ReadFull(d.r, b)
+		require.NoError(t, err)
+
+		return b
+	case tList:
+		h, err := d.r.ReadByte()
+		require.NoError(t, err)
+
+		n := uint64(h >> 4)
+		if n == 15 {
+			n = d.uvarint(t)
+		}
+
+		out := make([]any, 0, n)
+		for range n {
+			out = append(out, d.value(t, h&0x0f))
+		}
+
+		return out
+	case tStruct:
+		return d.structValue(t)
+	default:
+		t.Fatalf("unexpected thrift type %d", typ)
+		return nil
+	}
+}
+
+func (d *decoder) structValue(t *testing.T) map[int16]any {
+	out := map[int16]any{}
+
+	var id int16
+
+	for {
+		h, err := d.r.ReadByte()
+		require.NoError(t, err)
+
+		if h == 0 {
+			return out
+		}
+
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(d.varint(t))
+		}
+
+		out[id] = d.value(t, h&0x0f)
+	}
+}
+
+func decodeStruct(t *testing.T, b []byte) (map[int16]any, int) {
+	t.Helper()
+
+	r := bytes.NewReader(b)
+	v := (&decoder{r: r}).structValue(t)
+
+	return v, len(b) - r.Len()
+}
+
+func decompress(t *testing.T, codec int64, page []byte) []byte {
+	t.Helper()
+
+	switch codec {
+	case 0:
+		return page
+	case 1:
+		out, err := s2.Decode(nil, page)
+		require.NoError(t, err)
+
+		return out
+	case 2:
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		require.NoError(t, err)
+
+		out, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		return out
+	case 6:
+		zr, err := zstd.NewReader(nil)
+		require.NoError(t, err)
+
+		defer zr.Close()
+
+		out, err := zr.DecodeAll(page, nil)
+		require.NoError(t, err)
+
+		return out
+	default:
+		t.Fatalf("unexpected codec %d", codec)
+		return nil
+	}
+}
+
+// readParquet decodes a file written by parquetWriter back into rows, checking
+// the metadata on the way.
+func readParquet(t *testing.T, file []byte) ([]Row, map[int16]any) {
+	t.Helper()
+
+	require.Equal(t, parquetMagic, string(file[:4]))
+	require.Equal(t, parquetMagic, string(file[len(file)-4:]))
+
+	n := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta, _ := decodeStruct(t, file[len(file)-8-n:len(file)-8])
+
+	schema := meta[2].([]any)
+	require.Len(t, schema, len(columns)+1)
+	require.EqualValues(t, len(columns), schema[0].(map[int16]any)[5])
+
+	for i, col := range columns {
+		require.Equal(t, col.name, string(schema[i+1].(map[int16]any)[4].([]byte)))
+	}
+
+	var rows []Row
+
+	for _, g := range meta[4].([]any) {
+		group := g.(map[int16]any)
+		chunks := group[1].([]any)
+		require.Len(t, chunks, len(columns))
+
+		groupRows := make([]Row, group[3].(int64))
+
+		for i, c := range chunks {
+			cm := c.(map[int16]any)[3].(map[int16]any)
+			require.Equal(t, []any{[]byte(columns[i].name)}, cm[3])
+			require.Equal(t, group[3], cm[5])
+
+			off := cm[9].(int64)
+			header, hn := decodeStruct(t, file[off:])
+			require.EqualValues(t, pageData, header[1])
+			require.Equal(t, cm[7], int64(hn)+header[3].(int64))
+
+			page := file[off+int64(hn) : off+int64(hn)+header[3].(int64)]
+			values := decompress(t, cm[4].(int64), page)
+			require.Len(t, values, int(header[2].(int64)))
+
+			for j := range groupRows {
+				switch columns[i].name {
+				case "window_start":
+					groupRows[j].WindowStart = int64(binary.LittleEndian.Uint64(values))
+				case "window_end":
+					groupRows[j].WindowEnd = int64(binary.LittleEndian.Uint64(values))
+				case "start_time":
+					groupRows[j].StartTime = int64(binary.LittleEndian.Uint64(values))
+				case "count":
+					groupRows[j].Count = binary.LittleEndian.Uint64(values)
+				case "key", "value", "temporality":
+					l := binary.LittleEndian.Uint32(values)
+					s := string(values[4 : 4+l])
+
+					switch columns[i].name {
+					case "key":
+						groupRows[j].Key = s
+					case "value":
+						groupRows[j].Value = s
+					default:
+						groupRows[j].Temporality = sink.Temporality(s)
+					}
+
+					values = values[4+l:]
+
+					continue
+				}
+
+				values = values[8:]
+			}
+
+			require.Empty(t, values)
+		}
+
+		rows = append(rows, groupRows...)
+	}
+
+	require.EqualValues(t, len(rows), meta[3])
+	require.Len(t, meta[7], len(columns))
+
+	return rows, meta
+}
+
+func TestParquetWriter_RoundTrip(t *testing.T) {
+	var in []Row
+	for i := range 5 {
+		in = append(in, Row{
+			WindowStart: int64(1000 * i), WindowEnd: int64(1000*i + 1000), Key: "foo", Value: fmt.Sprintf("v%d", i), Count: uint64(i + 1),
+			Temporality: sink.TemporalityCumulative,
+		})
+	}
+
+	for _, codec := range []Compression{CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			var b bytes.Buffer
+
+			p, err := newParquetWriter(&b, codec, 2)
+			require.NoError(t, err)
+			require.NoError(t, p.write(in[:3]))
+			require.NoError(t, p.write(in[3:]))
+			require.NoError(t, p.close())
+
+			out, meta := readParquet(t, b.Bytes())
+			require.Equal(t, in, out)
+
+			// Two full row groups and the rest written on close.
+			groups := meta[4].([]any)
+			require.Len(t, groups, 3)
+
+			// Statistics of window_start in the first group.
+			stats := groups[0].(map[int16]any)[1].([]any)[0].(map[int16]any)[3].(map[int16]any)[12].(map[int16]any)
+			require.EqualValues(t, 0, binary.LittleEndian.Uint64(stats[6].([]byte)))
+			require.EqualValues(t, 1000, binary.LittleEndian.Uint64(stats[5].([]byte)))
+		})
+	}
+}
+
+func TestParquetWriter_Empty(t *testing.T) {
+	var b bytes.Buffer
+
+	p, err := newParquetWriter(&b, CompressionSnappy, 0)
+	require.NoError(t, err)
+	require.NoError(t, p.close())
+
+	out, _ := readParquet(t, b.Bytes())
+	require.Empty(t, out)
+}
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("")
+	require.NoError(t, err)
+	require.Equal(t, CompressionSnappy, c)
+
+	_, err = ParseCompression("lz4")
+	require.Error(t, err)
+}
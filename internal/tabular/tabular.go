@@ -0,0 +1,264 @@
+// Package tabular writes snapshots in long format, one row per window and
+// value, to CSV or Parquet files for offline analysis.
+//
+// Files are written to a directory and rolled by row count and age; a
+// snapshot's rows always go to a single file. A Parquet file is written as
+// <name>.parquet.tmp and renamed once its footer is written, so readers only
+// see complete files.
+package tabular
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+// stampLayout is the opening time embedded in file names; it sorts lexically
+// in time order.
+const stampLayout = "20060102T150405.000Z"
+
+// tmpSuffix marks a Parquet file that is still being written.
+const tmpSuffix = ".tmp"
+
+// Format is the file format of a Sink.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// Row is one value of one window. Count covers StartTime to WindowEnd, which
+// is the window itself for delta rows and the whole series for cumulative ones.
+type Row struct {
+	WindowStart int64
+	WindowEnd   int64
+	Key         string
+	Value       string
+	Count       uint64
+	Temporality sink.Temporality
+	StartTime   int64
+}
+
+// Rows returns the rows of snap, sorted by value. The reserved buckets appear
+// under their labels.
+func Rows(snap sink.Snapshot) []Row {
+	counts := snap.LabeledCounts()
+
+	temporality, start := snap.Temporality, snap.StartTime
+	if temporality == "" {
+		temporality = sink.TemporalityDelta
+	}
+
+	if start == 0 {
+		start = snap.WindowStart
+	}
+
+	rows := make([]Row, 0, len(counts))
+	for v, n := range counts {
+		rows = append(rows, Row{
+			WindowStart: snap.WindowStart, WindowEnd: snap.WindowEnd, Key: snap.AttributeKey, Value: v, Count: n,
+			Temporality: temporality, StartTime: start,
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Value < rows[j].Value })
+
+	return rows
+}
+
+// Options configure a Sink. Zero limits are disabled.
+type Options struct {
+	Dir    string
+	Format Format
+	// MaxRows rolls to a new file before a snapshot once the file holds this
+	// many rows.
+	MaxRows int64
+	// RollInterval rolls to a new file before a snapshot once the file has
+	// been open this long.
+	RollInterval time.Duration
+	// RowGroupSize is the number of rows per Parquet row group; 0 means
+	// DefaultRowGroupSize. Buffered rows are written when a group is full or
+	// the file is rolled or closed.
+	RowGroupSize int
+	// Compression is the Parquet page codec; "" means snappy.
+	Compression Compression
+	// TimeFormat renders the CSV window timestamps; "" means RFC3339.
+	TimeFormat sink.TimeFormat
+}
+
+// encoder writes the rows of one file; close completes the file contents.
+type encoder interface {
+	write(rows []Row) error
+	close() error
+}
+
+// Sink writes the rows of every published snapshot to rolling files.
+type Sink struct {
+	opts Options
+	now  func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	enc    encoder
+	path   string
+	rows   int64
+	opened time.Time
+	closed bool
+}
+
+// NewSink returns a sink writing to opts.Dir, which is created if needed.
+// The first file is created by the first snapshot.
+func NewSink(opts Options) (*Sink, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("tabular: empty directory")
+	}
+
+	switch opts.Format {
+	case FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("invalid table format %q: want csv|parquet", opts.Format)
+	}
+
+	if opts.Compression == "" {
+		opts.Compression = CompressionSnappy
+	}
+
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = sink.TimeRFC3339
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create %s dir: %w", opts.Format, err)
+	}
+
+	return &Sink{opts: opts, now: time.Now}, nil
+}
+
+// Publish implements sink.Sink.
+func (s *Sink) Publish(_ context.Context, snap sink.Snapshot) error {
+	rows := Rows(snap)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+
+	if s.enc != nil && s.due() {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	if s.enc == nil {
+		if err := s.openFile(); err != nil {
+			return err
+		}
+	}
+
+	s.rows += int64(len(rows))
+
+	return s.enc.write(rows)
+}
+
+func (s *Sink) due() bool {
+	return (s.opts.MaxRows > 0 && s.rows >= s.opts.MaxRows) ||
+		(s.opts.RollInterval > 0 && s.now().Sub(s.opened) >= s.opts.RollInterval)
+}
+
+func (s *Sink) openFile() error {
+	path, name := s.freeName(s.now())
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var enc encoder
+
+	switch s.opts.Format {
+	case FormatCSV:
+		enc, err = newCSVWriter(f, s.opts.TimeFormat)
+	case FormatParquet:
+		enc, err = newParquetWriter(f, s.opts.Compression, s.opts.RowGroupSize)
+	}
+
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.f, s.enc, s.path = f, enc, path
+	s.rows, s.opened = 0, s.now()
+
+	return nil
+}
+
+// freeName returns the final path of a file opened at t and the name it is
+// written under, moving t forward by a millisecond while either is taken.
+func (s *Sink) freeName(t time.Time) (path, name string) {
+	for {
+		path = filepath.Join(s.opts.Dir, "snapshots-"+t.UTC().Format(stampLayout)+"."+string(s.opts.Format))
+
+		name = path
+		if s.opts.Format == FormatParquet {
+			name += tmpSuffix
+		}
+
+		if !exists(path) && !exists(name) {
+			return path, name
+		}
+
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// closeFile completes, syncs and closes the current file.
+func (s *Sink) closeFile() error {
+	err := s.enc.close()
+	if err == nil {
+		err = s.f.Sync()
+	}
+
+	err = errors.Join(err, s.f.Close())
+
+	if err == nil && s.f.Name() != s.path {
+		err = os.Rename(s.f.Name(), s.path)
+	}
+
+	s.f, s.enc = nil, nil
+
+	return err
+}
+
+// Close completes the current file. Publishing afterwards fails.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	if s.enc == nil {
+		return nil
+	}
+
+	return s.closeFile()
+}
@@ -0,0 +1,115 @@
+package tabular
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func snapshot(start int64, counts map[string]uint64) sink.Snapshot {
+	return sink.Snapshot{
+		WindowStart:  start,
+		WindowEnd:    start + 10000,
+		AttributeKey: "foo",
+		Counts:       counts,
+		Missing:      1,
+		Labels:       sink.DefaultBucketLabels(),
+	}
+}
+
+func TestRows(t *testing.T) {
+	rows := Rows(snapshot(0, map[string]uint64{"beta": 2, "alpha": 3}))
+	require.Equal(t, []Row{
+		{WindowEnd: 10000, Key: "foo", Value: "__missing__", Count: 1, Temporality: sink.TemporalityDelta},
+		{WindowEnd: 10000, Key: "foo", Value: "alpha", Count: 3, Temporality: sink.TemporalityDelta},
+		{WindowEnd: 10000, Key: "foo", Value: "beta", Count: 2, Temporality: sink.TemporalityDelta},
+	}, rows)
+
+	// Cumulative counts are told apart and keep the start of their series.
+	cum := snapshot(20000, map[string]uint64{"alpha": 7})
+	cum.Temporality, cum.StartTime = sink.TemporalityCumulative, 5000
+
+	rows = Rows(cum)
+	require.Len(t, rows, 2)
+	require.Equal(t, Row{WindowStart: 20000, WindowEnd: 30000, Key: "foo", Value: "alpha", Count: 7, Temporality: sink.TemporalityCumulative, StartTime: 5000}, rows[1])
+}
+
+func TestSink_CSVRollsByRows(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewSink(Options{Dir: dir, Format: FormatCSV, MaxRows: 3})
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 9, 16, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	require.NoError(t, s.Publish(ctx, snapshot(0, map[string]uint64{"a": 1})))
+	require.NoError(t, s.Publish(ctx, snapshot(10000, map[string]uint64{"a": 1})))
+	// The file holds 4 rows now; the snapshot does not fit but is not split.
+	require.NoError(t, s.Publish(ctx, snapshot(20000, map[string]uint64{"a": 1, "b": 2, "c": 3})))
+	require.NoError(t, s.Close())
+	require.ErrorIs(t, s.Publish(ctx, snapshot(30000, nil)), os.ErrClosed)
+
+	first, err := os.ReadFile(filepath.Join(dir, "snapshots-20240309T160000.000Z.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "window_start,window_end,key,value,count,temporality,start_time\n"+
+		"1970-01-01T00:00:00Z,1970-01-01T00:00:10Z,foo,__missing__,1,delta,1970-01-01T00:00:00Z\n"+
+		"1970-01-01T00:00:00Z,1970-01-01T00:00:10Z,foo,a,1,delta,1970-01-01T00:00:00Z\n"+
+		"1970-01-01T00:00:10Z,1970-01-01T00:00:20Z,foo,__missing__,1,delta,1970-01-01T00:00:10Z\n"+
+		"1970-01-01T00:00:10Z,1970-01-01T00:00:20Z,foo,a,1,delta,1970-01-01T00:00:10Z\n", string(first))
+
+	// Opened in the same millisecond, so the name moves forward.
+	second, err := os.ReadFile(filepath.Join(dir, "snapshots-20240309T160000.001Z.csv"))
+	require.NoError(t, err)
+	require.Contains(t, string(second), "1970-01-01T00:00:20Z,1970-01-01T00:00:30Z,foo,c,3,delta,1970-01-01T00:00:20Z\n")
+}
+
+func TestSink_ParquetRollsByTime(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewSink(Options{Dir: dir, Format: FormatParquet, RollInterval: time.Minute, TimeFormat: sink.TimeUnixMillis})
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 9, 16, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	require.NoError(t, s.Publish(ctx, snapshot(0, map[string]uint64{"a": 1})))
+
+	// Still being written: only the temporary file exists.
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "snapshots-20240309T160000.000Z.parquet.tmp")}, names)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, s.Publish(ctx, snapshot(10000, map[string]uint64{"b": 2})))
+	require.NoError(t, s.Close())
+
+	names, err = filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "snapshots-20240309T160000.000Z.parquet"),
+		filepath.Join(dir, "snapshots-20240309T160100.000Z.parquet"),
+	}, names)
+
+	file, err := os.ReadFile(names[1])
+	require.NoError(t, err)
+
+	rows, _ := readParquet(t, file)
+	require.Equal(t, Rows(snapshot(10000, map[string]uint64{"b": 2})), rows)
+}
+
+func TestNewSink_Invalid(t *testing.T) {
+	_, err := NewSink(Options{Dir: t.TempDir(), Format: "xlsx"})
+	require.ErrorContains(t, err, "invalid table format")
+
+	_, err = NewSink(Options{Format: FormatCSV})
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package tabular
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type ids, as used in field and list headers.
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tI32       = 5
+	tI64       = 6
+	tBinary    = 8
+	tList      = 9
+	tStruct    = 12
+)
+
+// compact encodes the Thrift compact protocol, which Parquet uses for page
+// headers and the file footer. Only what the writer needs is implemented.
+type compact struct {
+	buf bytes.Buffer
+	// last holds the previous field id of each open struct; field headers
+	// carry the delta to it.
+	last []int16
+}
+
+func newCompact() *compact { return &compact{last: []int16{0}} }
+
+func (c *compact) bytes() []byte { return c.buf.Bytes() }
+
+func (c *compact) field(id int16, typ byte) {
+	prev := &c.last[len(c.last)-1]
+	if delta := id - *prev; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.varint(int64(id))
+	}
+
+	*prev = id
+}
+
+func (c *compact) varint(v int64) {
+	c.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (c *compact) uvarint(v uint64) {
+	c.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (c *compact) boolField(id int16, v bool) {
+	if v {
+		c.field(id, tBoolTrue)
+	} else {
+		c.field(id, tBoolFalse)
+	}
+}
+
+func (c *compact) i32Field(id int16, v int32) {
+	c.field(id, tI32)
+	c.varint(int64(v))
+}
+
+func (c *compact) i64Field(id int16, v int64) {
+	c.field(id, tI64)
+	c.varint(v)
+}
+
+func (c *compact) binaryField(id int16, v []byte) {
+	c.field(id, tBinary)
+	c.binary(v)
+}
+
+func (c *compact) binary(v []byte) {
+	c.uvarint(uint64(len(v)))
+	c.buf.Write(v)
+}
+
+// structField writes a nested struct whose fields are written by body.
+func (c *compact) structField(id int16, body func()) {
+	c.field(id, tStruct)
+	c.structBody(body)
+}
+
+func (c *compact) structBody(body func()) {
+	c.last = append(c.last, 0)
+	body()
+	c.buf.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+// listField writes a list header for n elements of type elem; the caller then
+// writes the elements.
+func (c *compact) listField(id int16, elem byte, n int) {
+	c.field(id, tList)
+
+	if n < 15 {
+		c.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		c.buf.WriteByte(0xf0 | elem)
+		c.uvarint(uint64(n))
+	}
+}
+
+// end closes the outermost struct.
+func (c *compact) end() { c.buf.WriteByte(0) }
@@ -0,0 +1,346 @@
+// Package wal persists the aggregator's open window so a restart can resume it.
+//
+// The on-disk layout is a directory with two files: checkpoint.json holds the
+// full window state as of a sequence number, and wal.log holds the records
+// applied after it. Recovery loads the checkpoint and replays every record
+// with a higher sequence number; a torn or corrupt tail is truncated.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+const (
+	checkpointFile = "checkpoint.json"
+	logFile        = "wal.log"
+
+	// frameHeaderSize is the length (uint32) plus CRC-32C (uint32) preceding each record.
+	frameHeaderSize = 8
+	// maxRecordSize guards recovery against allocating for a corrupt length prefix.
+	maxRecordSize = 64 << 20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// FsyncPolicy controls when appended records are forced to stable storage.
+// Checkpoints are always synced.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs after every appended record.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval syncs on append once the configured interval has elapsed since the last sync.
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves syncing of records to the operating system.
+	FsyncNever FsyncPolicy = "never"
+)
+
+// ParseFsyncPolicy validates a policy name.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch p := FsyncPolicy(s); p {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid fsync policy %q: want always|interval|never", s)
+	}
+}
+
+// Options configures a Log.
+type Options struct {
+	Dir           string
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration
+}
+
+// Record is one batch applied to the open window.
+type Record struct {
+	Seq         uint64   `json:"seq"`
+	Values      []string `json:"values,omitempty"`
+	Missing     uint64   `json:"missing,omitempty"`
+	Null        uint64   `json:"null,omitempty"`
+	Unsupported uint64   `json:"unsupported,omitempty"`
+}
+
+// State is the durable image of the open window. Seq is the sequence number of
+// the last record folded into it. Pending holds closed snapshots that had not
+// been delivered when the state was checkpointed; they are re-published on
+// recovery, so delivery is at-least-once. Rollups holds the open window of
+// each rollup tier, keyed by tier name. AttributeKey and Generation are the
+// settings the open window was counted under.
+type State struct {
+	Seq          uint64                   `json:"seq"`
+	AttributeKey string                   `json:"attribute_key,omitempty"`
+	Generation   uint64                   `json:"generation,omitempty"`
+	WindowStart  int64                    `json:"window_start"`
+	Counts       map[string]uint64        `json:"counts"`
+	Missing      uint64                   `json:"missing"`
+	Null         uint64                   `json:"null"`
+	Unsupported  uint64                   `json:"unsupported"`
+	Total        uint64                   `json:"total"`
+	Pending      []Pending                `json:"pending,omitempty"`
+	Rollups      map[string]sink.Snapshot `json:"rollups,omitempty"`
+}
+
+// Pending is a closed snapshot awaiting delivery to the named target; the
+// empty target is the primary sink.
+type Pending struct {
+	Target   string        `json:"target,omitempty"`
+	Snapshot sink.Snapshot `json:"snapshot"`
+}
+
+// Apply folds a record into the state.
+func (s *State) Apply(r Record) {
+	if s.Counts == nil {
+		s.Counts = make(map[string]uint64, len(r.Values))
+	}
+
+	for _, v := range r.Values {
+		s.Counts[v]++
+	}
+
+	s.Missing += r.Missing
+	s.Null += r.Null
+	s.Unsupported += r.Unsupported
+	s.Total += uint64(len(r.Values)) + r.Missing + r.Null + r.Unsupported
+	s.Seq = r.Seq
+}
+
+// Log is an append-only record log with checkpointing. It is not safe for
+// concurrent use; the aggregator goroutine is its only writer.
+type Log struct {
+	opts     Options
+	f        *os.File
+	seq      uint64
+	lastSync time.Time
+	buf      []byte
+}
+
+// Open opens or creates the log in opts.Dir and returns the recovered state.
+// The returned state has a zero WindowStart if nothing was persisted yet.
+func Open(opts Options) (*Log, State, error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncInterval
+	}
+
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = time.Second
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, State{}, fmt.Errorf("create state dir: %w", err)
+	}
+
+	state, err := readCheckpoint(filepath.Join(opts.Dir, checkpointFile))
+	if err != nil {
+		return nil, State{}, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(opts.Dir, logFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, State{}, fmt.Errorf("open wal: %w", err)
+	}
+
+	valid, err := replay(f, &state)
+	if err != nil {
+		_ = f.Close()
+		return nil, State{}, err
+	}
+
+	// Drop a torn or corrupt tail so new records follow the last good one.
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, State{}, fmt.Errorf("truncate wal: %w", err)
+	}
+
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, State{}, fmt.Errorf("seek wal: %w", err)
+	}
+
+	return &Log{opts: opts, f: f, seq: state.Seq, lastSync: time.Now()}, state, nil
+}
+
+// Append writes a record, assigning it the next sequence number.
+func (l *Log) Append(r Record) error {
+	l.seq++
+	r.Seq = l.seq
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode wal record: %w", err)
+	}
+
+	l.buf = l.buf[:0]
+	l.buf = binary.LittleEndian.AppendUint32(l.buf, uint32(len(payload)))
+	l.buf = binary.LittleEndian.AppendUint32(l.buf, crc32.Checksum(payload, castagnoli))
+	l.buf = append(l.buf, payload...)
+
+	if _, err := l.f.Write(l.buf); err != nil {
+		return fmt.Errorf("write wal record: %w", err)
+	}
+
+	switch l.opts.Fsync {
+	case FsyncAlways:
+		return l.Sync()
+	case FsyncInterval:
+		if time.Since(l.lastSync) >= l.opts.FsyncInterval {
+			return l.Sync()
+		}
+	case FsyncNever:
+	}
+
+	return nil
+}
+
+// Sync forces appended records to stable storage.
+func (l *Log) Sync() error {
+	l.lastSync = time.Now()
+
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	return nil
+}
+
+// Checkpoint durably replaces the persisted state with s and truncates the
+// record log. s must reflect every record appended so far.
+func (l *Log) Checkpoint(s State) error {
+	s.Seq = l.seq
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+
+	if err := writeFileAtomic(l.opts.Dir, checkpointFile, data); err != nil {
+		return err
+	}
+
+	// Records up to s.Seq are now covered by the checkpoint; a crash before the
+	// truncate is harmless because replay skips them by sequence number.
+	if err := l.f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek wal: %w", err)
+	}
+
+	return nil
+}
+
+// Close syncs and closes the record log.
+func (l *Log) Close() error {
+	return errors.Join(l.Sync(), l.f.Close())
+}
+
+func readCheckpoint(path string) (State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+
+	if err != nil {
+		return State{}, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, fmt.Errorf("decode checkpoint %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// replay applies every intact record with a sequence number above state.Seq
+// and returns the offset just past the last intact record.
+func replay(f *os.File, state *State) (int64, error) {
+	r := bufio.NewReader(f)
+
+	var (
+		offset int64
+		header [frameHeaderSize]byte
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			// io.EOF is a clean end; io.ErrUnexpectedEOF is a torn header.
+			return offset, nil
+		}
+
+		size := binary.LittleEndian.Uint32(header[:4])
+		sum := binary.LittleEndian.Uint32(header[4:])
+
+		if size > maxRecordSize {
+			return offset, nil
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return offset, nil
+		}
+
+		if crc32.Checksum(payload, castagnoli) != sum {
+			return offset, nil
+		}
+
+		var rec Record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, nil
+		}
+
+		if rec.Seq > state.Seq {
+			state.Apply(rec)
+		}
+
+		offset += frameHeaderSize + int64(size)
+	}
+}
+
+// writeFileAtomic writes name in dir via a synced temp file and rename, then
+// syncs the directory so the rename itself is durable.
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp checkpoint: %w", err)
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("sync checkpoint: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("rename checkpoint: %w", err)
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open state dir: %w", err)
+	}
+
+	return errors.Join(d.Sync(), d.Close())
+}
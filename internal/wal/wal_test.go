@@ -0,0 +1,164 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"dash0.com/otlp-log-processor-backend/internal/sink"
+)
+
+func open(t *testing.T, dir string) (*Log, State) {
+	t.Helper()
+
+	l, s, err := Open(Options{Dir: dir, Fsync: FsyncAlways})
+	require.NoError(t, err)
+
+	return l, s
+}
+
+func TestOpen_EmptyDir(t *testing.T) {
+	l, s := open(t, filepath.Join(t.TempDir(), "state"))
+	defer func() { require.NoError(t, l.Close()) }()
+
+	require.Zero(t, s.WindowStart)
+	require.Zero(t, s.Total)
+	require.Empty(t, s.Counts)
+}
+
+func TestLog_RecoversAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Checkpoint(State{WindowStart: 1000}))
+	require.NoError(t, l.Append(Record{Values: []string{"a", "b", "a"}, Missing: 1}))
+	require.NoError(t, l.Append(Record{Values: []string{"b"}, Null: 2, Unsupported: 1}))
+	// Crash: the process dies without Close.
+
+	l2, s := open(t, dir)
+	defer func() { require.NoError(t, l2.Close()) }()
+
+	require.EqualValues(t, 1000, s.WindowStart)
+	require.Equal(t, map[string]uint64{"a": 2, "b": 2}, s.Counts)
+	require.EqualValues(t, 1, s.Missing)
+	require.EqualValues(t, 2, s.Null)
+	require.EqualValues(t, 1, s.Unsupported)
+	require.EqualValues(t, 8, s.Total)
+	require.EqualValues(t, 2, s.Seq)
+
+	// New records continue the sequence after recovery.
+	require.NoError(t, l2.Append(Record{Values: []string{"c"}}))
+	require.EqualValues(t, 3, l2.seq)
+}
+
+func TestLog_CheckpointTruncatesLog(t *testing.T) {
+	dir := t.TempDir()
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Append(Record{Values: []string{"a"}}))
+	require.NoError(t, l.Checkpoint(State{WindowStart: 2000, Counts: map[string]uint64{"a": 1}, Total: 1}))
+	require.NoError(t, l.Append(Record{Values: []string{"b"}}))
+	require.NoError(t, l.Close())
+
+	l2, s := open(t, dir)
+	defer func() { require.NoError(t, l2.Close()) }()
+
+	require.EqualValues(t, 2000, s.WindowStart)
+	require.Equal(t, map[string]uint64{"a": 1, "b": 1}, s.Counts)
+	require.EqualValues(t, 2, s.Total)
+}
+
+func TestLog_CrashBeforeTruncateDoesNotDoubleCount(t *testing.T) {
+	dir := t.TempDir()
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Append(Record{Values: []string{"a"}}))
+	require.NoError(t, l.Append(Record{Values: []string{"a"}}))
+	require.NoError(t, l.Close())
+
+	// Simulate a crash after the checkpoint rename but before the log truncate:
+	// the checkpoint already covers both records still present in wal.log.
+	require.NoError(t, writeFileAtomic(dir, checkpointFile, []byte(`{"seq":2,"window_start":3000,"counts":{"a":2},"total":2}`)))
+
+	l2, s := open(t, dir)
+	defer func() { require.NoError(t, l2.Close()) }()
+
+	require.Equal(t, map[string]uint64{"a": 2}, s.Counts)
+	require.EqualValues(t, 2, s.Total)
+}
+
+func TestLog_TornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Append(Record{Values: []string{"a"}}))
+	require.NoError(t, l.Append(Record{Values: []string{"b"}}))
+	require.NoError(t, l.Close())
+
+	path := filepath.Join(dir, logFile)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	// Cut the last record in half, as a crash mid-write would.
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	l2, s := open(t, dir)
+	require.Equal(t, map[string]uint64{"a": 1}, s.Counts)
+	require.NoError(t, l2.Append(Record{Values: []string{"c"}}))
+	require.NoError(t, l2.Close())
+
+	l3, s := open(t, dir)
+	defer func() { require.NoError(t, l3.Close()) }()
+
+	require.Equal(t, map[string]uint64{"a": 1, "c": 1}, s.Counts)
+}
+
+func TestLog_CorruptRecordStopsReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Append(Record{Values: []string{"a"}}))
+	require.NoError(t, l.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{5, 0, 0, 0, 0xde, 0xad, 0xbe, 0xef, 'j', 'u', 'n', 'k', '!'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	l2, s := open(t, dir)
+	defer func() { require.NoError(t, l2.Close()) }()
+
+	require.Equal(t, map[string]uint64{"a": 1}, s.Counts)
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, p := range []string{"always", "interval", "never"} {
+		got, err := ParseFsyncPolicy(p)
+		require.NoError(t, err)
+		require.EqualValues(t, p, got)
+	}
+
+	_, err := ParseFsyncPolicy("sometimes")
+	require.Error(t, err)
+}
+
+func TestLog_CheckpointKeepsPendingAndRollups(t *testing.T) {
+	dir := t.TempDir()
+	pending := []Pending{
+		{Snapshot: sink.Snapshot{WindowStart: 1, WindowEnd: 2, Counts: map[string]uint64{"a": 1}, Total: 1}},
+		{Target: "rollup/1m0s", Snapshot: sink.Snapshot{WindowStart: 0, WindowEnd: 60, Total: 4}},
+	}
+	rollups := map[string]sink.Snapshot{"rollup/1h0m0s": {WindowStart: 0, WindowEnd: 60, Counts: map[string]uint64{"b": 2}, Total: 2}}
+
+	l, _ := open(t, dir)
+	require.NoError(t, l.Checkpoint(State{WindowStart: 2, Pending: pending, Rollups: rollups}))
+	require.NoError(t, l.Close())
+
+	l2, s := open(t, dir)
+	defer func() { require.NoError(t, l2.Close()) }()
+
+	require.Equal(t, pending, s.Pending)
+	require.Equal(t, rollups, s.Rollups)
+}